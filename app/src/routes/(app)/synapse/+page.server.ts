@@ -7,10 +7,11 @@ type Thought = Database['public']['Tables']['user_thoughts']['Row'];
 
 /*
  * remember - using API Gateway for Go lambda so dont forget the API key in any backend requests
+ * the Go API identifies the user from the Supabase access token, so forward it as a bearer token
  */
 
-export const load: PageServerLoad = async ({ locals: { user } }) => {
-    if (!user) {
+export const load: PageServerLoad = async ({ locals: { user, session } }) => {
+    if (!user || !session) {
         console.error('User not found in session');
         throw redirect(302, '/auth/login');
     }
@@ -19,14 +20,9 @@ export const load: PageServerLoad = async ({ locals: { user } }) => {
         method: 'POST',
         headers: {
             'Content-Type': 'application/json',
-            'X-API-Key': GO_API_KEY
-        },
-        body: JSON.stringify({
-            user_id: user.id,
-            limit: 25,
-            cursor: '',
-            order: 'before',
-        })
+            'X-API-Key': GO_API_KEY,
+            'Authorization': `Bearer ${session.access_token}`
+        }
     });
 
     if (!res.ok) {
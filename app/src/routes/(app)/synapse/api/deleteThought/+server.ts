@@ -1,8 +1,8 @@
 import type { RequestHandler } from '@sveltejs/kit';
 import { GO_API_ENDPOINT, GO_API_KEY } from '$env/static/private';
 
-export const POST: RequestHandler = async ({ request, locals: { user } }) => {
-    if (!user) {
+export const POST: RequestHandler = async ({ request, locals: { user, session } }) => {
+    if (!user || !session) {
         return new Response(JSON.stringify({ error: 'Unauthorized' }), { 
             status: 401,
             headers: { 'Content-Type': 'application/json' }
@@ -16,10 +16,10 @@ export const POST: RequestHandler = async ({ request, locals: { user } }) => {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
-                'X-API-Key': GO_API_KEY
+                'X-API-Key': GO_API_KEY,
+                'Authorization': `Bearer ${session.access_token}`
             },
             body: JSON.stringify({
-                user_id: user.id,
                 thought_id: thought_id
             })
         });
@@ -1,8 +1,8 @@
 import type { RequestHandler } from '@sveltejs/kit';
 import { GO_API_ENDPOINT, GO_API_KEY } from '$env/static/private';
 
-export const POST: RequestHandler = async ({ request, locals: { user } }) => {
-    if (!user) {
+export const POST: RequestHandler = async ({ request, locals: { user, session } }) => {
+    if (!user || !session) {
         return new Response(JSON.stringify({ error: 'Unauthorized' }), { 
             status: 401,
             headers: { 'Content-Type': 'application/json' }
@@ -10,14 +10,13 @@ export const POST: RequestHandler = async ({ request, locals: { user } }) => {
     }
 
     const formData = await request.formData();
-    
-    formData.append('user_id', user.id);
 
     try {
         const res = await fetch(`${GO_API_ENDPOINT}/newThought`, {
             method: 'POST',
             headers: {
-                'X-API-Key': GO_API_KEY
+                'X-API-Key': GO_API_KEY,
+                'Authorization': `Bearer ${session.access_token}`
             },
             body: formData
         });
@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type contextKey struct{}
+
+// stores the authenticated user for handlers further down the chain
+func WithUserID(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, contextKey{}, userID)
+}
+
+// returns false if the request never went through authentication
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(contextKey{}).(uuid.UUID)
+	return userID, ok
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	jwksTTL = 10 * time.Minute
+
+	// an unknown kid triggers a refresh (keys rotate), but not more often than this; a failed
+	// refresh waits as long before the next attempt
+	jwksMinRefreshInterval = 1 * time.Minute
+
+	jwksFetchTimeout = 5 * time.Second
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// caches the public keys published at a JWKS URL
+type jwksCache struct {
+	url    string
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	lastErr     error
+	inflight    *jwksFetch
+}
+
+// a refresh in progress; every caller that needs it waits on the same one
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{
+		url:    url,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+	}
+}
+
+func (c *jwksCache) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	fresh := time.Since(c.fetchedAt) <= jwksTTL
+	c.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	// keep using the old keys if the endpoint is briefly unavailable
+	err := c.refresh(ctx)
+
+	c.mu.RLock()
+	key, ok = c.keys[kid]
+	loaded := c.keys != nil
+	c.mu.RUnlock()
+
+	if !ok {
+		if !loaded && err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidSignature, kid)
+	}
+	return key, nil
+}
+
+// fetches the keys unless a fetch is already running or the last attempt was too recent, and
+// waits for it or for ctx. the fetch itself doesn't use ctx, so one caller giving up doesn't fail
+// it for the others
+func (c *jwksCache) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	f := c.inflight
+	if f == nil {
+		if time.Since(c.attemptedAt) < jwksMinRefreshInterval {
+			err := c.lastErr
+			c.mu.Unlock()
+			return err
+		}
+
+		f = &jwksFetch{done: make(chan struct{})}
+		c.inflight = f
+		c.attemptedAt = time.Now()
+		go c.fetch(f)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *jwksCache) fetch(f *jwksFetch) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	keys, err := c.load(ctx)
+	if err != nil {
+		log.Printf("[AUTH] Error refreshing JWKS: %v", err)
+	} else {
+		log.Printf("[AUTH] Loaded %d key(s) from JWKS", len(keys))
+	}
+
+	c.mu.Lock()
+	if err == nil {
+		c.keys = keys
+		c.fetchedAt = time.Now()
+	}
+	c.lastErr = err
+	c.inflight = nil
+	c.mu.Unlock()
+
+	f.err = err
+	close(f.done)
+}
+
+func (c *jwksCache) load(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", res.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, err := k.publicKey()
+		if err != nil {
+			log.Printf("[AUTH] Skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("point is not on curve")
+		}
+		return pub, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrUnsupportedAlg   = errors.New("unsupported token algorithm")
+	ErrExpiredToken     = errors.New("token is expired")
+	ErrInvalidClaims    = errors.New("invalid token claims")
+)
+
+// clock skew tolerated on exp and nbf
+const leeway = 30 * time.Second
+
+type JWTConfig struct {
+	HMACSecret string // legacy Supabase JWT secret (HS256)
+	JWKSURL    string // e.g. https://<project>.supabase.co/auth/v1/.well-known/jwks.json (RS256/ES256)
+	Issuer     string // optional, checked against iss when set
+	Audience   string // checked against aud when set; Supabase uses "authenticated"
+}
+
+// JWTVerifier validates Supabase-issued access tokens
+type JWTVerifier struct {
+	hmacSecret []byte
+	jwks       *jwksCache
+	issuer     string
+	audience   string
+}
+
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Role      string   `json:"role"`
+	Email     string   `json:"email"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// aud can be a single string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	if cfg.HMACSecret == "" && cfg.JWKSURL == "" {
+		return nil, fmt.Errorf("either a JWT secret or a JWKS URL is required")
+	}
+
+	v := &JWTVerifier{
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+	}
+	if cfg.HMACSecret != "" {
+		v.hmacSecret = []byte(cfg.HMACSecret)
+	}
+	if cfg.JWKSURL != "" {
+		v.jwks = newJWKSCache(cfg.JWKSURL)
+	}
+
+	return v, nil
+}
+
+// checks the signature and the registered claims, returns the claims if the token is valid
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if err := v.verifySignature(ctx, h, signingInput, signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if err := v.validateClaims(&claims); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+func (v *JWTVerifier) verifySignature(ctx context.Context, h header, signingInput []byte, signature []byte) error {
+	switch h.Alg {
+	case "HS256":
+		if v.hmacSecret == nil {
+			return ErrUnsupportedAlg
+		}
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	case "RS256", "ES256":
+		if v.jwks == nil {
+			return ErrUnsupportedAlg
+		}
+		key, err := v.jwks.key(ctx, h.Kid)
+		if err != nil {
+			return err
+		}
+
+		digest := sha256.Sum256(signingInput)
+		switch pub := key.(type) {
+		case *rsa.PublicKey:
+			if h.Alg != "RS256" || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+				return ErrInvalidSignature
+			}
+		case *ecdsa.PublicKey:
+			// JWS ES256 signatures are r || s, 32 bytes each
+			if h.Alg != "ES256" || len(signature) != 64 {
+				return ErrInvalidSignature
+			}
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if !ecdsa.Verify(pub, digest[:], r, s) {
+				return ErrInvalidSignature
+			}
+		default:
+			return ErrUnsupportedAlg
+		}
+		return nil
+
+	default:
+		// includes "none"
+		return ErrUnsupportedAlg
+	}
+}
+
+func (v *JWTVerifier) validateClaims(claims *Claims) error {
+	now := time.Now()
+
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)) {
+		return ErrExpiredToken
+	}
+	if claims.NotBefore != 0 && now.Add(leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidClaims)
+	}
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: missing sub", ErrInvalidClaims)
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidClaims, claims.Issuer)
+	}
+	if v.audience != "" {
+		found := false
+		for _, aud := range claims.Audience {
+			if aud == v.audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: unexpected audience", ErrInvalidClaims)
+		}
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
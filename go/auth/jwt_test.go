@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-jwt-secret"
+
+var (
+	testRSAKey = mustRSAKey()
+	testECKey  = mustECKey()
+)
+
+func mustRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustECKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func validClaims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"sub": "11111111-1111-1111-1111-111111111111",
+		"iss": "https://example.supabase.co/auth/v1",
+		"aud": "authenticated",
+		"exp": now.Add(time.Hour).Unix(),
+		"iat": now.Unix(),
+	}
+}
+
+func segment(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signs with whatever key matches alg; "none" gets an empty signature
+func signToken(t *testing.T, alg string, kid string, claims map[string]any) string {
+	t.Helper()
+
+	h := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		h["kid"] = kid
+	}
+	signingInput := segment(h) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte(testSecret))
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case "RS256":
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("SignPKCS1v15: %v", err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, testECKey, digest[:])
+		if err != nil {
+			t.Fatalf("ecdsa.Sign: %v", err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func rsaJWK(kid string, pub *rsa.PublicKey) jwk {
+	return jwk{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, pub *ecdsa.PublicKey) jwk {
+	x, y := make([]byte, 32), make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	return jwk{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(x),
+		Y:   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+// serves whatever keys are set, counting fetches
+type jwksServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    []jwk
+	status  int
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...jwk) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: keys, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string][]jwk{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(status int, keys ...jwk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.keys = keys
+}
+
+func newVerifier(t *testing.T, cfg JWTConfig) *JWTVerifier {
+	t.Helper()
+	v, err := NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	return v
+}
+
+// lets the next unknown kid refresh without waiting out jwksMinRefreshInterval
+func expireRefreshBackoff(v *JWTVerifier) {
+	v.jwks.mu.Lock()
+	v.jwks.attemptedAt = time.Time{}
+	v.jwks.mu.Unlock()
+}
+
+func TestVerify(t *testing.T) {
+	server := newJWKSServer(t, rsaJWK("rsa-1", &testRSAKey.PublicKey), ecJWK("ec-1", &testECKey.PublicKey))
+	jwksConfig := JWTConfig{
+		JWKSURL:  server.URL,
+		Issuer:   "https://example.supabase.co/auth/v1",
+		Audience: "authenticated",
+	}
+	hmacConfig := JWTConfig{HMACSecret: testSecret, Audience: "authenticated"}
+
+	with := func(changes map[string]any) map[string]any {
+		claims := validClaims()
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		cfg     JWTConfig
+		alg     string
+		kid     string
+		claims  map[string]any
+		wantErr error
+	}{
+		{"RS256", jwksConfig, "RS256", "rsa-1", validClaims(), nil},
+		{"ES256", jwksConfig, "ES256", "ec-1", validClaims(), nil},
+		{"HS256 with a secret", hmacConfig, "HS256", "", validClaims(), nil},
+
+		{"none refused", jwksConfig, "none", "", validClaims(), ErrUnsupportedAlg},
+		{"HS256 refused in JWKS mode", jwksConfig, "HS256", "rsa-1", validClaims(), ErrUnsupportedAlg},
+		{"RS256 refused with only a secret", hmacConfig, "RS256", "rsa-1", validClaims(), ErrUnsupportedAlg},
+		{"RSA key with ES256", jwksConfig, "ES256", "rsa-1", validClaims(), ErrInvalidSignature},
+		{"EC key with RS256", jwksConfig, "RS256", "ec-1", validClaims(), ErrInvalidSignature},
+
+		{"expired inside leeway", jwksConfig, "RS256", "rsa-1", with(map[string]any{"exp": now.Add(-leeway / 2).Unix()}), nil},
+		{"expired past leeway", jwksConfig, "RS256", "rsa-1", with(map[string]any{"exp": now.Add(-leeway - time.Minute).Unix()}), ErrExpiredToken},
+		{"no exp", jwksConfig, "RS256", "rsa-1", with(map[string]any{"exp": nil}), ErrExpiredToken},
+		{"nbf inside leeway", jwksConfig, "RS256", "rsa-1", with(map[string]any{"nbf": now.Add(leeway / 2).Unix()}), nil},
+		{"nbf past leeway", jwksConfig, "RS256", "rsa-1", with(map[string]any{"nbf": now.Add(leeway + time.Minute).Unix()}), ErrInvalidClaims},
+
+		{"wrong issuer", jwksConfig, "RS256", "rsa-1", with(map[string]any{"iss": "https://other.supabase.co/auth/v1"}), ErrInvalidClaims},
+		{"wrong audience", jwksConfig, "RS256", "rsa-1", with(map[string]any{"aud": "anon"}), ErrInvalidClaims},
+		{"audience in a list", jwksConfig, "RS256", "rsa-1", with(map[string]any{"aud": []string{"other", "authenticated"}}), nil},
+		{"no sub", jwksConfig, "RS256", "rsa-1", with(map[string]any{"sub": nil}), ErrInvalidClaims},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newVerifier(t, tt.cfg)
+			token := signToken(t, tt.alg, tt.kid, tt.claims)
+
+			claims, err := v.Verify(context.Background(), token)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Verify = %v, want nil", err)
+				}
+				if claims.Subject != "11111111-1111-1111-1111-111111111111" {
+					t.Errorf("Subject = %q", claims.Subject)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedPayload(t *testing.T) {
+	server := newJWKSServer(t, rsaJWK("rsa-1", &testRSAKey.PublicKey))
+	v := newVerifier(t, JWTConfig{JWKSURL: server.URL})
+
+	token := signToken(t, "RS256", "rsa-1", validClaims())
+	other := signToken(t, "RS256", "rsa-1", map[string]any{"sub": "22222222-2222-2222-2222-222222222222", "exp": time.Now().Add(time.Hour).Unix()})
+
+	// the first token's header and signature with the second one's payload
+	parts := strings.Split(token, ".")
+	parts[1] = strings.Split(other, ".")[1]
+	if _, err := v.Verify(context.Background(), strings.Join(parts, ".")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestJWKSUnknownKidRefreshes(t *testing.T) {
+	server := newJWKSServer(t, rsaJWK("rsa-1", &testRSAKey.PublicKey))
+	v := newVerifier(t, JWTConfig{JWKSURL: server.URL})
+	ctx := context.Background()
+
+	if _, err := v.Verify(ctx, signToken(t, "RS256", "rsa-1", validClaims())); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// the keys rotate
+	server.set(http.StatusOK, rsaJWK("rsa-1", &testRSAKey.PublicKey), ecJWK("ec-2", &testECKey.PublicKey))
+	rotated := signToken(t, "ES256", "ec-2", validClaims())
+
+	// too soon after the last fetch, so the unknown kid is refused without another one
+	if _, err := v.Verify(ctx, rotated); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Verify before the backoff = %v, want %v", err, ErrInvalidSignature)
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Fatalf("fetches = %d, want 1", got)
+	}
+
+	expireRefreshBackoff(v)
+	if _, err := v.Verify(ctx, rotated); err != nil {
+		t.Fatalf("Verify after the backoff = %v, want nil", err)
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d, want 2", got)
+	}
+
+	// known keys don't fetch again
+	if _, err := v.Verify(ctx, signToken(t, "RS256", "rsa-1", validClaims())); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if got := server.fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d, want 2", got)
+	}
+}
+
+func TestJWKSFailedRefreshBacksOff(t *testing.T) {
+	server := newJWKSServer(t)
+	server.set(http.StatusInternalServerError)
+	v := newVerifier(t, JWTConfig{JWKSURL: server.URL})
+	ctx := context.Background()
+	token := signToken(t, "RS256", "rsa-1", validClaims())
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(ctx, token); err == nil {
+			t.Fatalf("Verify %d = nil, want an error", i)
+		}
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Errorf("fetches = %d, want 1", got)
+	}
+
+	// once the endpoint is back, the next attempt after the backoff loads the keys
+	server.set(http.StatusOK, rsaJWK("rsa-1", &testRSAKey.PublicKey))
+	expireRefreshBackoff(v)
+	if _, err := v.Verify(ctx, token); err != nil {
+		t.Errorf("Verify = %v, want nil", err)
+	}
+}
+
+func TestJWKSConcurrentRefreshFetchesOnce(t *testing.T) {
+	server := newJWKSServer(t, rsaJWK("rsa-1", &testRSAKey.PublicKey))
+	v := newVerifier(t, JWTConfig{JWKSURL: server.URL})
+	token := signToken(t, "RS256", "rsa-1", validClaims())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Verify(context.Background(), token); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := server.fetches.Load(); got != 1 {
+		t.Errorf("fetches = %d, want 1", got)
+	}
+}
+
+func TestJWKSRefreshOutlivesCaller(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode(map[string][]jwk{"keys": {rsaJWK("rsa-1", &testRSAKey.PublicKey)}})
+	}))
+	t.Cleanup(server.Close)
+	v := newVerifier(t, JWTConfig{JWKSURL: server.URL})
+	token := signToken(t, "RS256", "rsa-1", validClaims())
+
+	// the first caller gives up while the fetch is still running
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := v.Verify(ctx, token); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Verify with a canceled context = %v, want %v", err, context.Canceled)
+	}
+
+	// the fetch keeps going, and the next caller waits on it rather than starting another
+	close(release)
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Errorf("Verify = %v, want nil", err)
+	}
+}
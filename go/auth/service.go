@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ServiceAuthKey  = "key"  // X-API-Key must match one of the keys
+	ServiceAuthHMAC = "hmac" // requests are signed with one of the keys, which never goes over the wire
+
+	APIKeyHeader    = "X-API-Key"
+	TimestampHeader = "X-API-Timestamp"
+	NonceHeader     = "X-API-Nonce"
+	SignatureHeader = "X-API-Signature"
+
+	// signed requests older (or further in the future) than this are rejected
+	maxTimestampSkew = 5 * time.Minute
+
+	// nonces are random per request; anything longer is refused rather than remembered
+	maxNonceLength = 128
+)
+
+var (
+	ErrMissingServiceCredentials = errors.New("missing service credentials")
+	ErrInvalidServiceCredentials = errors.New("invalid service credentials")
+	ErrReplayedRequest           = errors.New("request signature was already used")
+)
+
+// ServiceAuthenticator checks that a request comes from one of our own services (the SvelteKit server)
+// several keys can be active at once so they can be rotated without downtime
+type ServiceAuthenticator struct {
+	keys [][]byte
+	mode string
+
+	// nonces seen inside the timestamp window; best effort, since each Lambda instance has its own
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewServiceAuthenticator(keys []string, mode string) (*ServiceAuthenticator, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one service API key is required")
+	}
+	if mode != ServiceAuthKey && mode != ServiceAuthHMAC {
+		return nil, fmt.Errorf("unknown service auth mode %q", mode)
+	}
+
+	a := &ServiceAuthenticator{
+		mode: mode,
+		seen: make(map[string]time.Time),
+	}
+	for _, key := range keys {
+		a.keys = append(a.keys, []byte(key))
+	}
+
+	return a, nil
+}
+
+func (a *ServiceAuthenticator) Authenticate(r *http.Request) error {
+	if a.mode == ServiceAuthHMAC {
+		return a.checkSignature(r)
+	}
+	return a.checkKey(r)
+}
+
+func (a *ServiceAuthenticator) checkKey(r *http.Request) error {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return ErrMissingServiceCredentials
+	}
+
+	// compare against every key so the time taken doesn't reveal which one matched
+	matched := 0
+	for _, k := range a.keys {
+		matched |= subtle.ConstantTimeCompare([]byte(key), k)
+	}
+	if matched != 1 {
+		return ErrInvalidServiceCredentials
+	}
+	return nil
+}
+
+// signature = hex(HMAC-SHA256(key, SigningMessage(...))), timestamp in unix seconds. the body is read
+// to hash it and put back for the handler
+func (a *ServiceAuthenticator) checkSignature(r *http.Request) error {
+	timestampStr := r.Header.Get(TimestampHeader)
+	nonce := r.Header.Get(NonceHeader)
+	signatureStr := r.Header.Get(SignatureHeader)
+	if timestampStr == "" || nonce == "" || signatureStr == "" {
+		return ErrMissingServiceCredentials
+	}
+	if len(nonce) > maxNonceLength {
+		return ErrInvalidServiceCredentials
+	}
+
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		return ErrInvalidServiceCredentials
+	}
+	now := time.Now()
+	signedAt := time.Unix(timestamp, 0)
+	if signedAt.Before(now.Add(-maxTimestampSkew)) || signedAt.After(now.Add(maxTimestampSkew)) {
+		return fmt.Errorf("%w: timestamp outside the allowed window", ErrInvalidServiceCredentials)
+	}
+
+	signature, err := hex.DecodeString(signatureStr)
+	if err != nil {
+		return ErrInvalidServiceCredentials
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	message := SigningMessage(timestampStr, nonce, r.Method, signedTarget(r), body)
+	matched := false
+	for _, key := range a.keys {
+		if hmac.Equal(Sign(key, message), signature) {
+			matched = true
+		}
+	}
+	if !matched {
+		return ErrInvalidServiceCredentials
+	}
+
+	return a.rememberNonce(nonce, signedAt.Add(maxTimestampSkew), now)
+}
+
+// keyed on the nonce rather than the signature, which has more than one spelling (hex case)
+func (a *ServiceAuthenticator) rememberNonce(nonce string, expires time.Time, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.seen[nonce]; ok {
+		return ErrReplayedRequest
+	}
+
+	for n, exp := range a.seen {
+		if now.After(exp) {
+			delete(a.seen, n)
+		}
+	}
+	a.seen[nonce] = expires
+	return nil
+}
+
+// the path, plus "?" and the canonical query when there is one. the query is what the request
+// means, not how it was spelled: a proxy (API Gateway) may hand it over re-encoded or reordered
+func signedTarget(r *http.Request) string {
+	if r.URL.RawQuery == "" {
+		return r.URL.Path
+	}
+	return r.URL.Path + "?" + CanonicalQuery(r.URL.RawQuery)
+}
+
+// the query as url.Values.Encode writes it: keys sorted, values of a key in their original order,
+// everything percent-encoded. a query that doesn't parse is left as it is, so it can only match a
+// signature over those exact bytes
+func CanonicalQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	return values.Encode()
+}
+
+// timestamp + "\n" + nonce + "\n" + method + "\n" + target + "\n" + hex(SHA-256(body)), where target is
+// the path followed by "?" and CanonicalQuery of the query if there is one (a=1&b=x+y, never
+// b=x%20y&a=1). exported so callers (and scripts) sign requests exactly the way they're checked
+func SigningMessage(timestamp string, nonce string, method string, target string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	return []byte(timestamp + "\n" + nonce + "\n" + method + "\n" + target + "\n" + hex.EncodeToString(bodyHash[:]))
+}
+
+func Sign(key []byte, message []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
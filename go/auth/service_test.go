@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "test-service-key"
+
+func newHMACAuthenticator(t *testing.T) *ServiceAuthenticator {
+	t.Helper()
+	a, err := NewServiceAuthenticator([]string{"old-key", testKey}, ServiceAuthHMAC)
+	if err != nil {
+		t.Fatalf("NewServiceAuthenticator: %v", err)
+	}
+	return a
+}
+
+func signedRequest(method string, target string, body string, signedAt time.Time, nonce string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	message := SigningMessage(timestamp, nonce, method, signedTarget(r), []byte(body))
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(NonceHeader, nonce)
+	r.Header.Set(SignatureHeader, hex.EncodeToString(Sign([]byte(testKey), message)))
+	return r
+}
+
+func TestSigningMessage(t *testing.T) {
+	body := []byte(`{"limit":10}`)
+	bodyHash := sha256.Sum256(body)
+
+	got := string(SigningMessage("1700000000", "abc123", "POST", "/loadThoughts?tag=work", body))
+	want := "1700000000\nabc123\nPOST\n/loadThoughts?tag=work\n" + hex.EncodeToString(bodyHash[:])
+	if got != want {
+		t.Errorf("SigningMessage = %q, want %q", got, want)
+	}
+
+	// an empty body still hashes to the SHA-256 of nothing
+	got = string(SigningMessage("1700000000", "abc123", "GET", "/health", nil))
+	want = "1700000000\nabc123\nGET\n/health\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if got != want {
+		t.Errorf("SigningMessage = %q, want %q", got, want)
+	}
+}
+
+func TestSignedTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/loadThoughts", "/loadThoughts"},
+		{"/loadThoughts?limit=5&tag=work", "/loadThoughts?limit=5&tag=work"},
+		// keys sorted, repeated keys kept in order
+		{"/loadThoughts?tag=work&limit=5", "/loadThoughts?limit=5&tag=work"},
+		{"/loadThoughts?tag=b&tag=a", "/loadThoughts?tag=b&tag=a"},
+		// one encoding for spaces and reserved characters
+		{"/searchThoughts?q=a+b", "/searchThoughts?q=a+b"},
+		{"/searchThoughts?q=a%20b&tag=%23work", "/searchThoughts?q=a+b&tag=%23work"},
+		// unparseable queries are signed as sent
+		{"/loadThoughts?a=%zz", "/loadThoughts?a=%zz"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if got := signedTarget(r); got != tt.want {
+			t.Errorf("signedTarget(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSignature(t *testing.T) {
+	a := newHMACAuthenticator(t)
+
+	r := signedRequest(http.MethodPost, "/searchThoughts?tag=work", `{"query":"x"}`, time.Now(), "nonce-valid")
+	if err := a.Authenticate(r); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	// the handler still gets the whole body
+	body, err := io.ReadAll(r.Body)
+	if err != nil || string(body) != `{"query":"x"}` {
+		t.Errorf("body after Authenticate = %q, %v", body, err)
+	}
+}
+
+// API Gateway hands the Lambda decoded parameters, which it re-encodes; the signature still matches
+func TestCheckSignatureCanonicalQuery(t *testing.T) {
+	a := newHMACAuthenticator(t)
+
+	r := signedRequest(http.MethodGet, "/loadThoughts?tag=%23work&limit=5", "", time.Now(), "nonce-canonical")
+	r.URL.RawQuery = "limit=5&tag=%23work"
+	if err := a.Authenticate(r); err != nil {
+		t.Errorf("Authenticate = %v, want nil", err)
+	}
+}
+
+func TestCheckSignatureRejectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(r *http.Request)
+	}{
+		{"body", func(r *http.Request) {
+			r.Body = io.NopCloser(strings.NewReader(`{"query":"y"}`))
+		}},
+		{"query", func(r *http.Request) {
+			r.URL.RawQuery = "tag=home"
+		}},
+		{"path", func(r *http.Request) {
+			r.URL.Path = "/deleteThought"
+		}},
+		{"method", func(r *http.Request) {
+			r.Method = http.MethodPut
+		}},
+		{"nonce", func(r *http.Request) {
+			r.Header.Set(NonceHeader, "nonce-other")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newHMACAuthenticator(t)
+			r := signedRequest(http.MethodPost, "/searchThoughts?tag=work", `{"query":"x"}`, time.Now(), "nonce-"+tt.name)
+			tt.tamper(r)
+			if err := a.Authenticate(r); !errors.Is(err, ErrInvalidServiceCredentials) {
+				t.Errorf("Authenticate = %v, want %v", err, ErrInvalidServiceCredentials)
+			}
+		})
+	}
+}
+
+func TestCheckSignatureMissingHeaders(t *testing.T) {
+	for _, header := range []string{TimestampHeader, NonceHeader, SignatureHeader} {
+		a := newHMACAuthenticator(t)
+		r := signedRequest(http.MethodPost, "/loadThoughts", "{}", time.Now(), "nonce-"+header)
+		r.Header.Del(header)
+		if err := a.Authenticate(r); !errors.Is(err, ErrMissingServiceCredentials) {
+			t.Errorf("without %s: Authenticate = %v, want %v", header, err, ErrMissingServiceCredentials)
+		}
+	}
+}
+
+func TestCheckSignatureSkewWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset time.Duration
+		ok     bool
+	}{
+		{"now", 0, true},
+		{"inside past", -maxTimestampSkew + 30*time.Second, true},
+		{"inside future", maxTimestampSkew - 30*time.Second, true},
+		{"too old", -maxTimestampSkew - 30*time.Second, false},
+		{"too far ahead", maxTimestampSkew + 30*time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newHMACAuthenticator(t)
+			r := signedRequest(http.MethodPost, "/loadThoughts", "{}", time.Now().Add(tt.offset), "nonce-skew")
+			err := a.Authenticate(r)
+			if tt.ok && err != nil {
+				t.Errorf("Authenticate = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidServiceCredentials) {
+				t.Errorf("Authenticate = %v, want %v", err, ErrInvalidServiceCredentials)
+			}
+		})
+	}
+}
+
+func TestCheckSignatureReplay(t *testing.T) {
+	a := newHMACAuthenticator(t)
+	now := time.Now()
+
+	first := signedRequest(http.MethodPost, "/loadThoughts", "{}", now, "nonce-1")
+	if err := a.Authenticate(first); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	// the same request again, byte for byte
+	replay := signedRequest(http.MethodPost, "/loadThoughts", "{}", now, "nonce-1")
+	if err := a.Authenticate(replay); !errors.Is(err, ErrReplayedRequest) {
+		t.Errorf("replay: Authenticate = %v, want %v", err, ErrReplayedRequest)
+	}
+
+	// the same signature spelled in upper case decodes to the same bytes
+	upper := signedRequest(http.MethodPost, "/loadThoughts", "{}", now, "nonce-1")
+	upper.Header.Set(SignatureHeader, strings.ToUpper(upper.Header.Get(SignatureHeader)))
+	if err := a.Authenticate(upper); !errors.Is(err, ErrReplayedRequest) {
+		t.Errorf("upper case replay: Authenticate = %v, want %v", err, ErrReplayedRequest)
+	}
+
+	// a second legitimate request to the same path in the same second has its own nonce
+	second := signedRequest(http.MethodPost, "/loadThoughts", "{}", now, "nonce-2")
+	if err := a.Authenticate(second); err != nil {
+		t.Errorf("second request: Authenticate = %v, want nil", err)
+	}
+}
+
+func TestCheckSignatureAnyActiveKey(t *testing.T) {
+	a := newHMACAuthenticator(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/loadThoughts", strings.NewReader("{}"))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("old-key"))
+	mac.Write(SigningMessage(timestamp, "nonce-old", http.MethodPost, "/loadThoughts", []byte("{}")))
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(NonceHeader, "nonce-old")
+	r.Header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+
+	if err := a.Authenticate(r); err != nil {
+		t.Errorf("Authenticate with the old key = %v, want nil", err)
+	}
+}
@@ -0,0 +1,37 @@
+package events
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// event types, also the SSE event names sent by /events
+const (
+	ThoughtCreated   = "thought_created"
+	ThoughtEdited    = "thought_edited"
+	ThoughtDeleted   = "thought_deleted" // moved to the trash
+	ThoughtRestored  = "thought_restored"
+	ThoughtPinned    = "thought_pinned"
+	ThoughtUnpinned  = "thought_unpinned"
+	EmbeddingReady   = "embedding_ready"
+	ThoughtsImported = "thoughts_imported" // one per import rather than one per thought, clients reload
+)
+
+// Event says something happened to one of a user's thoughts; it carries IDs only, subscribers load the
+// thought themselves, which keeps it well under the 8000 byte NOTIFY payload limit
+type Event struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Type      string    `json:"type"`
+	ThoughtID uuid.UUID `json:"thought_id"` // uuid.Nil for ThoughtsImported
+}
+
+// PostgresBroker fans events out to every server instance with LISTEN/NOTIFY, MemoryBroker only
+// reaches subscribers in the same process (for the memory store)
+type Broker interface {
+	Publish(ctx context.Context, event Event) error
+
+	// events for userID from now on, until unsubscribe is called; the channel is closed early when the
+	// subscriber falls too far behind or the broker loses events, so the client should reload and resubscribe
+	Subscribe(userID uuid.UUID) (events <-chan Event, unsubscribe func())
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// events buffered per subscriber before it counts as too slow and is dropped
+const subscriberBuffer = 64
+
+// the subscribers in this process, shared by both brokers
+type hub struct {
+	mu   sync.Mutex
+	subs map[uuid.UUID]map[chan Event]struct{} // by user
+}
+
+func newHub() *hub {
+	return &hub{subs: make(map[uuid.UUID]map[chan Event]struct{})}
+}
+
+func (h *hub) subscribe(userID uuid.UUID) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan Event]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(userID, ch)
+	}
+}
+
+// never blocks; a subscriber whose buffer is full is closed rather than holding everyone else up
+func (h *hub) dispatch(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("[EVENTS] Dropping slow subscriber for user %s", event.UserID)
+			h.remove(event.UserID, ch)
+		}
+	}
+}
+
+// after events may have been missed, every subscriber has to start over
+func (h *hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for userID, chans := range h.subs {
+		for ch := range chans {
+			h.remove(userID, ch)
+		}
+	}
+}
+
+// callers must hold the lock; removing twice is a no-op
+func (h *hub) remove(userID uuid.UUID, ch chan Event) {
+	if _, ok := h.subs[userID][ch]; !ok {
+		return
+	}
+	delete(h.subs[userID], ch)
+	close(ch)
+	if len(h.subs[userID]) == 0 {
+		delete(h.subs, userID)
+	}
+}
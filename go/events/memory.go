@@ -0,0 +1,25 @@
+package events
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// MemoryBroker delivers events to subscribers in the same process only
+type MemoryBroker struct {
+	hub *hub
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{hub: newHub()}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, event Event) error {
+	b.hub.dispatch(event)
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(userID uuid.UUID) (<-chan Event, func()) {
+	return b.hub.subscribe(userID)
+}
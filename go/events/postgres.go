@@ -0,0 +1,106 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	notifyChannel    = "thought_events"
+	listenRetryDelay = 5 * time.Second
+)
+
+// PostgresBroker publishes with pg_notify on the pool, and every instance that called Start keeps one
+// connection LISTENing and hands what arrives to its own subscribers
+// publishing works from Lambda too, so the embedding worker's events reach the server's streams
+type PostgresBroker struct {
+	pool         *pgxpool.Pool
+	listenConfig *pgx.ConnConfig
+	hub          *hub
+}
+
+// listenURL needs a session connection: Supabase's transaction pooler doesn't keep LISTEN registrations
+func NewPostgresBroker(pool *pgxpool.Pool, listenURL string) (*PostgresBroker, error) {
+	listenConfig, err := pgx.ParseConfig(listenURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse events database URL: %w", err)
+	}
+
+	return &PostgresBroker{
+		pool:         pool,
+		listenConfig: listenConfig,
+		hub:          newHub(),
+	}, nil
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if _, err := b.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+func (b *PostgresBroker) Subscribe(userID uuid.UUID) (<-chan Event, func()) {
+	return b.hub.subscribe(userID)
+}
+
+// listens until ctx is cancelled, reconnecting whenever the connection drops
+func (b *PostgresBroker) Start(ctx context.Context) {
+	go func() {
+		for {
+			err := b.listen(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			// notifications sent while we were disconnected are gone
+			log.Printf("[EVENTS] Lost LISTEN connection, reconnecting in %v: %v", listenRetryDelay, err)
+			b.hub.closeAll()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(listenRetryDelay):
+			}
+		}
+	}()
+}
+
+func (b *PostgresBroker) listen(ctx context.Context) error {
+	conn, err := pgx.ConnectConfig(ctx, b.listenConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+	log.Printf("[EVENTS] Listening for %s notifications", notifyChannel)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Printf("[EVENTS] Ignoring malformed notification: %v", err)
+			continue
+		}
+		b.hub.dispatch(event)
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+// how many hybrid search results are handed to Gemini as context
+const askContextThoughts = 12
+
+const askInstructions = `You answer questions about the user's own notes, called thoughts.
+Use only the thoughts provided in the prompt; do not use outside knowledge or make things up.
+If the thoughts don't contain enough information to answer, say so briefly.
+Write the answer in second person ("you wrote...") and keep it concise.
+Respond with a JSON object of the form {"answer": string, "cited_thought_ids": [string]},
+where cited_thought_ids lists the id of every thought the answer relies on.`
+
+const noRelevantThoughtsAnswer = "I couldn't find any thoughts related to that."
+
+func (h *Handler) askThoughts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.generator == nil {
+		http.Error(w, "Answer generation is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var request types.AskThoughtsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	question := string(request.Question)
+	if question == "" {
+		http.Error(w, "Question cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[ASK] Answering question for user %s: %s", userID, question)
+
+	// retrieve relevant thoughts through the same path as searchThoughts
+	results, err := h.hybridSearch(r.Context(), userID, question, "", askContextThoughts)
+	if err != nil {
+		log.Printf("Error searching thoughts: %v", err)
+		http.Error(w, "Failed to search thoughts", http.StatusInternalServerError)
+		return
+	}
+
+	response := types.AskThoughtsResponse{
+		Answer:          noRelevantThoughtsAnswer,
+		CitedThoughtIDs: []uuid.UUID{},
+		Sources:         []types.Thought{},
+	}
+
+	if len(results) > 0 {
+		// build prompt with each thought's id so Gemini can cite it
+		var prompt strings.Builder
+		prompt.WriteString("Thoughts:\n")
+		for _, result := range results {
+			fmt.Fprintf(&prompt, "- id: %s\n  created_at: %s\n  text: %s\n", result.Thought.ID, result.Thought.Created, result.Thought.Thought)
+		}
+		fmt.Fprintf(&prompt, "\nQuestion: %s\n", question)
+
+		var generated struct {
+			Answer          string   `json:"answer"`
+			CitedThoughtIDs []string `json:"cited_thought_ids"`
+		}
+		if err := h.generator.GenerateJSON(r.Context(), askInstructions, prompt.String(), &generated); err != nil {
+			log.Printf("Error generating answer: %v", err)
+			http.Error(w, "Failed to generate answer", http.StatusInternalServerError)
+			return
+		}
+
+		// only keep citations that point at thoughts we actually gave the model
+		retrieved := make(map[uuid.UUID]types.Thought, len(results))
+		for _, result := range results {
+			retrieved[result.Thought.ID] = result.Thought
+		}
+
+		seen := make(map[uuid.UUID]bool)
+		for _, idStr := range generated.CitedThoughtIDs {
+			id, err := uuid.Parse(idStr)
+			if err != nil || seen[id] {
+				continue
+			}
+			thought, ok := retrieved[id]
+			if !ok {
+				log.Printf("[ASK] Dropping citation of unknown thought %s", idStr)
+				continue
+			}
+			seen[id] = true
+			response.CitedThoughtIDs = append(response.CitedThoughtIDs, id)
+			response.Sources = append(response.Sources, thought)
+		}
+
+		h.signAttachments(r.Context(), response.Sources)
+		response.Answer = generated.Answer
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
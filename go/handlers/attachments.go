@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+// thoughts come out of the store with attachment keys only; responses add presigned URLs that work
+// for attachmentURLExpiry. an attachment that can't be signed is sent without a URL rather than
+// failing the whole response
+func (h *Handler) signAttachments(ctx context.Context, thoughts []types.Thought) {
+	for i := range thoughts {
+		h.signThought(ctx, &thoughts[i])
+	}
+}
+
+func (h *Handler) signThought(ctx context.Context, thought *types.Thought) {
+	if thought == nil {
+		return
+	}
+
+	for i := range thought.Attachments {
+		a := &thought.Attachments[i]
+		url, err := h.blobs.PresignGet(ctx, a.Key, h.attachmentURLExpiry)
+		if err != nil {
+			log.Printf("Error signing attachment %s of thought %s: %v", a.Key, thought.ID, err)
+			continue
+		}
+		a.URL = url
+
+		for j := range a.Thumbnails {
+			t := &a.Thumbnails[j]
+			url, err := h.blobs.PresignGet(ctx, t.Key, h.attachmentURLExpiry)
+			if err != nil {
+				log.Printf("Error signing thumbnail %s of thought %s: %v", t.Key, thought.ID, err)
+				continue
+			}
+			t.URL = url
+		}
+	}
+}
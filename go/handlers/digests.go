@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata" // request timezones have to resolve in Lambda, which has no zoneinfo
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/stores"
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+const (
+	digestMaxThoughts  = 200 // thoughts per digest, the earliest ones in the period win
+	digestThoughtChars = 500 // each thought is truncated to this many characters in the prompt
+	digestMinThoughts  = 3   // scheduled digests skip users with fewer thoughts in the period
+	digestUsersPerRun  = 10  // users per period per scheduled run
+	digestListDefault  = 20  // digests returned when the request doesn't set a limit
+	digestListMax      = 100 // most digests a single request can ask for
+)
+
+const digestInstructions = `You summarize the user's own notes, called thoughts, from one day or one week.
+Use only the thoughts provided in the prompt; do not use outside knowledge or make things up.
+Write in second person ("you were thinking about...") and keep every item short.
+themes are the main things the user was thinking about, each with a short title and a one or two sentence summary.
+open_questions are questions the user raised or left unresolved.
+action_items are things the user said they want or need to do.
+Any list may be empty. Every item lists the ids of the thoughts it is based on.
+Respond with a JSON object of the form
+{"themes": [{"title": string, "summary": string, "thought_ids": [string]}],
+ "open_questions": [{"text": string, "thought_ids": [string]}],
+ "action_items": [{"text": string, "thought_ids": [string]}]}.`
+
+func (h *Handler) listDigests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// every parameter is optional, so an empty body is fine
+	var request types.ListDigestsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	limit := request.Limit
+	if limit == 0 {
+		limit = digestListDefault
+	}
+	if limit < 1 || limit > digestListMax {
+		http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[DIGESTS] Listing %q digests for user %s", request.Period, userID)
+
+	digests, err := h.store.ListDigests(r.Context(), userID, string(request.Period), limit)
+	if err != nil {
+		log.Printf("Error listing digests: %v", err)
+		http.Error(w, "Failed to list digests", http.StatusInternalServerError)
+		return
+	}
+
+	if digests == nil {
+		digests = []types.Digest{}
+	}
+
+	response := types.ListDigestsResponse{
+		Digests: digests,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// on-demand digest for the day or week containing the requested date, replacing any earlier one
+func (h *Handler) generateDigest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.generator == nil {
+		http.Error(w, "Digest generation is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var request types.GenerateDigestRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if request.Period == "" {
+		http.Error(w, "period is required", http.StatusBadRequest)
+		return
+	}
+
+	loc := time.UTC
+	if request.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(request.Timezone)
+		if err != nil {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+	}
+
+	date := time.Now().In(loc)
+	if request.Date != "" {
+		var err error
+		date, err = time.ParseInLocation(time.DateOnly, request.Date, loc)
+		if err != nil {
+			http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	period := string(request.Period)
+	start, end := digestWindow(period, date)
+
+	log.Printf("[DIGESTS] Generating %s digest for user %s from %s to %s", period, userID, start, end)
+
+	digest, err := h.buildDigest(r.Context(), userID, period, start, end)
+	if err != nil {
+		log.Printf("Error generating digest: %v", err)
+		http.Error(w, "Failed to generate digest", http.StatusInternalServerError)
+		return
+	}
+	if digest == nil {
+		http.Error(w, "No thoughts in this period", http.StatusNotFound)
+		return
+	}
+
+	response := types.GenerateDigestResponse{
+		Digest: digest,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// scheduled task: digests for the previous UTC day and ISO week, for users who don't have them yet
+// skipped without a generator; one user failing doesn't stop the others
+func (h *Handler) generateDigests(ctx context.Context) error {
+	if h.generator == nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	var errs []error
+	for _, period := range []string{stores.DigestDay, stores.DigestWeek} {
+		current, _ := digestWindow(period, now)
+		start, end := digestWindow(period, current.Add(-time.Second))
+
+		userIDs, err := h.store.ListDigestCandidates(ctx, period, start, end, digestMinThoughts, digestUsersPerRun)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list %s digest candidates: %w", period, err))
+			continue
+		}
+
+		failed := 0
+		for _, userID := range userIDs {
+			if _, err := h.buildDigest(ctx, userID, period, start, end); err != nil {
+				log.Printf("[DIGESTS] Error generating %s digest for user %s: %v", period, userID, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			errs = append(errs, fmt.Errorf("failed to generate %s digests for %d of %d user(s)", period, failed, len(userIDs)))
+		}
+		if len(userIDs) > 0 {
+			log.Printf("[DIGESTS] Generated %d %s digest(s) for %s", len(userIDs)-failed, period, start.Format(time.DateOnly))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// summarizes the user's thoughts in [start, end) and saves the digest; nil if there were no thoughts
+func (h *Handler) buildDigest(ctx context.Context, userID uuid.UUID, period string, start time.Time, end time.Time) (*types.Digest, error) {
+	thoughts, err := h.store.ListThoughtsBetween(ctx, userID, start, end, digestMaxThoughts)
+	if err != nil {
+		return nil, err
+	}
+	if len(thoughts) == 0 {
+		return nil, nil
+	}
+
+	// build prompt with each thought's id so Gemini can reference it
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Period: %s starting %s\n\nThoughts:\n", period, start.Format(time.DateOnly))
+	for _, t := range thoughts {
+		fmt.Fprintf(&prompt, "- id: %s\n  created_at: %s\n  text: %s\n", t.ID, t.Created, truncateText(t.Thought, digestThoughtChars))
+	}
+
+	var generated struct {
+		Themes []struct {
+			Title      string   `json:"title"`
+			Summary    string   `json:"summary"`
+			ThoughtIDs []string `json:"thought_ids"`
+		} `json:"themes"`
+		OpenQuestions []generatedDigestItem `json:"open_questions"`
+		ActionItems   []generatedDigestItem `json:"action_items"`
+	}
+	if err := h.generator.GenerateJSON(ctx, digestInstructions, prompt.String(), &generated); err != nil {
+		return nil, fmt.Errorf("failed to generate digest: %w", err)
+	}
+
+	// only keep references to thoughts we actually gave the model
+	known := make(map[uuid.UUID]bool, len(thoughts))
+	digest := types.Digest{
+		Period:           period,
+		PeriodStart:      start.UTC().Format(time.RFC3339Nano),
+		PeriodEnd:        end.UTC().Format(time.RFC3339Nano),
+		Themes:           []types.DigestTheme{},
+		SourceThoughtIDs: make([]uuid.UUID, 0, len(thoughts)),
+	}
+	for _, t := range thoughts {
+		known[t.ID] = true
+		digest.SourceThoughtIDs = append(digest.SourceThoughtIDs, t.ID)
+	}
+
+	for _, theme := range generated.Themes {
+		if strings.TrimSpace(theme.Title) == "" {
+			continue
+		}
+		digest.Themes = append(digest.Themes, types.DigestTheme{
+			Title:      strings.TrimSpace(theme.Title),
+			Summary:    strings.TrimSpace(theme.Summary),
+			ThoughtIDs: knownThoughtIDs(theme.ThoughtIDs, known),
+		})
+	}
+	digest.OpenQuestions = digestItems(generated.OpenQuestions, known)
+	digest.ActionItems = digestItems(generated.ActionItems, known)
+
+	return h.store.SaveDigest(ctx, userID, digest)
+}
+
+type generatedDigestItem struct {
+	Text       string   `json:"text"`
+	ThoughtIDs []string `json:"thought_ids"`
+}
+
+func digestItems(generated []generatedDigestItem, known map[uuid.UUID]bool) []types.DigestItem {
+	items := []types.DigestItem{}
+	for _, item := range generated {
+		if strings.TrimSpace(item.Text) == "" {
+			continue
+		}
+		items = append(items, types.DigestItem{
+			Text:       strings.TrimSpace(item.Text),
+			ThoughtIDs: knownThoughtIDs(item.ThoughtIDs, known),
+		})
+	}
+	return items
+}
+
+// parsed, deduplicated ids that are in known, in the model's order
+func knownThoughtIDs(ids []string, known map[uuid.UUID]bool) []uuid.UUID {
+	res := []uuid.UUID{}
+	seen := make(map[uuid.UUID]bool)
+	for _, idStr := range ids {
+		id, err := uuid.Parse(idStr)
+		if err != nil || !known[id] || seen[id] {
+			continue
+		}
+		seen[id] = true
+		res = append(res, id)
+	}
+	return res
+}
+
+// the day, or ISO week (Monday to Monday), containing t in t's location
+func digestWindow(period string, t time.Time) (time.Time, time.Time) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if period == stores.DigestWeek {
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	}
+	return day, day.AddDate(0, 0, 1)
+}
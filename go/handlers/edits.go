@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/skarokin/runsynapse/go/events"
+	"github.com/skarokin/runsynapse/go/queues"
+	"github.com/skarokin/runsynapse/go/stores"
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+// edits keep the thought's ID, pin and attachments; the old text is kept as a version
+func (h *Handler) editThought(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request types.EditThoughtRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	thoughtID, ok := parseThoughtID(w, request.ThoughtID)
+	if !ok {
+		return
+	}
+
+	if strings.TrimSpace(request.Thought) == "" {
+		http.Error(w, "thought is required", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[EDIT_THOUGHT] Editing thought %s for user %s", thoughtID, userID)
+
+	edited, err := h.store.EditThought(r.Context(), userID, thoughtID, request.Thought)
+	if errors.Is(err, stores.ErrThoughtNotFound) {
+		http.Error(w, "Thought not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error editing thought: %v", err)
+		http.Error(w, "Failed to edit thought", http.StatusInternalServerError)
+		return
+	}
+
+	// same path as newThought; an unchanged edit comes back already embedded and needs no job
+	if edited.EmbeddingStatus == stores.EmbeddingPending {
+		job := queues.EmbeddingJob{UserID: userID, ThoughtID: edited.ID}
+		if err := h.embeddingQueue.Enqueue(r.Context(), job); err != nil {
+			log.Printf("Error enqueueing embedding job for thought %s: %v", edited.ID, err)
+		}
+	}
+
+	h.publish(r.Context(), userID, events.ThoughtEdited, edited.ID)
+
+	h.signThought(r.Context(), edited)
+
+	response := types.EditThoughtResponse{
+		Thought: *edited,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) listThoughtVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request types.ListThoughtVersionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	thoughtID, ok := parseThoughtID(w, request.ThoughtID)
+	if !ok {
+		return
+	}
+
+	versions, err := h.store.ListThoughtVersions(r.Context(), userID, thoughtID)
+	if errors.Is(err, stores.ErrThoughtNotFound) {
+		http.Error(w, "Thought not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing thought versions: %v", err)
+		http.Error(w, "Failed to list thought versions", http.StatusInternalServerError)
+		return
+	}
+
+	// always an array, a thought that was never edited has no versions
+	if versions == nil {
+		versions = []types.ThoughtVersion{}
+	}
+
+	response := types.ThoughtVersionsResponse{
+		Versions: versions,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
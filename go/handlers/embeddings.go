@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/skarokin/runsynapse/go/events"
+	"github.com/skarokin/runsynapse/go/queues"
+	"github.com/skarokin/runsynapse/go/stores"
+)
+
+const (
+	maxEmbeddingAttempts = 5
+
+	// pending thoughts older than this are assumed to have lost their job and get re-enqueued
+	pendingEmbeddingGrace = 5 * time.Minute
+	pendingEmbeddingBatch = 100
+)
+
+// embedding worker: called by the local queue or the SQS-triggered Lambda
+// returns an error when the job should be retried
+func (h *Handler) ProcessEmbeddingJob(ctx context.Context, job queues.EmbeddingJob) error {
+	thought, err := h.store.GetThought(ctx, job.UserID, job.ThoughtID)
+	if errors.Is(err, stores.ErrThoughtNotFound) {
+		// a trashed thought is embedded by the re-enqueue sweep if it's restored
+		log.Printf("[EMBEDDING_WORKER] Thought %s no longer exists or is in the trash, skipping", job.ThoughtID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load thought %s: %w", job.ThoughtID, err)
+	}
+
+	embedding, err := h.embedder.EmbedThought(ctx, thought.Thought)
+	if err == nil {
+		err = h.store.SetEmbedding(ctx, job.ThoughtID, thought.Thought, embedding)
+		if errors.Is(err, stores.ErrThoughtNotFound) {
+			return nil
+		}
+		// edited while we were embedding; the edit enqueued its own job for the new text
+		if errors.Is(err, stores.ErrThoughtChanged) {
+			log.Printf("[EMBEDDING_WORKER] Thought %s was edited during embedding, discarding result", job.ThoughtID)
+			return nil
+		}
+	}
+	if err == nil {
+		log.Printf("[EMBEDDING_WORKER] Embedded thought %s", job.ThoughtID)
+		h.publish(ctx, job.UserID, events.EmbeddingReady, job.ThoughtID)
+		return nil
+	}
+
+	status, markErr := h.store.MarkEmbeddingFailed(ctx, job.ThoughtID, err.Error(), maxEmbeddingAttempts)
+	if markErr != nil {
+		log.Printf("[EMBEDDING_WORKER] Error recording failed attempt for thought %s: %v", job.ThoughtID, markErr)
+		return fmt.Errorf("failed to embed thought %s: %w", job.ThoughtID, err)
+	}
+
+	// out of attempts; the thought stays searchable by full-text, no point retrying further
+	if status == stores.EmbeddingFailed {
+		log.Printf("[EMBEDDING_WORKER] Giving up on thought %s after %d attempts: %v", job.ThoughtID, maxEmbeddingAttempts, err)
+		return nil
+	}
+
+	return fmt.Errorf("failed to embed thought %s: %w", job.ThoughtID, err)
+}
+
+// re-enqueues thoughts whose job was lost (enqueue failed, process restarted, message expired)
+func (h *Handler) requeuePendingEmbeddings(ctx context.Context) error {
+	pending, err := h.store.ListPendingEmbeddings(ctx, pendingEmbeddingGrace, pendingEmbeddingBatch)
+	if err != nil {
+		return fmt.Errorf("failed to list pending embeddings: %w", err)
+	}
+
+	for _, p := range pending {
+		job := queues.EmbeddingJob{UserID: p.UserID, ThoughtID: p.ThoughtID}
+		if err := h.embeddingQueue.Enqueue(ctx, job); err != nil {
+			return fmt.Errorf("failed to re-enqueue thought %s: %w", p.ThoughtID, err)
+		}
+	}
+
+	if len(pending) > 0 {
+		log.Printf("[EMBEDDING_WORKER] Re-enqueued %d pending thought(s)", len(pending))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/events"
+	"github.com/skarokin/runsynapse/go/stores"
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+// comment lines sent this often keep proxies and load balancers from closing an idle stream
+const eventsHeartbeatInterval = 25 * time.Second
+
+// Server-Sent Events stream of the user's thought events (see events package for the types), each
+// with the thought as it is now so other devices can update without reloading. the stream ends when
+// the client falls behind or the broker may have missed events; clients should reload on reconnect
+// a GET, unlike the other routes, since that's what SSE clients send; browsers need fetch() rather
+// than EventSource to set the Authorization header
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("[EVENTS] Streaming events for user:", userID)
+
+	subscription, unsubscribe := h.events.Subscribe(userID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would buffer the stream otherwise
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-subscription:
+			if !ok {
+				log.Println("[EVENTS] Subscription closed, ending stream for user:", userID)
+				return
+			}
+			data, ok := h.eventData(r.Context(), event)
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// the event as sent to the client, with the thought loaded; false if it should be skipped (the
+// thought is gone again or in the trash, a later event will say so)
+func (h *Handler) eventData(ctx context.Context, event events.Event) ([]byte, bool) {
+	data := types.ThoughtEvent{Type: event.Type}
+
+	if event.ThoughtID != uuid.Nil {
+		data.ThoughtID = &event.ThoughtID
+	}
+
+	if event.ThoughtID != uuid.Nil && event.Type != events.ThoughtDeleted {
+		thought, err := h.store.GetThought(ctx, event.UserID, event.ThoughtID)
+		if errors.Is(err, stores.ErrThoughtNotFound) {
+			return nil, false
+		}
+		if err != nil {
+			log.Printf("[EVENTS] Error loading thought %s for event: %v", event.ThoughtID, err)
+			return nil, false
+		}
+		h.signThought(ctx, thought)
+		data.Thought = thought
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding event: %v", err)
+		return nil, false
+	}
+	return encoded, true
+}
+
+// events are best effort: the change already happened, so a failed publish is only logged
+func (h *Handler) publish(ctx context.Context, userID uuid.UUID, eventType string, thoughtID uuid.UUID) {
+	event := events.Event{UserID: userID, Type: eventType, ThoughtID: thoughtID}
+	if err := h.events.Publish(ctx, event); err != nil {
+		log.Printf("[EVENTS] Error publishing %s for thought %s: %v", eventType, thoughtID, err)
+	}
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+const (
+	exportKeyPrefix      = "exports/" // blob keys of spooled exports; expire these with a bucket lifecycle rule
+	exportThoughtsFile   = "thoughts.jsonl"
+	exportAttachmentsDir = "attachments/"
+	exportMissingFile    = "missing_attachments.txt"
+)
+
+var exportContentTypes = map[string]string{
+	"jsonl": "application/x-ndjson",
+	"zip":   "application/zip",
+}
+
+// streams every thought outside the trash as JSON Lines, or a zip bundle of thoughts.jsonl plus the
+// attachment bytes; in Lambda the export is spooled to a temp file and uploaded instead, and the
+// response is a URL to download it from
+func (h *Handler) exportThoughts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// format is optional, so an empty body is fine
+	var request types.ExportThoughtsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	format := string(request.Format)
+	if format == "" {
+		format = "jsonl"
+	}
+
+	log.Printf("[EXPORT] Exporting thoughts for user %s as %s", userID, format)
+
+	if h.spoolExports {
+		h.spoolExport(r.Context(), w, userID, format)
+		return
+	}
+
+	filename := fmt.Sprintf("runsynapse-%s.%s", time.Now().UTC().Format("20060102"), format)
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	cw := &countingWriter{w: w}
+	count, err := h.writeExport(r.Context(), cw, userID, format)
+	if err != nil {
+		log.Printf("Error exporting thoughts: %v", err)
+		// once the body has started the status is already sent, the client gets a truncated file
+		if cw.n == 0 {
+			http.Error(w, "Failed to export thoughts", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("[EXPORT] Exported %d thought(s) for user %s", count, userID)
+}
+
+func (h *Handler) spoolExport(ctx context.Context, w http.ResponseWriter, userID uuid.UUID, format string) {
+	tmp, err := os.CreateTemp("", "export-*."+format)
+	if err != nil {
+		log.Printf("Error creating export file: %v", err)
+		http.Error(w, "Failed to export thoughts", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	count, err := h.writeExport(ctx, tmp, userID, format)
+	if err != nil {
+		log.Printf("Error exporting thoughts: %v", err)
+		http.Error(w, "Failed to export thoughts", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		log.Printf("Error rewinding export file: %v", err)
+		http.Error(w, "Failed to export thoughts", http.StatusInternalServerError)
+		return
+	}
+
+	// random so the URL can't be guessed from the user ID
+	key := fmt.Sprintf("%s%s/%s.%s", exportKeyPrefix, userID, uuid.NewString(), format)
+	if err := h.blobs.Put(ctx, key, tmp, exportContentTypes[format]); err != nil {
+		log.Printf("Error uploading export: %v", err)
+		http.Error(w, "Failed to upload export", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[EXPORT] Uploaded export of %d thought(s) for user %s to %s", count, userID, key)
+
+	url, err := h.blobs.PresignGet(ctx, key, h.attachmentURLExpiry)
+	if err != nil {
+		log.Printf("Error signing export URL: %v", err)
+		http.Error(w, "Failed to upload export", http.StatusInternalServerError)
+		return
+	}
+
+	response := types.ExportThoughtsResponse{
+		URL:          url,
+		Format:       format,
+		ThoughtCount: count,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// writes the export to out and returns how many thoughts it contains
+func (h *Handler) writeExport(ctx context.Context, out io.Writer, userID uuid.UUID, format string) (int, error) {
+	count := 0
+
+	if format == "jsonl" {
+		enc := json.NewEncoder(out)
+		err := h.store.ExportThoughts(ctx, userID, func(t types.Thought) error {
+			count++
+			return enc.Encode(h.exportedThought(ctx, t, false))
+		})
+		return count, err
+	}
+
+	// zip entries are written one at a time, so thoughts.jsonl goes first and only the attachment
+	// paths are remembered for the second pass
+	zw := zip.NewWriter(out)
+
+	thoughtsFile, err := createZipEntry(zw, exportThoughtsFile, zip.Deflate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", exportThoughtsFile, err)
+	}
+
+	var attachments []types.ExportedAttachment
+	enc := json.NewEncoder(thoughtsFile)
+	err = h.store.ExportThoughts(ctx, userID, func(t types.Thought) error {
+		count++
+		exported := h.exportedThought(ctx, t, true)
+		attachments = append(attachments, exported.Attachments...)
+		return enc.Encode(exported)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	// a missing attachment shouldn't fail the whole backup, it's listed in missing_attachments.txt instead
+	var missing []string
+	written := make(map[string]bool)
+	for _, a := range attachments {
+		if written[a.Path] {
+			continue
+		}
+		written[a.Path] = true
+
+		if err := h.copyAttachment(ctx, zw, a); err != nil {
+			if ctx.Err() != nil {
+				return count, ctx.Err()
+			}
+			log.Printf("[EXPORT] Error adding attachment %s: %v", a.Key, err)
+			missing = append(missing, a.Key)
+		}
+	}
+
+	if len(missing) > 0 {
+		missingFile, err := createZipEntry(zw, exportMissingFile, zip.Deflate)
+		if err != nil {
+			return count, fmt.Errorf("failed to create %s: %w", exportMissingFile, err)
+		}
+		if _, err := io.WriteString(missingFile, strings.Join(missing, "\n")+"\n"); err != nil {
+			return count, fmt.Errorf("failed to write %s: %w", exportMissingFile, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return count, fmt.Errorf("failed to finish zip: %w", err)
+	}
+	return count, nil
+}
+
+func (h *Handler) copyAttachment(ctx context.Context, zw *zip.Writer, a types.ExportedAttachment) error {
+	body, err := h.blobs.Get(ctx, a.Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// most attachments are already compressed (images, audio, video), so they're stored as is
+	entry, err := createZipEntry(zw, a.Path, zip.Store)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, body)
+	return err
+}
+
+func createZipEntry(zw *zip.Writer, name string, method uint16) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: time.Now(),
+	})
+}
+
+// attachment URLs are presigned like in every other response, so they stop working after a while;
+// zip bundles carry the bytes themselves
+func (h *Handler) exportedThought(ctx context.Context, t types.Thought, withPaths bool) types.ExportedThought {
+	exported := types.ExportedThought{
+		ID:          t.ID,
+		Thought:     t.Thought,
+		Pinned:      t.Pinned,
+		Created:     t.Created,
+		EditedAt:    t.EditedAt,
+		Tags:        t.Tags,
+		TopicID:     t.TopicID,
+		Attachments: []types.ExportedAttachment{},
+	}
+	if exported.Tags == nil {
+		exported.Tags = []string{}
+	}
+
+	for _, attachment := range t.Attachments {
+		url, err := h.blobs.PresignGet(ctx, attachment.Key, h.attachmentURLExpiry)
+		if err != nil {
+			log.Printf("[EXPORT] Error signing attachment %s: %v", attachment.Key, err)
+		}
+		a := types.ExportedAttachment{
+			Key:         attachment.Key,
+			FileName:    attachment.FileName,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+			SHA256:      attachment.SHA256,
+			URL:         url,
+		}
+		// keys are unique where file names aren't
+		if withPaths {
+			a.Path = exportAttachmentsDir + a.Key
+		}
+		exported.Attachments = append(exported.Attachments, a)
+	}
+
+	return exported
+}
+
+// lets exportThoughts tell whether anything reached the client before an error
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -2,28 +2,66 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
-    "google.golang.org/genai"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/skarokin/runsynapse/go/auth"
+	"github.com/skarokin/runsynapse/go/events"
+	"github.com/skarokin/runsynapse/go/queues"
+	"github.com/skarokin/runsynapse/go/stores"
+	"github.com/skarokin/runsynapse/go/utils"
 )
 
 type Handler struct {
-	supabaseClient *pgxpool.Pool
-	geminiClient   *genai.Client
-	s3Client 	   *s3.Client
-	s3Bucket       string
-	mux            *http.ServeMux
+	store               stores.ThoughtStore
+	embedder            utils.Embedder
+	generator           utils.Generator // nil when no Gemini API key is configured
+	blobs               utils.BlobStore
+	embeddingQueue      queues.EmbeddingQueue
+	events              events.Broker
+	searchFusion        utils.FusionConfig
+	trashRetention      time.Duration
+	attachmentURLExpiry time.Duration
+	jwtVerifier         *auth.JWTVerifier
+	serviceAuth         *auth.ServiceAuthenticator
+	authDevBypass       bool
+	spoolExports        bool
+	mux                 *http.ServeMux
+}
+
+// everything a Handler depends on, built in main.go
+type Config struct {
+	Store               stores.ThoughtStore
+	Embedder            utils.Embedder
+	Generator           utils.Generator // nil when no Gemini API key is configured
+	Blobs               utils.BlobStore
+	EmbeddingQueue      queues.EmbeddingQueue
+	Events              events.Broker
+	SearchFusion        utils.FusionConfig
+	TrashRetention      time.Duration              // how long deleted thoughts stay restorable
+	AttachmentURLExpiry time.Duration              // how long the attachment URLs in responses work
+	JWTVerifier         *auth.JWTVerifier          // may be nil only when AuthDevBypass is set
+	ServiceAuth         *auth.ServiceAuthenticator // may be nil only when AuthDevBypass is set
+	AuthDevBypass       bool                       // skip service credentials and accept X-Dev-User-ID (development only)
+	SpoolExports        bool                       // write exports to the blob store and return a URL instead of streaming (Lambda)
 }
 
 // upon registering a new handler, setup routes
-func NewHandler(supabase *pgxpool.Pool, gemini *genai.Client, s3 *s3.Client, s3Bucket string) *Handler {
+func NewHandler(cfg Config) *Handler {
 	h := &Handler{
-		supabaseClient: supabase,
-		geminiClient:   gemini,
-		s3Client: 	 	s3,
-		s3Bucket:       s3Bucket,
-		mux:            http.NewServeMux(),
+		store:               cfg.Store,
+		embedder:            cfg.Embedder,
+		generator:           cfg.Generator,
+		blobs:               cfg.Blobs,
+		embeddingQueue:      cfg.EmbeddingQueue,
+		events:              cfg.Events,
+		searchFusion:        cfg.SearchFusion,
+		trashRetention:      cfg.TrashRetention,
+		attachmentURLExpiry: cfg.AttachmentURLExpiry,
+		jwtVerifier:         cfg.JWTVerifier,
+		serviceAuth:         cfg.ServiceAuth,
+		authDevBypass:       cfg.AuthDevBypass,
+		spoolExports:        cfg.SpoolExports,
+		mux:                 http.NewServeMux(),
 	}
 	h.setupRoutes()
 	return h
@@ -35,12 +73,29 @@ func (h *Handler) setupRoutes() {
 	h.mux.HandleFunc("/loadThoughts", h.loadThoughts)
 	h.mux.HandleFunc("/pinThought", h.pinThought)
 	h.mux.HandleFunc("/unpinThought", h.unpinThought)
+	h.mux.HandleFunc("/gotoPin", h.gotoPin)
 	h.mux.HandleFunc("/searchThoughts", h.searchThoughts)
+	h.mux.HandleFunc("/listTags", h.listTags)
+	h.mux.HandleFunc("/relatedThoughts", h.relatedThoughts)
+	h.mux.HandleFunc("/topics", h.listTopics)
+	h.mux.HandleFunc("/digests", h.listDigests)
+	h.mux.HandleFunc("/generateDigest", h.generateDigest)
+	h.mux.HandleFunc("/exportThoughts", h.exportThoughts)
+	h.mux.HandleFunc("/importDiscord", h.importDiscord)
+	h.mux.HandleFunc("/importObsidian", h.importObsidian)
+	h.mux.HandleFunc("/askThoughts", h.askThoughts)
+	h.mux.HandleFunc("/editThought", h.editThought)
+	h.mux.HandleFunc("/listThoughtVersions", h.listThoughtVersions)
 	h.mux.HandleFunc("/deleteThought", h.deleteThought)
+	h.mux.HandleFunc("/restoreThought", h.restoreThought)
+	h.mux.HandleFunc("/listTrash", h.listTrash)
+	h.mux.HandleFunc("/createUploadURLs", h.createUploadURLs)
 	h.mux.HandleFunc("/newThought", h.newThought)
+	h.mux.HandleFunc("/events", h.streamEvents)
 	h.mux.HandleFunc("/health", h.healthCheck)
-}
 
-func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.mux.ServeHTTP(w, r)
-}
\ No newline at end of file
+	// local blob store serves its own files (development only, S3 serves them in production)
+	if blobServer, ok := h.blobs.(http.Handler); ok {
+		h.mux.Handle(utils.LocalBlobPrefix, blobServer)
+	}
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/events"
+	"github.com/skarokin/runsynapse/go/importers"
+	"github.com/skarokin/runsynapse/go/queues"
+	"github.com/skarokin/runsynapse/go/stores"
+	"github.com/skarokin/runsynapse/go/types"
+	"github.com/skarokin/runsynapse/go/utils"
+)
+
+const (
+	importBatchSize   = 50        // items embedded together and reported on per progress line; Gemini takes up to 100
+	importMaxFileSize = 100 << 20 // largest export or vault accepted over HTTP, bigger ones go through the CLI
+)
+
+// imports a DiscordChatExporter JSON export sent as the request body, streaming progress as JSON Lines
+// attachments exported with --media are local files the server can't see, the CLI imports those
+func (h *Handler) importDiscord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := importers.ParseDiscord(http.MaxBytesReader(w, r.Body, importMaxFileSize), "")
+	if err != nil {
+		log.Printf("Error parsing Discord export: %v", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Export is too large, use the import-discord command instead", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid Discord export", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[IMPORT] Importing %d Discord message(s) for user %s", len(items), userID)
+
+	h.streamImport(w, r, userID, importers.SourceDiscord, items)
+}
+
+// imports a zipped Obsidian vault sent as the "file" form field, streaming progress as JSON Lines
+// an optional "timezone" field says where the dates and times written in the notes are (default UTC)
+func (h *Handler) importObsidian(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, importMaxFileSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Vault is too large, use the import-obsidian command instead", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	loc := time.UTC
+	if timezone := r.FormValue("timezone"); timezone != "" {
+		loc, err = time.LoadLocation(timezone)
+		if err != nil {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+	}
+
+	zr, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		log.Printf("Error opening vault zip: %v", err)
+		http.Error(w, "Invalid zip file", http.StatusBadRequest)
+		return
+	}
+
+	items := importers.ParseObsidian(zr, loc)
+
+	log.Printf("[IMPORT] Importing %d Obsidian note(s) and section(s) for user %s", len(items), userID)
+
+	h.streamImport(w, r, userID, importers.SourceObsidian, items)
+}
+
+// runs the import and writes a types.ImportProgress line after every batch, flushing so the client
+// sees them as they happen (in Lambda the lines all arrive at the end)
+func (h *Handler) streamImport(w http.ResponseWriter, r *http.Request, userID uuid.UUID, source string, items []importers.Item) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	write := func(progress types.ImportProgress) {
+		if err := enc.Encode(progress); err != nil {
+			log.Printf("Error encoding import progress: %v", err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	progress, err := h.ImportItems(r.Context(), userID, source, items, write)
+	if err != nil {
+		log.Printf("Error importing thoughts: %v", err)
+		progress.Error = "Import stopped early, run it again to import the rest"
+	}
+	write(progress)
+
+	log.Printf("[IMPORT] Imported %d thought(s) for user %s (%d skipped, %d failed)", progress.Created, userID, progress.Skipped, progress.Failed)
+}
+
+// ImportItems creates a thought for every item not imported from source before, keeping its timestamp
+// items go in batches: their attachments are re-uploaded, their texts embedded in one call, and
+// progress (if not nil) is called after each batch; a failed item or attachment doesn't stop the import
+// returns the counts so far, with Done set only when every item was handled
+func (h *Handler) ImportItems(ctx context.Context, userID uuid.UUID, source string, items []importers.Item, progress func(types.ImportProgress)) (types.ImportProgress, error) {
+	result := types.ImportProgress{Total: len(items)}
+	seen := make(map[string]bool, len(items))
+
+	// one event for the whole import, even one that stopped early (when ctx is likely cancelled)
+	defer func() {
+		if result.Created > 0 {
+			h.publish(context.WithoutCancel(ctx), userID, events.ThoughtsImported, uuid.Nil)
+		}
+	}()
+
+	for start := 0; start < len(items); start += importBatchSize {
+		batch := items[start:min(start+importBatchSize, len(items))]
+		if err := h.importBatch(ctx, userID, source, batch, seen, &result); err != nil {
+			return result, err
+		}
+		if progress != nil {
+			progress(result)
+		}
+	}
+
+	result.Done = true
+	return result, nil
+}
+
+func (h *Handler) importBatch(ctx context.Context, userID uuid.UUID, source string, batch []importers.Item, seen map[string]bool, result *types.ImportProgress) error {
+	sourceIDs := make([]string, len(batch))
+	for i, item := range batch {
+		sourceIDs[i] = item.SourceID
+	}
+
+	imported, err := h.store.ImportedSourceIDs(ctx, userID, source, sourceIDs)
+	if err != nil {
+		return fmt.Errorf("failed to check for imported items: %w", err)
+	}
+	for _, id := range imported {
+		seen[id] = true
+	}
+
+	// skip what's already imported before spending downloads and embeddings on it
+	var todo []importers.Item
+	for _, item := range batch {
+		if seen[item.SourceID] {
+			result.Skipped++
+			result.Processed++
+			continue
+		}
+		seen[item.SourceID] = true
+		todo = append(todo, item)
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+
+	texts := make([]string, len(todo))
+	for i, item := range todo {
+		texts[i] = item.Text
+	}
+
+	// a failed batch is saved pending, the embedding worker retries each thought on its own
+	embeddings, err := h.embedder.EmbedThoughts(ctx, texts)
+	if err != nil {
+		log.Printf("[IMPORT] Error embedding batch, leaving %d thought(s) pending: %v", len(todo), err)
+		embeddings = nil
+	}
+
+	for i, item := range todo {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var embedding []float32
+		if embeddings != nil {
+			embedding = embeddings[i]
+		}
+
+		attachments := h.importAttachments(ctx, item, result)
+
+		thought, err := h.store.ImportThought(ctx, userID, stores.ImportedThought{
+			Source:      source,
+			SourceID:    item.SourceID,
+			Thought:     item.Text,
+			CreatedAt:   item.CreatedAt,
+			Embedding:   embedding,
+			Attachments: attachments,
+		})
+		result.Processed++
+		if err != nil {
+			// the uploads belong to no thought now
+			h.deleteBlobs(ctx, types.AttachmentKeys(attachments))
+			if errors.Is(err, stores.ErrAlreadyImported) {
+				result.Skipped++
+				continue
+			}
+			log.Printf("[IMPORT] Error importing %s item %s: %v", source, item.SourceID, err)
+			result.Failed++
+			continue
+		}
+		result.Created++
+
+		if embedding == nil {
+			job := queues.EmbeddingJob{UserID: userID, ThoughtID: thought.ID}
+			if err := h.embeddingQueue.Enqueue(ctx, job); err != nil {
+				log.Printf("Error enqueueing embedding job for thought %s: %v", thought.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// uploads the attachments that can be opened; the rest are counted and logged
+func (h *Handler) importAttachments(ctx context.Context, item importers.Item, result *types.ImportProgress) []types.Attachment {
+	var attachments []types.Attachment
+	for _, a := range item.Attachments {
+		attachment, err := h.importAttachment(ctx, a)
+		if err != nil {
+			log.Printf("[IMPORT] Error importing attachment %s of item %s: %v", a.FileName, item.SourceID, err)
+			result.FailedAttachments++
+			continue
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments
+}
+
+func (h *Handler) importAttachment(ctx context.Context, a importers.Attachment) (types.Attachment, error) {
+	body, err := a.Open(ctx)
+	if err != nil {
+		return types.Attachment{}, err
+	}
+	defer body.Close()
+
+	return utils.UploadFile(ctx, h.blobs, a.FileName, body)
+}
+
+func (h *Handler) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := h.blobs.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting attachment %s: %v", key, err)
+		}
+	}
+}
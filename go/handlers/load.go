@@ -1,13 +1,13 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"log"
 	"net/http"
 
 	"github.com/google/uuid"
 
+	"github.com/skarokin/runsynapse/go/stores"
 	"github.com/skarokin/runsynapse/go/types"
 )
 
@@ -17,78 +17,30 @@ func (h *Handler) loadFunction(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	
-	var request types.RequestsOnlyRequiringUserID
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+
+	// the body used to carry user_id; the user now comes from the verified token so it's not read at all
+	userID, ok := requireUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// extract user ID (it's of type UserID, already validated)
-	userIDStr := request.UserID
-	userID, err := uuid.Parse(string(userIDStr))
+	log.Println("[LOAD] Load function called for user:", userID)
+
+	res, err := h.store.LoadThoughtsAndPins(r.Context(), userID)
 	if err != nil {
-		log.Printf("Invalid user_id: %v", err)
-		http.Error(w, "Invalid user_id", http.StatusBadRequest)
+		log.Printf("Error loading thoughts: %v", err)
+		http.Error(w, "Failed to load thoughts", http.StatusInternalServerError)
 		return
 	}
 
-	log.Println("[LOAD] Load function called for user:", userIDStr)
-
-	// get db result
-	var res string
-    err = h.supabaseClient.QueryRow(context.Background(), `
-        SELECT load_thoughts_and_pins($1)
-    `, userID).Scan(&res)
-
-    if err != nil {
-        log.Printf("Error loading thoughts: %v", err)
-        http.Error(w, "Failed to load thoughts", http.StatusInternalServerError)
-        return
-    }
-
-	// parse result into a struct
-    var dbResult struct {
-        Thoughts       []json.RawMessage `json:"thoughts"`
-        PinnedThoughts []json.RawMessage `json:"pinned_thoughts"`
-		HasMoreAbove   bool              `json:"has_more_above"`
-    }
-
-	// the result is a JSON string, so we need to unmarshal it
-    err = json.Unmarshal([]byte(res), &dbResult)
-    if err != nil {
-        log.Printf("Error parsing database result: %v", err)
-        http.Error(w, "Failed to parse result", http.StatusInternalServerError)
-        return
-    }
-
-    // convert raw messages to Thought structs
-    var thoughts []types.Thought
-    for _, rawThought := range dbResult.Thoughts {
-        var thought types.Thought
-        if err := json.Unmarshal(rawThought, &thought); err != nil {
-            log.Printf("Error unmarshaling thought: %v", err)
-            continue
-        }
-		
-        thoughts = append(thoughts, thought)
-    }
-
-    var pinnedThoughts []types.Thought
-    for _, rawThought := range dbResult.PinnedThoughts {
-        var thought types.Thought
-        if err := json.Unmarshal(rawThought, &thought); err != nil {
-            log.Printf("Error unmarshaling pinned thought: %v", err)
-            continue
-        }
-        pinnedThoughts = append(pinnedThoughts, thought)
-    }
+	h.signAttachments(r.Context(), res.Thoughts)
+	h.signAttachments(r.Context(), res.PinnedThoughts)
 
 	// build response
 	response := types.LoadFunctionResponse{
-		Thoughts:       thoughts,
-		PinnedThoughts: pinnedThoughts,
-		HasMoreAbove: dbResult.HasMoreAbove,
+		Thoughts:       res.Thoughts,
+		PinnedThoughts: res.PinnedThoughts,
+		HasMoreAbove:   res.HasMoreAbove,
 	}
 
     w.Header().Set("Content-Type", "application/json")
@@ -106,18 +58,17 @@ func (h *Handler) loadThoughts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// extract userID and params from request
-	userIDStr := request.UserID
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	// extract params from request
 	cursorStr := request.Cursor
 
-	log.Println("[LOAD] Loading thoughts for user:", userIDStr, "with cursor:", cursorStr)
+	filter := stores.LoadFilter{Tag: string(request.Tag)}
 
-	userID, err := uuid.Parse(string(userIDStr))
-	if err != nil {
-		log.Printf("Invalid user_id: %v", err)
-		http.Error(w, "Invalid user_id", http.StatusBadRequest)
-		return
-	}
+	log.Println("[LOAD] Loading thoughts for user:", userID, "with cursor:", cursorStr, "order:", request.Order, "tag:", filter.Tag, "topic:", request.TopicID)
 
 	cursor, err := uuid.Parse(string(cursorStr))
 	if err != nil && cursorStr != "" {
@@ -126,46 +77,39 @@ func (h *Handler) loadThoughts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// get db result
-	var res string
-	err = h.supabaseClient.QueryRow(context.Background(), `
-		SELECT load_more($1, $2)
-	`, userID, cursor).Scan(&res)
-
-	if err != nil {
-		log.Printf("Error loading thoughts: %v", err)
-		http.Error(w, "Failed to load thoughts", http.StatusInternalServerError)
-		return
+	if request.TopicID != "" {
+		filter.TopicID, err = uuid.Parse(string(request.TopicID))
+		if err != nil {
+			log.Printf("Invalid topic_id: %v", err)
+			http.Error(w, "Invalid topic_id", http.StatusBadRequest)
+			return
+		}
 	}
 
-	// parse result into a struct
-	var dbResult struct {
-		Thoughts       []json.RawMessage  `json:"thoughts"`
-		HasMoreAbove   bool               `json:"has_more_above"`
+	// "after" scrolls down from a thought (e.g. after jumping to a pin), so it needs a cursor
+	var res *stores.LoadResult
+	if request.Order == "after" {
+		if cursorStr == "" {
+			http.Error(w, "cursor is required when order is after", http.StatusBadRequest)
+			return
+		}
+		res, err = h.store.LoadAfter(r.Context(), userID, cursor, filter)
+	} else {
+		res, err = h.store.LoadMore(r.Context(), userID, cursor, filter)
 	}
-	err = json.Unmarshal([]byte(res), &dbResult)
 	if err != nil {
-		log.Printf("Error parsing database result: %v", err)
-		http.Error(w, "Failed to parse result", http.StatusInternalServerError)
+		log.Printf("Error loading thoughts: %v", err)
+		http.Error(w, "Failed to load thoughts", http.StatusInternalServerError)
 		return
 	}
 
-	// convert raw messages to Thought structs
-	var thoughts []types.Thought
-	for _, rawThought := range dbResult.Thoughts {
-		var thought types.Thought
-		if err := json.Unmarshal(rawThought, &thought); err != nil {
-			log.Printf("Error unmarshaling thought: %v", err)
-			continue
-		}
-		thoughts = append(thoughts, thought)
-
-	}
+	h.signAttachments(r.Context(), res.Thoughts)
 
 	// build response
 	response := types.LoadThoughtsResponse{
-		Thoughts:       thoughts,
-		HasMoreAbove: dbResult.HasMoreAbove,
+		Thoughts:     res.Thoughts,
+		HasMoreAbove: res.HasMoreAbove,
+		HasMoreBelow: res.HasMoreBelow,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"log"
 	"encoding/json"
 
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/events"
+	"github.com/skarokin/runsynapse/go/stores"
 	"github.com/skarokin/runsynapse/go/types"
 )
 
@@ -21,11 +26,31 @@ func (h *Handler) pinThought(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("[PINS] Pinning thought for user:", request.UserID)
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	log.Println("[PINS] Pinning thought for user:", userID)
+
+	thoughtID, ok := parseThoughtID(w, request.ThoughtID)
+	if !ok {
+		return
+	}
+
+	pinnedThoughts, changed, err := h.store.PinThought(r.Context(), userID, thoughtID)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+
+	// pinning a thought that was already pinned changes nothing other clients need to reload for
+	if changed {
+		h.publish(r.Context(), userID, events.ThoughtPinned, thoughtID)
+	}
 
-	// 1. parse request json
-	// 2. update the pins table for this user in the database
-	// 3. return the updated list of pinned thoughts for immediate use in the UI
+	h.signAttachments(r.Context(), pinnedThoughts)
+	writePinnedThoughts(w, pinnedThoughts)
 }
 
 func (h *Handler) unpinThought(w http.ResponseWriter, r *http.Request) {
@@ -41,9 +66,125 @@ func (h *Handler) unpinThought(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("[PINS] Unpinning thought for user:", request.UserID)
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	log.Println("[PINS] Unpinning thought for user:", userID)
+
+	thoughtID, ok := parseThoughtID(w, request.ThoughtID)
+	if !ok {
+		return
+	}
 
-	// 1. parse request json
-	// 2. remove the pin from the pins table for this user in the database
-	// 3. return the updated list of pinned thoughts for immediate use in the UI
-}
\ No newline at end of file
+	pinnedThoughts, changed, err := h.store.UnpinThought(r.Context(), userID, thoughtID)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+
+	// unpinning a thought that wasn't pinned changes nothing other clients need to reload for
+	if changed {
+		h.publish(r.Context(), userID, events.ThoughtUnpinned, thoughtID)
+	}
+
+	h.signAttachments(r.Context(), pinnedThoughts)
+	writePinnedThoughts(w, pinnedThoughts)
+}
+
+// returns a window of thoughts centered on the pin so the sidebar can jump into the timeline
+func (h *Handler) gotoPin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request types.GotoPinRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Println("Error decoding request body:", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	log.Println("[PINS] Going to pinned thought for user:", userID)
+
+	thoughtID, ok := parseThoughtID(w, request.ThoughtID)
+	if !ok {
+		return
+	}
+
+	res, err := h.store.LoadAround(r.Context(), userID, thoughtID)
+	if errors.Is(err, stores.ErrThoughtNotFound) {
+		http.Error(w, "Thought not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading thoughts around pin: %v", err)
+		http.Error(w, "Failed to load thoughts", http.StatusInternalServerError)
+		return
+	}
+
+	h.signAttachments(r.Context(), res.Thoughts)
+
+	response := types.GotoPinResponse{
+		Thoughts:     res.Thoughts,
+		HasMoreAbove: res.HasMoreAbove,
+		HasMoreBelow: res.HasMoreBelow,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// writes a 400 and returns false if the ID is invalid
+func parseThoughtID(w http.ResponseWriter, thoughtIDStr types.ThoughtID) (uuid.UUID, bool) {
+	thoughtID, err := uuid.Parse(string(thoughtIDStr))
+	if err != nil {
+		log.Printf("Invalid thought_id: %v", err)
+		http.Error(w, "Invalid thought_id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	return thoughtID, true
+}
+
+func writePinError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, stores.ErrThoughtNotFound):
+		http.Error(w, "Thought not found", http.StatusNotFound)
+	case errors.Is(err, stores.ErrPinLimitReached):
+		http.Error(w, "Pin limit reached", http.StatusConflict)
+	default:
+		log.Printf("Error updating pins: %v", err)
+		http.Error(w, "Failed to update pins", http.StatusInternalServerError)
+	}
+}
+
+// returns the updated list of pinned thoughts for immediate use in the UI
+func writePinnedThoughts(w http.ResponseWriter, pinnedThoughts []types.Thought) {
+	// always send an array so the UI can replace its list without a null check
+	if pinnedThoughts == nil {
+		pinnedThoughts = []types.Thought{}
+	}
+
+	response := types.PinThoughtResponse{
+		PinnedThoughts: pinnedThoughts,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
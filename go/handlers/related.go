@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/skarokin/runsynapse/go/stores"
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+const (
+	relatedDefaultLimit  = 10  // related thoughts returned when the request doesn't set a limit
+	relatedMaxLimit      = 50  // most related thoughts a single request can ask for
+	relatedMinSimilarity = 0.5 // default cosine similarity cutoff, below this thoughts are rarely about the same thing
+)
+
+// "what else have I written like this?" - nearest thoughts to one of the user's thoughts by its stored
+// embedding, so nothing is embedded at request time
+func (h *Handler) relatedThoughts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request types.RelatedThoughtsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	thoughtID, ok := parseThoughtID(w, request.ThoughtID)
+	if !ok {
+		return
+	}
+
+	limit := request.Limit
+	if limit == 0 {
+		limit = relatedDefaultLimit
+	}
+	if limit < 1 || limit > relatedMaxLimit {
+		http.Error(w, "limit must be between 1 and 50", http.StatusBadRequest)
+		return
+	}
+
+	minSimilarity := relatedMinSimilarity
+	if request.MinSimilarity != nil {
+		minSimilarity = *request.MinSimilarity
+	}
+	if minSimilarity < -1 || minSimilarity > 1 {
+		http.Error(w, "min_similarity must be between -1 and 1", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[RELATED] Finding up to %d thoughts related to %s for user %s (min similarity %.2f)", limit, thoughtID, userID, minSimilarity)
+
+	hits, err := h.store.RelatedThoughts(r.Context(), userID, thoughtID, minSimilarity, limit)
+	if errors.Is(err, stores.ErrThoughtNotFound) {
+		http.Error(w, "Thought not found", http.StatusNotFound)
+		return
+	}
+	// the client can retry once the embedding worker has caught up
+	if errors.Is(err, stores.ErrNotEmbedded) {
+		http.Error(w, "Thought is not embedded yet", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding related thoughts: %v", err)
+		http.Error(w, "Failed to find related thoughts", http.StatusInternalServerError)
+		return
+	}
+
+	related := make([]types.RelatedThought, 0, len(hits))
+	for _, hit := range hits {
+		h.signThought(r.Context(), &hit.Thought)
+		related = append(related, types.RelatedThought{
+			Thought:    hit.Thought,
+			Similarity: hit.Score,
+		})
+	}
+
+	log.Printf("[RELATED] Returning %d related thoughts for %s", len(related), thoughtID)
+
+	response := types.RelatedThoughtsResponse{
+		Related: related,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// periodic maintenance; run by an EventBridge-scheduled Lambda in production and a ticker in development
+// every task runs even if an earlier one fails, errors are joined
+func (h *Handler) RunScheduledTasks(ctx context.Context) error {
+	log.Println("[SCHEDULED] Running scheduled tasks")
+
+	var errs []error
+	if err := h.requeuePendingEmbeddings(ctx); err != nil {
+		log.Printf("[SCHEDULED] Error re-enqueueing pending embeddings: %v", err)
+		errs = append(errs, err)
+	}
+	if err := h.purgeTrash(ctx); err != nil {
+		log.Printf("[SCHEDULED] Error purging trash: %v", err)
+		errs = append(errs, err)
+	}
+	if err := h.clusterTopics(ctx); err != nil {
+		log.Printf("[SCHEDULED] Error clustering topics: %v", err)
+		errs = append(errs, err)
+	}
+	if err := h.generateDigests(ctx); err != nil {
+		log.Printf("[SCHEDULED] Error generating digests: %v", err)
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
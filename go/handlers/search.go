@@ -1,16 +1,28 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"log"
 	"encoding/json"
 
 	"github.com/google/uuid"
 
+	"github.com/skarokin/runsynapse/go/stores"
 	"github.com/skarokin/runsynapse/go/types"
 	"github.com/skarokin/runsynapse/go/utils"
 )
 
+const (
+	searchCandidates = 50	// results pulled from each retriever before fusion
+	searchResults    = 20	// results returned after fusion
+)
+
+type SearchHitsResult struct {
+	Hits []stores.SearchHit
+	Err error
+}
+
 func (h *Handler) searchThoughts(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -23,11 +35,8 @@ func (h *Handler) searchThoughts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIDStr := request.UserID
-	userID, err := uuid.Parse(string(userIDStr))
-	if err != nil {
-		log.Printf("Invalid user_id: %v", err)
-		http.Error(w, "Invalid user_id", http.StatusBadRequest)
+	userID, ok := requireUserID(w, r)
+	if !ok {
 		return
 	}
 
@@ -38,24 +47,119 @@ func (h *Handler) searchThoughts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	queryStr := string(query)
-	log.Printf("[SEARCH] Searching thoughts for user %s with query: %s", userID, queryStr)
+	tag := string(request.Tag)
+	log.Printf("[SEARCH] Searching thoughts for user %s with query: %s (tag: %q)", userID, queryStr, tag)
 
-	// get query embedding
-	embedding, err := utils.GetQueryEmbedding(r.Context(), h.geminiClient, queryStr)
+	results, err := h.hybridSearch(r.Context(), userID, queryStr, tag, searchResults)
 	if err != nil {
-		log.Printf("Error generating embedding: %v", err)
-		http.Error(w, "Failed to generate query embedding", http.StatusInternalServerError)
+		log.Printf("Error searching thoughts: %v", err)
+		http.Error(w, "Failed to search thoughts", http.StatusInternalServerError)
 		return
 	}
-	// temp print for compile
-	log.Printf("[SEARCH] Generated embedding for query: %v", embedding)
 
-	// db call performs hybrid search: does FTS & vector search
+	log.Printf("[SEARCH] Returning %d results for user %s", len(results), userID)
+
+	for i := range results {
+		h.signThought(r.Context(), &results[i].Thought)
+	}
+
+	response := types.SearchThoughtsResponse{
+		Results: results,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// runs full-text and vector search concurrently and fuses them with weighted reciprocal rank fusion
+// if the query can't be embedded, falls back to full-text results only rather than failing the search
+// a non-empty tag restricts both retrievers to thoughts with that hashtag
+func (h *Handler) hybridSearch(ctx context.Context, userID uuid.UUID, query string, tag string, limit int) ([]types.SearchResult, error) {
+	ftsChan := make(chan SearchHitsResult, 1)
+	vectorChan := make(chan SearchHitsResult, 1)
+
+	// db call performs FTS
+	go func() {
+		defer close(ftsChan)
+
+		hits, err := h.store.SearchFullText(ctx, userID, query, tag, searchCandidates)
+		ftsChan <- SearchHitsResult{Hits: hits, Err: err}
+	}()
+
+	// embed the query, then db call performs vector search
+	go func() {
+		defer close(vectorChan)
+
+		embedding, err := h.embedder.EmbedQuery(ctx, query)
+		if err != nil {
+			vectorChan <- SearchHitsResult{Err: err}
+			return
+		}
+
+		hits, err := h.store.SearchVector(ctx, userID, embedding, tag, searchCandidates)
+		vectorChan <- SearchHitsResult{Hits: hits, Err: err}
+	}()
+
+	ftsResult := <-ftsChan
+	vectorResult := <-vectorChan
+
+	if ftsResult.Err != nil {
+		return nil, ftsResult.Err
+	}
+	if vectorResult.Err != nil {
+		log.Printf("[SEARCH] Vector search failed, using full-text results only: %v", vectorResult.Err)
+	}
+
+	// rerank results, FTS gets more weight by default (see utils.DefaultFusionConfig)
+	fused := utils.FuseRanks(h.searchFusion.K,
+		utils.RankedList{Retriever: "fts", Weight: h.searchFusion.FullTextWeight, IDs: hitIDs(ftsResult.Hits)},
+		utils.RankedList{Retriever: "vector", Weight: h.searchFusion.VectorWeight, IDs: hitIDs(vectorResult.Hits)},
+	)
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
 
-	// rerank results, give more weight to FTS results
+	ftsHits := hitsByID(ftsResult.Hits)
+	vectorHits := hitsByID(vectorResult.Hits)
 
-	// call gemini w/ reranked results
-	
-	// return
+	results := make([]types.SearchResult, 0, len(fused))
+	for _, f := range fused {
+		result := types.SearchResult{
+			Score:     f.Score,
+			MatchedBy: f.MatchedBy,
+		}
 
-}
\ No newline at end of file
+		if hit, ok := ftsHits[f.ID]; ok {
+			result.Thought = hit.Thought
+			result.FullTextScore = &hit.Score
+		}
+		if hit, ok := vectorHits[f.ID]; ok {
+			result.Thought = hit.Thought
+			result.VectorScore = &hit.Score
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func hitIDs(hits []stores.SearchHit) []uuid.UUID {
+	ids := make([]uuid.UUID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.Thought.ID
+	}
+	return ids
+}
+
+func hitsByID(hits []stores.SearchHit) map[uuid.UUID]stores.SearchHit {
+	byID := make(map[uuid.UUID]stores.SearchHit, len(hits))
+	for _, hit := range hits {
+		byID[hit.Thought.ID] = hit
+	}
+	return byID
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+// every hashtag the user has used with how many thoughts use it, for the tag sidebar
+// loadThoughts and searchThoughts take one of these as their tag filter
+func (h *Handler) listTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	log.Println("[TAGS] Listing tags for user:", userID)
+
+	tags, err := h.store.ListTags(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing tags: %v", err)
+		http.Error(w, "Failed to list tags", http.StatusInternalServerError)
+		return
+	}
+
+	if tags == nil {
+		tags = []types.TagCount{}
+	}
+
+	response := types.ListTagsResponse{
+		Tags: tags,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
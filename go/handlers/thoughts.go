@@ -3,25 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
 	"github.com/google/uuid"
 	
+	"github.com/skarokin/runsynapse/go/events"
+	"github.com/skarokin/runsynapse/go/queues"
 	"github.com/skarokin/runsynapse/go/types"
 	"github.com/skarokin/runsynapse/go/utils"
 )
 
-type FileResult struct {
-	URLs []string
-	Err error
-}
-
-type EmbeddingResult struct {
-	Embedding string
-	Err error
-}
-
 func (h *Handler) newThought(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -35,131 +28,116 @@ func (h *Handler) newThought(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-    userIDstr := r.FormValue("user_id")
-    thoughtText := r.FormValue("thought")
-
-    if userIDstr == "" {
-		log.Println("user_id is required")
-        http.Error(w, "user_id is required", http.StatusBadRequest)
-        return
-    }
-
-	log.Println("[NEW_THOUGHT] New thought request received for user:", userIDstr)
-
-	userID, err := uuid.Parse(userIDstr)
-	if err != nil {
-		log.Printf("Invalid user_id: %v", err)
-		http.Error(w, "Invalid user_id", http.StatusBadRequest)
+	userID, ok := requireUserID(w, r)
+	if !ok {
 		return
 	}
 
+	// a user_id form field may still be sent by older clients, it's ignored
+    thoughtText := r.FormValue("thought")
+
+	log.Println("[NEW_THOUGHT] New thought request received for user:", userID)
+
     if thoughtText == "" {
 		log.Println("thought is required")
         http.Error(w, "thought is required", http.StatusBadRequest)
         return
     }
 
-	// make channels for files and embedding async calls
-	fileChan := make(chan FileResult, 1)
-	embeddingChan := make(chan EmbeddingResult, 1)
-    
-	// process attachments
-    go func() {
-        defer close(fileChan)
-        
-        urls, err := utils.UploadFilesToS3(
-            context.Background(),
-            h.s3Client,
-            h.s3Bucket,
-            r.MultipartForm.File["files"],
-        )
-        fileChan <- FileResult{URLs: urls, Err: err}
-    }()
-
-	// generate embeddings
-    go func() {
-        defer close(embeddingChan)
-        
-        embedding, err := utils.GetThoughtEmbedding(context.Background(), h.geminiClient, thoughtText)
-        embeddingChan <- EmbeddingResult{Embedding: embedding, Err: err}
-    }()
-
-	// wait for both goroutines to finish
-	fileResult := <-fileChan
-	embeddingResult := <-embeddingChan
+	// files already uploaded through /createUploadURLs; checked before anything else is uploaded, and
+	// refused files from both are reported together. VerifyUpload copies each one, and the uploads are
+	// deleted once the thought is saved so a key can't be attached twice
+	uploadKeys := r.MultipartForm.Value["upload_keys"]
+	seen := make(map[string]bool, len(uploadKeys))
+	for _, key := range uploadKeys {
+		if seen[key] {
+			http.Error(w, "upload key "+key+" is listed more than once", http.StatusBadRequest)
+			return
+		}
+		seen[key] = true
+	}
+
+	// everything stored for this request (the copies, form files and their thumbnails) is removed again
+	// if the thought isn't saved, so no blob is left without a thought pointing at it
+	var uploaded []types.Attachment
+	var attachments []types.Attachment
+	saved := false
+	defer func() {
+		if !saved {
+			// the request may have been cancelled, which is often why the thought wasn't saved
+			h.deleteBlobs(context.WithoutCancel(r.Context()), types.AttachmentKeys(append(attachments, uploaded...)))
+		}
+	}()
+
+	var rejected []types.RejectedFile
+	for _, key := range uploadKeys {
+		attachment, err := utils.VerifyUpload(r.Context(), h.blobs, userID, key)
+		var rejection *utils.RejectedFilesError
+		if errors.As(err, &rejection) {
+			rejected = append(rejected, rejection.Files...)
+			continue
+		}
+		if errors.Is(err, utils.ErrInvalidUpload) {
+			log.Printf("Invalid upload key: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error verifying upload %s: %v", key, err)
+			http.Error(w, "Failed to verify uploads", http.StatusInternalServerError)
+			return
+		}
+		uploaded = append(uploaded, attachment)
+	}
 
-	if fileResult.Err != nil {
-		log.Printf("Error uploading files: %v", fileResult.Err)
-		http.Error(w, "Failed to upload files", http.StatusInternalServerError)
+	if len(rejected) > 0 {
+		var rejection *utils.RejectedFilesError
+		if errors.As(utils.CheckFiles(r.MultipartForm.File["files"]), &rejection) {
+			rejected = append(rejected, rejection.Files...)
+		}
+		writeRejectedFiles(w, rejected)
 		return
 	}
 
-	if embeddingResult.Err != nil {
-		log.Printf("Error generating embedding: %v", embeddingResult.Err)
-		http.Error(w, "Failed to generate embedding", http.StatusInternalServerError)
+	// process attachments
+	attachments, err = utils.UploadFiles(
+		r.Context(),
+		h.blobs,
+		r.MultipartForm.File["files"],
+	)
+	var rejection *utils.RejectedFilesError
+	if errors.As(err, &rejection) {
+		writeRejectedFiles(w, rejection.Files)
+		return
+	}
+	if err != nil {
+		log.Printf("Error uploading files: %v", err)
+		http.Error(w, "Failed to upload files", http.StatusInternalServerError)
 		return
 	}
 
-	attachmentURLs := fileResult.URLs
-	embedding := embeddingResult.Embedding
-
-	// postgres expects attachment URLs as a JSON array so marshal it
-	var attachmentURLsBytes []byte
-    if len(attachmentURLs) == 0 {
-        attachmentURLsBytes = []byte("[]")
-    } else {
-        attachmentURLsBytes, err = json.Marshal(attachmentURLs)
-        if err != nil {
-            log.Printf("Error marshalling attachment URLs: %v", err)
-            http.Error(w, "Failed to process attachments", http.StatusInternalServerError)
-            return
-        }
-    }
-
-	// get db result
-	var res string
-
-    err = h.supabaseClient.QueryRow(context.Background(), `
-        SELECT * FROM new_thought($1, $2, $3, $4)
-    `, userID, thoughtText, embedding, string(attachmentURLsBytes)).Scan(&res)
+	// save immediately without an embedding so a slow or failing embedding API never loses a capture
+	newThought, err := h.store.NewThought(r.Context(), userID, thoughtText, nil, append(attachments, uploaded...))
 	if err != nil {
 		log.Printf("Error inserting new thought: %v", err)
 		http.Error(w, "Failed to insert new thought", http.StatusInternalServerError)
 		return
 	}
+	saved = true
+	h.deleteBlobs(r.Context(), uploadKeys)
 
-	// parse result into a struct
-	var dbResult struct {
-		ID string `json:"id"`
-		CreatedAt string `json:"created_at"`
+	// the embedding worker fills the vector in; if enqueueing fails the scheduled sweep picks the thought up
+	job := queues.EmbeddingJob{UserID: userID, ThoughtID: newThought.ID}
+	if err := h.embeddingQueue.Enqueue(r.Context(), job); err != nil {
+		log.Printf("Error enqueueing embedding job for thought %s: %v", newThought.ID, err)
 	}
 
-	// the result is a JSON string, so we need to unmarshal it
-	err = json.Unmarshal([]byte(res), &dbResult)
-    if err != nil {
-        log.Printf("Error parsing database result: %v", err)
-        http.Error(w, "Failed to parse result", http.StatusInternalServerError)
-        return
-    }
+	h.publish(r.Context(), userID, events.ThoughtCreated, newThought.ID)
 
-	// validate the thought ID
-    thoughtID, err := uuid.Parse(dbResult.ID); if err != nil {
-		log.Printf("Invalid thought ID from database: %v", err)
-		http.Error(w, "Invalid thought ID", http.StatusInternalServerError)
-		return
-	}
-
-	// build the resposne
-	newThought := types.Thought{
-		ID:        thoughtID,
-		Thought:   thoughtText,
-		Pinned:    false, // default to not pinned
-		Created: dbResult.CreatedAt,
-		Attachments: attachmentURLs,
-	}
+	h.signThought(r.Context(), newThought)
 
     response := types.NewThoughtResponse{
-        Thought: newThought,
+        Thought: *newThought,
     }
 
     w.Header().Set("Content-Type", "application/json")
@@ -184,7 +162,11 @@ func (h *Handler) deleteThought(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIDStr := request.UserID
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
 	thoughtIDStr := request.ThoughtID
 
 	if thoughtIDStr == "" {
@@ -193,20 +175,7 @@ func (h *Handler) deleteThought(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if userIDStr == "" {
-		log.Println("user_id is required")
-		http.Error(w, "user_id is required", http.StatusBadRequest)
-		return
-	}
-
-	log.Println("[DELETE_THOUGHT] Delete thought request received for user:", userIDStr)
-
-	userID, err := uuid.Parse(string(userIDStr))
-	if err != nil {
-		log.Printf("Invalid user_id: %v", err)
-		http.Error(w, "Invalid user_id", http.StatusBadRequest)
-		return
-	}
+	log.Println("[DELETE_THOUGHT] Delete thought request received for user:", userID)
 
 	thoughtID, err := uuid.Parse(string(thoughtIDStr))
 	if err != nil {
@@ -215,49 +184,20 @@ func (h *Handler) deleteThought(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 2. delete the thought and associated data from the database
-	var res string
-	err = h.supabaseClient.QueryRow(context.Background(), `
-		SELECT * FROM delete_thought($1, $2)
-	`, userID, thoughtID).Scan(&res)
+	// 2. move the thought to the trash; its attachments are deleted when the trash is purged
+	deleted, err := h.store.TrashThought(r.Context(), userID, thoughtID)
 	if err != nil {
 		log.Printf("Error deleting thought: %v", err)
 		http.Error(w, "Failed to delete thought", http.StatusInternalServerError)
 		return
 	}
 
-	// parse result into a struct
-	var dbResult struct {
-		Deleted bool `json:"deleted"`
-		AttachmentURLs []string `json:"attachment_urls"`
-		ThoughtID string `json:"thought_id"`
-	}
-
-	err = json.Unmarshal([]byte(res), &dbResult)
-	if err != nil {
-		log.Printf("Error parsing database result: %v", err)
-		http.Error(w, "Failed to parse result", http.StatusInternalServerError)
-		return
-	}
-	
-	// 3. delete the files from S3 if they exist (database call will return attachment URLs)
-	for _, url := range dbResult.AttachmentURLs {
-		if url == "" {
-			continue // skip empty URLs
-		}
-		err = utils.DeleteFromS3(
-			context.Background(),
-			h.s3Client,
-			h.s3Bucket,
-			url,
-		)
-		if err != nil {
-			log.Printf("Error deleting file from S3: %v", err)
-		}
+	if deleted {
+		h.publish(r.Context(), userID, events.ThoughtDeleted, thoughtID)
 	}
 
 	response := types.DeleteThoughtResponse{
-		Success: dbResult.Deleted,
+		Success: deleted,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
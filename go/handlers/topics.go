@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/stores"
+	"github.com/skarokin/runsynapse/go/types"
+	"github.com/skarokin/runsynapse/go/utils"
+)
+
+const (
+	topicMinThoughts       = 10            // embedded thoughts a user needs before they get topics
+	topicMinCount          = 2             // lower bound on k, see utils.TopicCount
+	topicMaxCount          = 15            // upper bound on k
+	topicMinSize           = 3             // smaller clusters are left without a topic
+	topicIterations        = 25            // k-means iterations, it usually converges well before this
+	topicReclusterInterval = 6 * time.Hour // a user is reclustered at most this often
+	topicUsersPerRun       = 10            // users clustered per scheduled run
+	topicLabelSamples      = 8             // thoughts closest to the centroid that Gemini sees per cluster
+	topicLabelSampleChars  = 280           // each sample is truncated to this many characters
+	topicSampleThoughts    = 3             // sample thoughts per topic in /topics
+)
+
+const topicLabelInstructions = `You name groups of the user's own notes, called thoughts.
+Each group in the prompt lists a few of its most representative thoughts.
+Give every group a short label of 1 to 4 words saying what its thoughts are about.
+Labels should be specific and distinct from each other; avoid generic labels like "notes", "ideas" or "misc".
+Respond with a JSON object of the form {"labels": [{"group": number, "label": string}]} with one entry per group.`
+
+// one cluster of a clustering run; samples are the member texts closest to the centroid
+type topicCluster struct {
+	thoughtIDs []uuid.UUID
+	samples    []string
+}
+
+// lists the user's topics with sizes and a few sample thoughts; loadThoughts takes a topic_id to page through one
+func (h *Handler) listTopics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	log.Println("[TOPICS] Listing topics for user:", userID)
+
+	topics, err := h.store.ListTopics(r.Context(), userID, topicSampleThoughts)
+	if err != nil {
+		log.Printf("Error listing topics: %v", err)
+		http.Error(w, "Failed to list topics", http.StatusInternalServerError)
+		return
+	}
+
+	if topics == nil {
+		topics = []types.Topic{}
+	}
+	for _, topic := range topics {
+		h.signAttachments(r.Context(), topic.SampleThoughts)
+	}
+
+	response := types.ListTopicsResponse{
+		Topics: topics,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// scheduled task: reclusters users whose embeddings changed since their last run
+// one user failing doesn't stop the others
+func (h *Handler) clusterTopics(ctx context.Context) error {
+	userIDs, err := h.store.ListTopicCandidates(ctx, topicMinThoughts, topicReclusterInterval, topicUsersPerRun)
+	if err != nil {
+		return fmt.Errorf("failed to list topic candidates: %w", err)
+	}
+
+	failed := 0
+	for _, userID := range userIDs {
+		if err := h.clusterUserTopics(ctx, userID); err != nil {
+			log.Printf("[TOPICS] Error clustering thoughts for user %s: %v", userID, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to cluster topics for %d of %d user(s)", failed, len(userIDs))
+	}
+	return nil
+}
+
+func (h *Handler) clusterUserTopics(ctx context.Context, userID uuid.UUID) error {
+	start := time.Now()
+
+	clusteredAt := time.Now().UTC()
+	embeddings, err := h.store.ListEmbeddings(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	vectors := make([][]float32, len(embeddings))
+	for i, e := range embeddings {
+		vectors[i] = e.Embedding
+	}
+
+	// seeded by user so unchanged thoughts cluster the same way from run to run
+	rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(userID[:8]))))
+	k := utils.TopicCount(len(vectors), topicMinCount, topicMaxCount)
+	assignments, centroids := utils.KMeans(vectors, k, topicIterations, rng)
+
+	members := make([][]int, len(centroids))
+	for i, c := range assignments {
+		members[c] = append(members[c], i)
+	}
+
+	var clusters []topicCluster
+	for c, idx := range members {
+		if len(idx) < topicMinSize {
+			continue
+		}
+
+		// most representative first
+		sort.SliceStable(idx, func(a, b int) bool {
+			return utils.CosineSimilarity(vectors[idx[a]], centroids[c]) > utils.CosineSimilarity(vectors[idx[b]], centroids[c])
+		})
+
+		cluster := topicCluster{}
+		for _, i := range idx {
+			cluster.thoughtIDs = append(cluster.thoughtIDs, embeddings[i].ThoughtID)
+			if len(cluster.samples) < topicLabelSamples {
+				cluster.samples = append(cluster.samples, embeddings[i].Thought)
+			}
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	labels := h.labelTopics(ctx, clusters)
+
+	topics := make([]stores.NewTopic, len(clusters))
+	for i, cluster := range clusters {
+		topics[i] = stores.NewTopic{Label: labels[i], ThoughtIDs: cluster.thoughtIDs}
+	}
+
+	if err := h.store.ReplaceTopics(ctx, userID, topics, clusteredAt); err != nil {
+		return err
+	}
+
+	log.Printf("[TOPICS] Clustered %d thought(s) into %d topic(s) for user %s in %v", len(embeddings), len(topics), userID, time.Since(start))
+	return nil
+}
+
+// asks Gemini to name every cluster in one call; clusters it skips (or all of them, without a
+// generator or when the call fails) get a label from their hashtags or most representative thought
+func (h *Handler) labelTopics(ctx context.Context, clusters []topicCluster) []string {
+	labels := make([]string, len(clusters))
+	if len(clusters) == 0 {
+		return labels
+	}
+
+	if h.generator != nil {
+		var prompt strings.Builder
+		for i, cluster := range clusters {
+			fmt.Fprintf(&prompt, "Group %d:\n", i+1)
+			for _, sample := range cluster.samples {
+				fmt.Fprintf(&prompt, "- %s\n", truncateText(sample, topicLabelSampleChars))
+			}
+			prompt.WriteString("\n")
+		}
+
+		var generated struct {
+			Labels []struct {
+				Group int    `json:"group"`
+				Label string `json:"label"`
+			} `json:"labels"`
+		}
+		if err := h.generator.GenerateJSON(ctx, topicLabelInstructions, prompt.String(), &generated); err != nil {
+			log.Printf("[TOPICS] Error generating topic labels, falling back to keywords: %v", err)
+		} else {
+			for _, l := range generated.Labels {
+				if l.Group >= 1 && l.Group <= len(clusters) {
+					labels[l.Group-1] = strings.TrimSpace(l.Label)
+				}
+			}
+		}
+	}
+
+	for i, cluster := range clusters {
+		if labels[i] == "" {
+			labels[i] = fallbackTopicLabel(cluster.samples)
+		}
+	}
+	return labels
+}
+
+// the most common hashtag among the samples, or the start of the most representative one
+func fallbackTopicLabel(samples []string) string {
+	counts := make(map[string]int)
+	for _, sample := range samples {
+		for _, tag := range utils.ExtractHashtags(sample) {
+			counts[tag]++
+		}
+	}
+
+	best := ""
+	for tag, count := range counts {
+		if count > counts[best] || (count == counts[best] && tag < best) {
+			best = tag
+		}
+	}
+	if best != "" {
+		return "#" + best
+	}
+
+	return truncateText(strings.Join(strings.Fields(samples[0]), " "), 40)
+}
+
+// cuts at a word boundary where there is one
+func truncateText(text string, maxChars int) string {
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+
+	cut := string(runes[:maxChars])
+	if i := strings.LastIndex(cut, " "); i > maxChars/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
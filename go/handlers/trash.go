@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/skarokin/runsynapse/go/events"
+	"github.com/skarokin/runsynapse/go/stores"
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+const (
+	trashListLimit = 200
+
+	// thoughts purged per batch; the purge keeps going until a batch comes back short
+	purgeBatch      = 100
+	maxPurgeBatches = 10
+)
+
+func (h *Handler) restoreThought(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request types.RestoreThoughtRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	thoughtID, ok := parseThoughtID(w, request.ThoughtID)
+	if !ok {
+		return
+	}
+
+	log.Printf("[TRASH] Restoring thought %s for user %s", thoughtID, userID)
+
+	restored, err := h.store.RestoreThought(r.Context(), userID, thoughtID)
+	if errors.Is(err, stores.ErrThoughtNotFound) {
+		http.Error(w, "Thought not found in trash", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error restoring thought: %v", err)
+		http.Error(w, "Failed to restore thought", http.StatusInternalServerError)
+		return
+	}
+
+	h.publish(r.Context(), userID, events.ThoughtRestored, restored.ID)
+
+	h.signThought(r.Context(), restored)
+
+	response := types.RestoreThoughtResponse{
+		Thought: *restored,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) listTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	log.Println("[TRASH] Listing trash for user:", userID)
+
+	thoughts, err := h.store.ListTrash(r.Context(), userID, trashListLimit)
+	if err != nil {
+		log.Printf("Error listing trash: %v", err)
+		http.Error(w, "Failed to list trash", http.StatusInternalServerError)
+		return
+	}
+
+	if thoughts == nil {
+		thoughts = []types.Thought{}
+	}
+	h.signAttachments(r.Context(), thoughts)
+
+	response := types.ListTrashResponse{
+		Thoughts:      thoughts,
+		RetentionDays: int(h.trashRetention.Hours() / 24),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// hard-deletes thoughts that have been in the trash longer than the retention period, then their files
+// a file that fails to delete is only logged; the thought is already gone and can't be retried
+func (h *Handler) purgeTrash(ctx context.Context) error {
+	total := 0
+	for range maxPurgeBatches {
+		purged, err := h.store.PurgeTrash(ctx, h.trashRetention, purgeBatch)
+		if err != nil {
+			return fmt.Errorf("failed to purge trash: %w", err)
+		}
+
+		for _, p := range purged {
+			for _, key := range p.AttachmentKeys {
+				if key == "" {
+					continue
+				}
+				if err := h.blobs.Delete(ctx, key); err != nil {
+					log.Printf("[TRASH] Error deleting file for purged thought %s: %v", p.ThoughtID, err)
+				}
+			}
+		}
+
+		total += len(purged)
+		if len(purged) < purgeBatch {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("[TRASH] Purged %d thought(s)", total)
+	}
+	return nil
+}
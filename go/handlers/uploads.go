@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/skarokin/runsynapse/go/types"
+	"github.com/skarokin/runsynapse/go/utils"
+)
+
+const (
+	uploadURLExpiry    = 15 * time.Minute
+	uploadURLsMaxFiles = 10
+)
+
+// presigned PUT URLs so attachments go straight to the blob store instead of through the API, whose
+// request body is capped well below the maximum file size in Lambda
+func (h *Handler) createUploadURLs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request types.CreateUploadURLsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if len(request.Files) < 1 || len(request.Files) > uploadURLsMaxFiles {
+		http.Error(w, "files must contain between 1 and 10 files", http.StatusBadRequest)
+		return
+	}
+
+	// every file is checked so the client can show all the reasons at once
+	var rejected []types.RejectedFile
+	for _, file := range request.Files {
+		err := utils.ValidateUpload(file.FileName, file.ContentType, file.Size)
+		var rejection *utils.RejectedFilesError
+		if errors.As(err, &rejection) {
+			rejected = append(rejected, rejection.Files...)
+		}
+	}
+	if len(rejected) > 0 {
+		writeRejectedFiles(w, rejected)
+		return
+	}
+
+	log.Printf("[UPLOAD] Creating %d upload URL(s) for user %s", len(request.Files), userID)
+
+	expiresAt := time.Now().Add(uploadURLExpiry)
+	uploads := make([]types.UploadURL, 0, len(request.Files))
+	for _, file := range request.Files {
+		key := utils.NewUploadKey(userID, file.FileName)
+		url, err := h.blobs.PresignPut(r.Context(), key, file.ContentType, file.Size, uploadURLExpiry)
+		if err != nil {
+			log.Printf("Error presigning upload: %v", err)
+			http.Error(w, "Failed to create upload URLs", http.StatusInternalServerError)
+			return
+		}
+
+		uploads = append(uploads, types.UploadURL{
+			FileName:  file.FileName,
+			Key:       key,
+			URL:       url,
+			Method:    http.MethodPut,
+			Headers:   map[string]string{"Content-Type": file.ContentType},
+			ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	response := types.CreateUploadURLsResponse{
+		Uploads: uploads,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// a 400 listing each refused file with a machine-readable reason, instead of a plain-text error
+func writeRejectedFiles(w http.ResponseWriter, files []types.RejectedFile) {
+	log.Printf("[UPLOAD] Rejected %d file(s)", len(files))
+
+	response := types.RejectedFilesResponse{
+		Error:         "Some files were rejected",
+		RejectedFiles: files,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
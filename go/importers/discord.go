@@ -0,0 +1,122 @@
+package importers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// source name stored on thoughts imported from Discord; their source IDs are message IDs
+const SourceDiscord = "discord"
+
+// the server downloads attachments only from Discord's own CDN, anything else in an uploaded
+// file could point it at internal addresses
+var discordMediaHosts = map[string]bool{
+	"cdn.discordapp.com":   true,
+	"media.discordapp.net": true,
+}
+
+// the parts of a DiscordChatExporter JSON export the importer uses
+type discordExport struct {
+	Messages []discordMessage `json:"messages"`
+}
+
+type discordMessage struct {
+	ID          string              `json:"id"`
+	Type        string              `json:"type"`
+	Timestamp   string              `json:"timestamp"`
+	Content     string              `json:"content"`
+	Attachments []discordAttachment `json:"attachments"`
+}
+
+type discordAttachment struct {
+	URL      string `json:"url"`
+	FileName string `json:"fileName"`
+}
+
+// ParseDiscord reads a DiscordChatExporter JSON export of one channel into items, oldest first
+// messages exported with --media link their attachments by path relative to the export; those are
+// opened from mediaDir, or fail to open when it's empty (uploads to the server can't include them)
+// system messages (joins, pins, calls...) and messages with neither text nor attachments are left out
+func ParseDiscord(r io.Reader, mediaDir string) ([]Item, error) {
+	var export discordExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("invalid Discord export: %w", err)
+	}
+
+	var items []Item
+	for _, m := range export.Messages {
+		if m.Type != "Default" && m.Type != "Reply" {
+			continue
+		}
+		if m.ID == "" {
+			return nil, fmt.Errorf("invalid Discord export: message without an id")
+		}
+
+		createdAt, err := time.Parse(time.RFC3339Nano, m.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp on message %s: %w", m.ID, err)
+		}
+
+		item := Item{
+			SourceID:  m.ID,
+			Text:      strings.TrimSpace(m.Content),
+			CreatedAt: createdAt,
+		}
+
+		var fileNames []string
+		for _, a := range m.Attachments {
+			fileName := a.FileName
+			if fileName == "" {
+				fileName = path.Base(a.URL)
+			}
+			fileNames = append(fileNames, fileName)
+			item.Attachments = append(item.Attachments, Attachment{
+				FileName: fileName,
+				Open:     discordOpener(a.URL, mediaDir),
+			})
+		}
+
+		// thoughts need text, an attachment-only message is named after its files
+		if item.Text == "" {
+			item.Text = strings.Join(fileNames, ", ")
+		}
+		if item.Text == "" {
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func discordOpener(rawURL string, mediaDir string) func(ctx context.Context) (io.ReadCloser, error) {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		if u, err := url.Parse(rawURL); err == nil && (u.Scheme == "https" || u.Scheme == "http") {
+			if !discordMediaHosts[u.Hostname()] {
+				return nil, fmt.Errorf("not a Discord attachment URL: %s", rawURL)
+			}
+			return openURL(ctx, rawURL)
+		}
+
+		if mediaDir == "" {
+			return nil, fmt.Errorf("attachment %s was exported as a local file, import from the command line instead", rawURL)
+		}
+
+		// DiscordChatExporter escapes the relative paths like URLs, and uses backslashes on Windows
+		name, err := url.PathUnescape(rawURL)
+		if err != nil {
+			name = rawURL
+		}
+		name = strings.ReplaceAll(name, `\`, "/")
+		return os.Open(filepath.Join(mediaDir, filepath.FromSlash(name)))
+	}
+}
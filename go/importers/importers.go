@@ -0,0 +1,45 @@
+package importers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Item is one thought to import, whatever app it came from; handlers.ImportItems turns it into a thought
+type Item struct {
+	SourceID    string // stable within the source, importing the same ID twice is a no-op
+	Text        string
+	CreatedAt   time.Time
+	Attachments []Attachment
+}
+
+// Attachment is opened only when its item is actually imported, so re-running an import doesn't
+// download everything again
+type Attachment struct {
+	FileName string
+	Open     func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// attachments linked by URL (e.g. Discord's CDN) are downloaded with this
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func openURL(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+
+	return resp.Body, nil
+}
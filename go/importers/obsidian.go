@@ -0,0 +1,496 @@
+package importers
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skarokin/runsynapse/go/types"
+	"github.com/skarokin/runsynapse/go/utils"
+)
+
+// source name stored on thoughts imported from Obsidian; their source IDs are note paths inside the
+// vault, with "#heading" appended for the sections of a daily note
+const SourceObsidian = "obsidian"
+
+const maxNoteSize = 1 << 20 // larger markdown files are skipped, they're unlikely to be hand-written notes
+
+var (
+	// ![[image.png]], ![[folder/image.png|300]]
+	wikiEmbedPattern = regexp.MustCompile(`!\[\[([^\]|#^]+)(?:[|#^][^\]]*)?\]\]`)
+	// ![alt](image.png), ![alt](<my image.png> "title")
+	markdownEmbedPattern = regexp.MustCompile(`!\[[^\]]*\]\((?:<([^>]+)>|([^)\s]+))(?:\s+"[^"]*")?\)`)
+
+	headingPattern     = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*$`)
+	headingDatePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})(?:[ T](\d{1,2}:\d{2}))?\b`)
+	headingTimePattern = regexp.MustCompile(`^(\d{1,2}:\d{2})\b`)
+	blankLinesPattern  = regexp.MustCompile(`\n{3,}`)
+)
+
+// front-matter keys holding a note's creation time, most specific first
+var createdKeys = []string{"created", "created_at", "date created", "date"}
+
+// front-matter timestamps Obsidian and its plugins write; all but the first are in the import's timezone
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.DateOnly,
+}
+
+type vault struct {
+	files  map[string]*zip.File // by path inside the vault
+	byName map[string][]string  // lowercased file name -> paths, for links by name
+	loc    *time.Location
+}
+
+// ParseObsidian reads a zipped Obsidian (or any Markdown) vault into items, oldest first
+// a note becomes one item, unless it has headings starting with a date ("## 2024-05-01") or, in a daily
+// note named by its date or with a date in its front matter, a time ("## 09:30"): then every such
+// section is an item of its own, timestamped by its heading. otherwise the time comes from the front
+// matter, the daily note's name or the file's modification time, and dates without a zone are in loc
+// front-matter tags are added to the text as hashtags, and embedded files (![[x.png]], ![](x.png))
+// found in the zip become attachments; hidden folders like .obsidian and .trash are left out
+func ParseObsidian(zr *zip.Reader, loc *time.Location) []Item {
+	v := &vault{
+		files:  make(map[string]*zip.File),
+		byName: make(map[string][]string),
+		loc:    loc,
+	}
+
+	root := vaultRoot(zr.File)
+	var notes []string
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := strings.TrimPrefix(strings.ReplaceAll(f.Name, `\`, "/"), root)
+		if hiddenPath(name) {
+			continue
+		}
+
+		v.files[name] = f
+		lower := strings.ToLower(path.Base(name))
+		v.byName[lower] = append(v.byName[lower], name)
+		if isMarkdown(name) {
+			notes = append(notes, name)
+		}
+	}
+	sort.Strings(notes)
+
+	var items []Item
+	for _, name := range notes {
+		noteItems, err := v.parseNote(name)
+		if err != nil {
+			log.Printf("[IMPORT] Skipping note %s: %v", name, err)
+			continue
+		}
+		items = append(items, noteItems...)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items
+}
+
+func (v *vault) parseNote(name string) ([]Item, error) {
+	f := v.files[name]
+	if f.UncompressedSize64 > maxNoteSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxNoteSize)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxNoteSize))
+	if err != nil {
+		return nil, err
+	}
+
+	frontMatter, body := splitFrontMatter(strings.ReplaceAll(string(data), "\r\n", "\n"))
+	title := strings.TrimSuffix(path.Base(name), path.Ext(name))
+
+	// time-only headings need a day to go with, which only a daily note or its front matter gives
+	created, hasDay := time.Time{}, false
+	for _, key := range createdKeys {
+		if values := frontMatter[key]; len(values) > 0 {
+			if t, ok := parseTimestamp(values[0], v.loc); ok {
+				created, hasDay = t, true
+				break
+			}
+		}
+	}
+	daily, err := time.ParseInLocation(time.DateOnly, title, v.loc)
+	isDaily := err == nil
+	if !hasDay && isDaily {
+		created, hasDay = daily, true
+	}
+	if !hasDay {
+		created = modified(f, v.loc)
+	}
+
+	var tags []string
+	for _, key := range []string{"tags", "tag"} {
+		for _, value := range frontMatter[key] {
+			for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+				if tag = types.NormalizeTag(tag); tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+
+	noteDir := path.Dir(name)
+	intro, sections := splitDatedSections(body, created, hasDay, v.loc)
+
+	var items []Item
+	// the daily note's name is just its date, anything else is worth keeping as the first line
+	if intro = strings.TrimSpace(intro); intro != "" {
+		if !isDaily && !startsWithTitle(intro, title) {
+			intro = strings.TrimSpace(title + "\n\n" + intro)
+		}
+		if item, ok := v.item(name, intro, created, noteDir, tags); ok {
+			items = append(items, item)
+		}
+	}
+
+	seen := make(map[string]int)
+	for _, s := range sections {
+		// repeated headings in one note still need distinct source IDs
+		sourceID := name + "#" + s.heading
+		if seen[s.heading]++; seen[s.heading] > 1 {
+			sourceID = fmt.Sprintf("%s (%d)", sourceID, seen[s.heading])
+		}
+		if item, ok := v.item(sourceID, s.text, s.createdAt, noteDir, tags); ok {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// turns embeds into attachments and front-matter tags into hashtags; false if nothing is left to import
+func (v *vault) item(sourceID string, text string, createdAt time.Time, noteDir string, tags []string) (Item, bool) {
+	text, attachments := v.extractEmbeds(text, noteDir)
+	text = strings.TrimSpace(blankLinesPattern.ReplaceAllString(text, "\n\n"))
+
+	if text == "" {
+		var fileNames []string
+		for _, a := range attachments {
+			fileNames = append(fileNames, a.FileName)
+		}
+		text = strings.Join(fileNames, ", ")
+	}
+	if text == "" {
+		return Item{}, false
+	}
+
+	present := make(map[string]bool)
+	for _, tag := range utils.ExtractHashtags(text) {
+		present[tag] = true
+	}
+	var missing []string
+	for _, tag := range tags {
+		if !present[tag] {
+			present[tag] = true
+			missing = append(missing, "#"+tag)
+		}
+	}
+	if len(missing) > 0 {
+		text += "\n\n" + strings.Join(missing, " ")
+	}
+
+	return Item{
+		SourceID:    sourceID,
+		Text:        text,
+		CreatedAt:   createdAt,
+		Attachments: attachments,
+	}, true
+}
+
+// removes embeds of files in the vault from text and returns them as attachments; embedded notes,
+// external images and files that aren't in the zip stay in the text as written
+func (v *vault) extractEmbeds(text string, noteDir string) (string, []Attachment) {
+	var attachments []Attachment
+	attached := make(map[string]bool)
+
+	embed := func(match string, target string) string {
+		p, ok := v.resolve(target, noteDir)
+		if !ok || isMarkdown(p) {
+			return match
+		}
+		if !attached[p] {
+			attached[p] = true
+			f := v.files[p]
+			attachments = append(attachments, Attachment{
+				FileName: path.Base(p),
+				Open: func(ctx context.Context) (io.ReadCloser, error) {
+					return f.Open()
+				},
+			})
+		}
+		return ""
+	}
+
+	text = wikiEmbedPattern.ReplaceAllStringFunc(text, func(match string) string {
+		return embed(match, wikiEmbedPattern.FindStringSubmatch(match)[1])
+	})
+	text = markdownEmbedPattern.ReplaceAllStringFunc(text, func(match string) string {
+		m := markdownEmbedPattern.FindStringSubmatch(match)
+		target := m[1] + m[2]
+		if strings.Contains(target, "://") {
+			return match
+		}
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			target = unescaped
+		}
+		return embed(match, target)
+	})
+
+	return text, attachments
+}
+
+// finds a link target the way Obsidian does: relative to the note, from the vault root, or by the
+// shortest path ending in it (usually just the file name)
+func (v *vault) resolve(target string, noteDir string) (string, bool) {
+	target = strings.TrimPrefix(strings.TrimSpace(target), "/")
+	if target == "" {
+		return "", false
+	}
+
+	for _, p := range []string{path.Join(noteDir, target), path.Clean(target)} {
+		if _, ok := v.files[p]; ok {
+			return p, true
+		}
+	}
+
+	suffix := "/" + strings.ToLower(path.Clean(target))
+	best := ""
+	for _, p := range v.byName[strings.ToLower(path.Base(target))] {
+		if !strings.HasSuffix("/"+strings.ToLower(p), suffix) {
+			continue
+		}
+		if best == "" || strings.Count(p, "/") < strings.Count(best, "/") || (strings.Count(p, "/") == strings.Count(best, "/") && p < best) {
+			best = p
+		}
+	}
+	return best, best != ""
+}
+
+type datedSection struct {
+	heading   string
+	createdAt time.Time
+	text      string
+}
+
+// splits body at headings that start with a date, or with a time when the note has a day; returns the
+// text before the first of them and the sections, each headed by whatever followed the date on its line
+func splitDatedSections(body string, day time.Time, hasDay bool, loc *time.Location) (string, []datedSection) {
+	var intro strings.Builder
+	var sections []datedSection
+	var texts []*strings.Builder
+
+	inFence := false
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+
+		if !inFence {
+			if m := headingPattern.FindStringSubmatch(line); m != nil {
+				if createdAt, rest, ok := headingTime(m[1], day, hasDay, loc); ok {
+					sections = append(sections, datedSection{heading: m[1], createdAt: createdAt})
+					texts = append(texts, &strings.Builder{})
+					if rest != "" {
+						texts[len(texts)-1].WriteString(rest + "\n\n")
+					}
+					continue
+				}
+			}
+		}
+
+		if len(texts) == 0 {
+			intro.WriteString(line + "\n")
+		} else {
+			texts[len(texts)-1].WriteString(line + "\n")
+		}
+	}
+
+	for i := range sections {
+		sections[i].text = texts[i].String()
+	}
+	return intro.String(), sections
+}
+
+// the time a heading starts with and the rest of it, e.g. "2024-05-01 10:00 - standup" -> 10:00, "standup"
+func headingTime(heading string, day time.Time, hasDay bool, loc *time.Location) (time.Time, string, bool) {
+	var t time.Time
+	var err error
+	var matched string
+
+	if m := headingDatePattern.FindStringSubmatch(heading); m != nil {
+		matched = m[0]
+		if m[2] != "" {
+			t, err = time.ParseInLocation("2006-01-02 15:04", m[1]+" "+m[2], loc)
+		} else {
+			t, err = time.ParseInLocation(time.DateOnly, m[1], loc)
+		}
+	} else if m := headingTimePattern.FindStringSubmatch(heading); m != nil && hasDay {
+		matched = m[0]
+		var clock time.Time
+		clock, err = time.Parse("15:04", m[1])
+		day = day.In(loc)
+		t = time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	} else {
+		return time.Time{}, "", false
+	}
+	if err != nil {
+		return time.Time{}, "", false
+	}
+
+	rest := strings.TrimLeft(heading[len(matched):], " -–—:")
+	return t, strings.TrimSpace(rest), true
+}
+
+// the YAML front matter between --- lines at the top of a note, as lowercased key -> values, and the
+// rest of the note; only the flat forms Obsidian writes itself are understood ("key: value",
+// "key: [a, b]" and "key:" followed by "- item" lines), anything nested is ignored
+func splitFrontMatter(text string) (map[string][]string, string) {
+	lines := strings.Split(text, "\n")
+	if strings.TrimSpace(lines[0]) != "---" {
+		return nil, text
+	}
+
+	closing := -1
+	for i := 1; i < len(lines); i++ {
+		if trimmed := strings.TrimSpace(lines[i]); trimmed == "---" || trimmed == "..." {
+			closing = i
+			break
+		}
+	}
+	if closing == -1 {
+		return nil, text
+	}
+
+	frontMatter := make(map[string][]string)
+	key := ""
+	for _, line := range lines[1:closing] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "-") {
+			if key != "" {
+				if item := unquote(strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))); item != "" {
+					frontMatter[key] = append(frontMatter[key], item)
+				}
+			}
+			continue
+		}
+
+		k, value, ok := strings.Cut(line, ":")
+		if !ok || line[0] == ' ' || line[0] == '\t' {
+			key = ""
+			continue
+		}
+
+		key = strings.ToLower(strings.TrimSpace(k))
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquote(strings.TrimSpace(item)); item != "" {
+					frontMatter[key] = append(frontMatter[key], item)
+				}
+			}
+		} else if value = unquote(value); value != "" {
+			frontMatter[key] = []string{value}
+		}
+	}
+
+	return frontMatter, strings.Join(lines[closing+1:], "\n")
+}
+
+// archive/zip reports MS-DOS modification times, which are local wall clock times, in UTC; only the
+// extended timestamp some zip tools add is an actual instant
+func modified(f *zip.File, loc *time.Location) time.Time {
+	t := f.Modified
+	if t.IsZero() {
+		return time.Now()
+	}
+	if t.Location() == time.UTC {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+	}
+	return t
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func parseTimestamp(s string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// a note that opens with its own title (often as a heading) doesn't need it added again
+func startsWithTitle(text string, title string) bool {
+	firstLine, _, _ := strings.Cut(text, "\n")
+	firstLine = strings.TrimSpace(strings.TrimLeft(firstLine, "#"))
+	return strings.EqualFold(firstLine, title)
+}
+
+// zips made by compressing the vault folder put everything under one directory
+func vaultRoot(files []*zip.File) string {
+	root := ""
+	for i, f := range files {
+		name := strings.ReplaceAll(f.Name, `\`, "/")
+		first, _, found := strings.Cut(name, "/")
+		if !found {
+			return ""
+		}
+		if i == 0 {
+			root = first + "/"
+		} else if first+"/" != root {
+			return ""
+		}
+	}
+	return root
+}
+
+// .obsidian (settings), .trash, .git and the like, and macOS zip metadata
+func hiddenPath(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") || segment == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+func isMarkdown(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
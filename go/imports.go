@@ -0,0 +1,86 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/handlers"
+	"github.com/skarokin/runsynapse/go/importers"
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+const importUsage = "usage: import-discord -user <user id> <export.json> | import-obsidian -user <user id> [-timezone <zone>] <vault.zip>"
+
+// go run . import-discord -user <user id> <export.json>
+// go run . import-obsidian -user <user id> [-timezone <zone>] <vault.zip>
+// for files too big for /importDiscord and /importObsidian, and Discord exports made with --media, whose
+// attachments are read from the files next to the export. uses the same stores and blob store as the
+// server, so run it with its environment
+func runImport(handler *handlers.Handler, command string, args []string) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	userIDFlag := flags.String("user", "", "ID of the user to import the thoughts for")
+	timezoneFlag := flags.String("timezone", "UTC", "timezone of the dates and times written in Obsidian notes")
+	flags.Parse(args)
+
+	if *userIDFlag == "" || flags.NArg() != 1 {
+		log.Fatal(importUsage)
+	}
+
+	userID, err := uuid.Parse(*userIDFlag)
+	if err != nil {
+		log.Fatalf("Invalid user ID: %s", *userIDFlag)
+	}
+
+	path := flags.Arg(0)
+	var source string
+	var items []importers.Item
+	switch command {
+	case "import-discord":
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open export: %v", err)
+		}
+		defer file.Close()
+
+		source = importers.SourceDiscord
+		items, err = importers.ParseDiscord(file, filepath.Dir(path))
+		if err != nil {
+			log.Fatalf("Failed to parse export: %v", err)
+		}
+	case "import-obsidian":
+		loc, err := time.LoadLocation(*timezoneFlag)
+		if err != nil {
+			log.Fatalf("Invalid timezone: %s", *timezoneFlag)
+		}
+
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			log.Fatalf("Failed to open vault zip: %v", err)
+		}
+		defer zr.Close()
+
+		source = importers.SourceObsidian
+		items = importers.ParseObsidian(&zr.Reader, loc)
+	default:
+		log.Fatal(importUsage)
+	}
+
+	log.Printf("Importing %d item(s) for user %s", len(items), userID)
+
+	progress, err := handler.ImportItems(context.Background(), userID, source, items, func(p types.ImportProgress) {
+		log.Printf("%d/%d processed: %d created, %d skipped, %d failed, %d attachment(s) failed",
+			p.Processed, p.Total, p.Created, p.Skipped, p.Failed, p.FailedAttachments)
+	})
+	if err != nil {
+		log.Fatalf("Import stopped after %d of %d item(s): %v", progress.Processed, progress.Total, err)
+	}
+
+	log.Printf("Import finished: %d created, %d skipped, %d failed", progress.Created, progress.Skipped, progress.Failed)
+}
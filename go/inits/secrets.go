@@ -4,15 +4,38 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+
+	"github.com/skarokin/runsynapse/go/utils"
 )
 
 type Secrets struct {
+	ThoughtStore     string
 	DatabaseURL      string
+	EventsDatabaseURL string
+	Embedder         string
 	GeminiAPIKey   	 string
+	BlobStore        string
 	S3Region		 string
 	S3Bucket		 string
+	LocalBlobDir     string
+	LocalBlobURL     string
+	EmbeddingQueue   string
+	SQSQueueURL      string
+	SearchFusion     utils.FusionConfig
+	TrashRetention   time.Duration
+	AttachmentURLExpiry time.Duration
+	SupabaseJWTSecret   string
+	SupabaseJWKSURL     string
+	SupabaseJWTIssuer   string
+	SupabaseJWTAudience string
+	AuthDevBypass       bool
+	ServiceAPIKeys      []string
+	ServiceAuthMode     string
 }
 
 func InitSecrets() (*Secrets, error) {
@@ -21,30 +44,205 @@ func InitSecrets() (*Secrets, error) {
 		log.Println("Error loading .env file, trying with inline environment variables anyway")
 	}
 
+	// "postgres" (default) or "memory" for local development without Supabase
+	thoughtStore := os.Getenv("THOUGHT_STORE")
+	if thoughtStore == "" {
+		thoughtStore = "postgres"
+	}
+	if thoughtStore != "postgres" && thoughtStore != "memory" {
+		return nil, fmt.Errorf("THOUGHT_STORE must be one of: postgres, memory")
+	}
+
 	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
+	if databaseURL == "" && thoughtStore == "postgres" {
 		return nil, fmt.Errorf("DATABASE_URL environment variable is required")
 	}
 
+	// LISTEN for /events needs a session connection, which Supabase's transaction pooler doesn't give;
+	// set this to the direct (or session pooler) URL when DATABASE_URL points at the transaction pooler
+	eventsDatabaseURL := os.Getenv("EVENTS_DATABASE_URL")
+	if eventsDatabaseURL == "" {
+		eventsDatabaseURL = databaseURL
+	}
+
+	// "gemini" (default) or "hash" for a deterministic offline embedder
+	embedder := os.Getenv("EMBEDDER")
+	if embedder == "" {
+		embedder = "gemini"
+	}
+	if embedder != "gemini" && embedder != "hash" {
+		return nil, fmt.Errorf("EMBEDDER must be one of: gemini, hash")
+	}
+
 	geminiAPIKey := os.Getenv("GEMINI_API_KEY")
-	if geminiAPIKey == "" {
+	if geminiAPIKey == "" && embedder == "gemini" {
 		return nil, fmt.Errorf("GEMINI_API_KEY environment variable is required")
 	}
 
+	// "s3" (default) or "local" to keep attachments on disk during development
+	blobStore := os.Getenv("BLOB_STORE")
+	if blobStore == "" {
+		blobStore = "s3"
+	}
+	if blobStore != "s3" && blobStore != "local" {
+		return nil, fmt.Errorf("BLOB_STORE must be one of: s3, local")
+	}
+
 	s3Region := os.Getenv("S3_REGION")
-	if s3Region == "" {
+	if s3Region == "" && blobStore == "s3" {
 		return nil, fmt.Errorf("S3_REGION environment variable is required")
 	}
 
 	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
+	if s3Bucket == "" && blobStore == "s3" {
 		return nil, fmt.Errorf("S3_BUCKET environment variable is required")
 	}
 
+	// only used by the local blob store; the URL defaults to the dev server (see main.go)
+	localBlobDir := os.Getenv("LOCAL_BLOB_DIR")
+	if localBlobDir == "" {
+		localBlobDir = "blobs"
+	}
+	localBlobURL := os.Getenv("LOCAL_BLOB_URL")
+
+	// "local" (default) runs embedding workers in process, "sqs" hands jobs to the SQS-triggered Lambda.
+	// Lambda freezes or kills in-process workers between invocations, so it defaults to sqs there and
+	// local is refused
+	inLambda := os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != ""
+	embeddingQueue := os.Getenv("EMBEDDING_QUEUE")
+	if embeddingQueue == "" {
+		embeddingQueue = "local"
+		if inLambda {
+			embeddingQueue = "sqs"
+		}
+	}
+	if embeddingQueue != "local" && embeddingQueue != "sqs" {
+		return nil, fmt.Errorf("EMBEDDING_QUEUE must be one of: local, sqs")
+	}
+	if embeddingQueue == "local" && inLambda {
+		return nil, fmt.Errorf("EMBEDDING_QUEUE=local cannot be used in AWS Lambda")
+	}
+
+	sqsQueueURL := os.Getenv("SQS_QUEUE_URL")
+	if sqsQueueURL == "" && embeddingQueue == "sqs" {
+		return nil, fmt.Errorf("SQS_QUEUE_URL environment variable is required")
+	}
+
+	// rank fusion weights for hybrid search, see utils.DefaultFusionConfig
+	searchFusion := utils.DefaultFusionConfig()
+	for name, target := range map[string]*float64{
+		"SEARCH_FTS_WEIGHT":    &searchFusion.FullTextWeight,
+		"SEARCH_VECTOR_WEIGHT": &searchFusion.VectorWeight,
+		"SEARCH_RRF_K":         &searchFusion.K,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative number", name)
+		}
+		*target = parsed
+	}
+
+	// deleted thoughts can be restored for this many days before the scheduled purge removes them
+	trashRetentionDays := 30
+	if value := os.Getenv("TRASH_RETENTION_DAYS"); value != "" {
+		trashRetentionDays, err = strconv.Atoi(value)
+		if err != nil || trashRetentionDays < 1 {
+			return nil, fmt.Errorf("TRASH_RETENTION_DAYS must be a positive number of days")
+		}
+	}
+
+	// attachments are private; responses carry presigned URLs that work for this many minutes
+	// (S3 allows at most 7 days)
+	attachmentURLExpiryMinutes := 60
+	if value := os.Getenv("ATTACHMENT_URL_EXPIRY_MINUTES"); value != "" {
+		attachmentURLExpiryMinutes, err = strconv.Atoi(value)
+		if err != nil || attachmentURLExpiryMinutes < 1 || attachmentURLExpiryMinutes > 7*24*60 {
+			return nil, fmt.Errorf("ATTACHMENT_URL_EXPIRY_MINUTES must be between 1 and 10080")
+		}
+	}
+
+	// Supabase access tokens are verified with the legacy shared secret (HS256), the project's
+	// JWKS (RS256/ES256 signing keys), or both while migrating between the two
+	supabaseJWTSecret := os.Getenv("SUPABASE_JWT_SECRET")
+	supabaseJWKSURL := os.Getenv("SUPABASE_JWKS_URL")
+	supabaseJWTIssuer := os.Getenv("SUPABASE_JWT_ISSUER")
+	supabaseJWTAudience := os.Getenv("SUPABASE_JWT_AUDIENCE")
+	if supabaseJWTAudience == "" {
+		supabaseJWTAudience = "authenticated"
+	}
+
+	// comma separated so a new key can be added before the old one is removed
+	var serviceAPIKeys []string
+	for _, key := range strings.Split(os.Getenv("SERVICE_API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			serviceAPIKeys = append(serviceAPIKeys, key)
+		}
+	}
+
+	// "key" (default) compares X-API-Key, "hmac" expects signed timestamps instead (see auth.ServiceAuthenticator)
+	serviceAuthMode := os.Getenv("SERVICE_AUTH_MODE")
+	if serviceAuthMode == "" {
+		serviceAuthMode = "key"
+	}
+	if serviceAuthMode != "key" && serviceAuthMode != "hmac" {
+		return nil, fmt.Errorf("SERVICE_AUTH_MODE must be one of: key, hmac")
+	}
+
+	// skips service credentials and lets local tools pick a user with the X-Dev-User-ID header, never allowed in Lambda
+	authDevBypass := os.Getenv("AUTH_DEV_BYPASS") == "true"
+	if authDevBypass && inLambda {
+		return nil, fmt.Errorf("AUTH_DEV_BYPASS cannot be enabled in AWS Lambda")
+	}
+
+	if supabaseJWTSecret == "" && supabaseJWKSURL == "" && !authDevBypass {
+		return nil, fmt.Errorf("SUPABASE_JWT_SECRET or SUPABASE_JWKS_URL environment variable is required")
+	}
+
+	if len(serviceAPIKeys) == 0 && !authDevBypass {
+		return nil, fmt.Errorf("SERVICE_API_KEYS environment variable is required")
+	}
+
 	return &Secrets{
+		ThoughtStore: thoughtStore,
 		DatabaseURL: databaseURL,
+		EventsDatabaseURL: eventsDatabaseURL,
+		Embedder: embedder,
 		GeminiAPIKey: geminiAPIKey,
+		BlobStore: blobStore,
 		S3Region: s3Region,
 		S3Bucket: s3Bucket,
+		LocalBlobDir: localBlobDir,
+		LocalBlobURL: localBlobURL,
+		EmbeddingQueue: embeddingQueue,
+		SQSQueueURL: sqsQueueURL,
+		SearchFusion: searchFusion,
+		TrashRetention: time.Duration(trashRetentionDays) * 24 * time.Hour,
+		AttachmentURLExpiry: time.Duration(attachmentURLExpiryMinutes) * time.Minute,
+		SupabaseJWTSecret: supabaseJWTSecret,
+		SupabaseJWKSURL: supabaseJWKSURL,
+		SupabaseJWTIssuer: supabaseJWTIssuer,
+		SupabaseJWTAudience: supabaseJWTAudience,
+		AuthDevBypass: authDevBypass,
+		ServiceAPIKeys: serviceAPIKeys,
+		ServiceAuthMode: serviceAuthMode,
 	}, nil
-}
\ No newline at end of file
+}
+
+// the migrate subcommand only needs the database, so it doesn't require the rest of the secrets
+func InitDatabaseURL() (string, error) {
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("Error loading .env file, trying with inline environment variables anyway")
+	}
+
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		return "", fmt.Errorf("DATABASE_URL environment variable is required")
+	}
+
+	return databaseURL, nil
+}
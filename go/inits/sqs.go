@@ -0,0 +1,19 @@
+package inits
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// region comes from the environment (AWS_REGION is always set inside Lambda)
+func NewSQSClient() (*sqs.Client, error) {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return sqs.NewFromConfig(cfg), nil
+}
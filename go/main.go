@@ -4,55 +4,221 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"context"
 	"os"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-lambda-go/events"
+	"google.golang.org/genai"
 
+	"github.com/skarokin/runsynapse/go/auth"
+	thoughtevents "github.com/skarokin/runsynapse/go/events"
 	"github.com/skarokin/runsynapse/go/inits"
 	"github.com/skarokin/runsynapse/go/handlers"
+	"github.com/skarokin/runsynapse/go/queues"
+	"github.com/skarokin/runsynapse/go/stores"
+	"github.com/skarokin/runsynapse/go/utils"
+)
+
+const (
+	localQueueBuffer      = 1000
+	localQueueWorkers     = 4
+	localQueueMaxAttempts = 5
+	schedulerInterval     = 5 * time.Minute
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	secrets, err := inits.InitSecrets()
 	if err != nil {
 		log.Fatalf("Failed to initialize secrets: %v", err)
 	}
 
-	supabaseClient, err := inits.NewSupabaseClient(secrets.DatabaseURL) 
-	if err != nil {
-		log.Fatalf("Failed to create Supabase client: %v", err)
-	}
-	defer supabaseClient.Close()
+	// events go through the same database as the thoughts, so other instances see them too
+	var store stores.ThoughtStore
+	var broker thoughtevents.Broker
+	var postgresBroker *thoughtevents.PostgresBroker
+	if secrets.ThoughtStore == "memory" {
+		log.Println("Using in-memory thought store (nothing will be persisted)")
+		store = stores.NewMemoryStore()
+		broker = thoughtevents.NewMemoryBroker()
+	} else {
+		supabaseClient, err := inits.NewSupabaseClient(secrets.DatabaseURL)
+		if err != nil {
+			log.Fatalf("Failed to create Supabase client: %v", err)
+		}
+		defer supabaseClient.Close()
 
-	geminiClient, err := inits.NewGeminiClient(secrets.GeminiAPIKey)
-	if err != nil {
-		log.Fatalf("Failed to create Gemini client: %v", err)
+		store = stores.NewPostgresStore(supabaseClient)
+
+		postgresBroker, err = thoughtevents.NewPostgresBroker(supabaseClient, secrets.EventsDatabaseURL)
+		if err != nil {
+			log.Fatalf("Failed to create event broker: %v", err)
+		}
+		broker = postgresBroker
 	}
 
-	s3Client, err := inits.NewS3Client(secrets.S3Region)
-	if err != nil {
-		log.Fatalf("Failed to create S3 client: %v", err)
+	// answer generation needs Gemini even when embeddings are offline, so it's skipped without a key
+	var geminiClient *genai.Client
+	var generator utils.Generator
+	if secrets.GeminiAPIKey != "" {
+		geminiClient, err = inits.NewGeminiClient(secrets.GeminiAPIKey)
+		if err != nil {
+			log.Fatalf("Failed to create Gemini client: %v", err)
+		}
+
+		generator = utils.NewGeminiGenerator(geminiClient)
+	} else {
+		log.Println("No GEMINI_API_KEY, answer generation is disabled")
 	}
 
-	handler := handlers.NewHandler(supabaseClient, geminiClient, s3Client, secrets.S3Bucket)
+	var embedder utils.Embedder
+	if secrets.Embedder == "hash" {
+		log.Println("Using offline hash embedder (search quality will be poor)")
+		embedder = utils.NewHashEmbedder(utils.EmbeddingDimensions)
+	} else {
+		embedder = utils.NewGeminiEmbedder(geminiClient)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	var blobs utils.BlobStore
+	if secrets.BlobStore == "local" {
+		blobURL := secrets.LocalBlobURL
+		if blobURL == "" {
+			blobURL = "http://localhost:" + port
+		}
+
+		log.Printf("Using local blob store in '%s'", secrets.LocalBlobDir)
+		blobs, err = utils.NewLocalBlobStore(secrets.LocalBlobDir, blobURL)
+		if err != nil {
+			log.Fatalf("Failed to create local blob store: %v", err)
+		}
+	} else {
+		s3Client, err := inits.NewS3Client(secrets.S3Region)
+		if err != nil {
+			log.Fatalf("Failed to create S3 client: %v", err)
+		}
+
+		blobs = utils.NewS3BlobStore(s3Client, secrets.S3Bucket)
+	}
+
+	var embeddingQueue queues.EmbeddingQueue
+	var localQueue *queues.LocalQueue
+	if secrets.EmbeddingQueue == "sqs" {
+		sqsClient, err := inits.NewSQSClient()
+		if err != nil {
+			log.Fatalf("Failed to create SQS client: %v", err)
+		}
+
+		embeddingQueue = queues.NewSQSQueue(sqsClient, secrets.SQSQueueURL)
+	} else {
+		localQueue = queues.NewLocalQueue(localQueueBuffer, localQueueMaxAttempts)
+		embeddingQueue = localQueue
+	}
+
+	var jwtVerifier *auth.JWTVerifier
+	if secrets.SupabaseJWTSecret != "" || secrets.SupabaseJWKSURL != "" {
+		jwtVerifier, err = auth.NewJWTVerifier(auth.JWTConfig{
+			HMACSecret: secrets.SupabaseJWTSecret,
+			JWKSURL:    secrets.SupabaseJWKSURL,
+			Issuer:     secrets.SupabaseJWTIssuer,
+			Audience:   secrets.SupabaseJWTAudience,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create JWT verifier: %v", err)
+		}
+	}
+	var serviceAuth *auth.ServiceAuthenticator
+	if len(secrets.ServiceAPIKeys) > 0 {
+		serviceAuth, err = auth.NewServiceAuthenticator(secrets.ServiceAPIKeys, secrets.ServiceAuthMode)
+		if err != nil {
+			log.Fatalf("Failed to create service authenticator: %v", err)
+		}
+	}
+	if secrets.AuthDevBypass {
+		log.Println("AUTH_DEV_BYPASS is enabled, service credentials are optional and X-Dev-User-ID is trusted without a token")
+	}
+
+	handler := handlers.NewHandler(handlers.Config{
+		Store:               store,
+		Embedder:            embedder,
+		Generator:           generator,
+		Blobs:               blobs,
+		EmbeddingQueue:      embeddingQueue,
+		Events:              broker,
+		SearchFusion:        secrets.SearchFusion,
+		TrashRetention:      secrets.TrashRetention,
+		AttachmentURLExpiry: secrets.AttachmentURLExpiry,
+		JWTVerifier:         jwtVerifier,
+		ServiceAuth:         serviceAuth,
+		AuthDevBypass:       secrets.AuthDevBypass,
+		SpoolExports:        os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "", // API Gateway can't stream or return more than 6 MB
+	})
+
+	// thoughts the import couldn't embed stay pending until the server's sweep re-enqueues them
+	if len(os.Args) > 1 && (os.Args[1] == "import-discord" || os.Args[1] == "import-obsidian") {
+		runImport(handler, os.Args[1], os.Args[2:])
+		return
+	}
+
+	if localQueue != nil {
+		localQueue.Start(context.Background(), localQueueWorkers, handler.ProcessEmbeddingJob)
+	}
+
 	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
-		log.Println("Running in AWS Lambda environment")
-		lambda.Start(createLambdaHandler(handler))
+		// one binary, several functions: LAMBDA_HANDLER picks which trigger this deployment serves
+		switch os.Getenv("LAMBDA_HANDLER") {
+		case "embeddings":
+			log.Println("Running embedding worker in AWS Lambda environment")
+			lambda.Start(queues.NewSQSEventHandler(handler.ProcessEmbeddingJob))
+		case "scheduled":
+			log.Println("Running scheduled tasks in AWS Lambda environment")
+			lambda.Start(createScheduledHandler(handler))
+		default:
+			log.Println("Running in AWS Lambda environment")
+			lambda.Start(createLambdaHandler(handler))
+		}
 	} else {
 		log.Println("Starting HTTP server (development mode)")
+		// Lambda functions only publish, /events needs a long-running server to stream from
+		if postgresBroker != nil {
+			postgresBroker.Start(context.Background())
+		}
+		go runScheduler(handler, schedulerInterval)
 		startHTTPServer(handler, port)
 	}
 }
 
+// EventBridge rule -> Lambda with LAMBDA_HANDLER=scheduled
+func createScheduledHandler(handler *handlers.Handler) func(ctx context.Context, event events.CloudWatchEvent) error {
+	return func(ctx context.Context, event events.CloudWatchEvent) error {
+		return handler.RunScheduledTasks(ctx)
+	}
+}
+
+// stands in for the EventBridge rule in development
+func runScheduler(handler *handlers.Handler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := handler.RunScheduledTasks(context.Background()); err != nil {
+			log.Printf("Scheduled tasks failed: %v", err)
+		}
+	}
+}
+
 func startHTTPServer(handler *handlers.Handler, port string) {
     log.Printf("Server running on port %s", port)
     log.Printf("Health check: http://localhost:%s/health", port)
@@ -65,18 +231,23 @@ func startHTTPServer(handler *handlers.Handler, port string) {
 
 func createLambdaHandler(handler *handlers.Handler) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
     return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-        // create path with query string
+        // create path with query string; API Gateway hands over the parameters decoded, so they're
+        // encoded again (sorted, the same canonical form signed requests use)
         path := request.Path
-        if request.QueryStringParameters != nil && len(request.QueryStringParameters) > 0 {
-            path += "?"
+        query := url.Values(request.MultiValueQueryStringParameters)
+        if len(query) == 0 {
+            query = url.Values{}
             for k, v := range request.QueryStringParameters {
-                path += k + "=" + v + "&"
+                query.Set(k, v)
             }
-            path = path[:len(path)-1] // remove trailing &
+        }
+        if len(query) > 0 {
+            path += "?" + query.Encode()
         }
 
-        // initialize a new HTTP request from API Gateway event
-        req, err := http.NewRequest(request.HTTPMethod, path, strings.NewReader(request.Body))
+        // initialize a new HTTP request from API Gateway event, with the invocation's context so
+        // long-running handlers (/events) stop at the function timeout
+        req, err := http.NewRequestWithContext(ctx, request.HTTPMethod, path, strings.NewReader(request.Body))
         if err != nil {
             return events.APIGatewayProxyResponse{
                 StatusCode: http.StatusInternalServerError,
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/skarokin/runsynapse/go/inits"
+	"github.com/skarokin/runsynapse/go/migrations"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// go run . migrate up|down|status
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	databaseURL, err := inits.InitDatabaseURL()
+	if err != nil {
+		log.Fatalf("Failed to initialize secrets: %v", err)
+	}
+
+	pool, err := inits.NewSupabaseClient(databaseURL)
+	if err != nil {
+		log.Fatalf("Failed to create Supabase client: %v", err)
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		if err := migrations.Up(ctx, pool); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps: %s", args[1])
+			}
+		}
+		if err := migrations.Down(ctx, pool, steps); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	case "status":
+		statuses, err := migrations.Status(ctx, pool)
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		tw.Flush()
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
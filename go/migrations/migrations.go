@@ -0,0 +1,236 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+// files are named <version>_<name>.<up|down>.sql, e.g. 0002_tables.up.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// arbitrary key so two deploys running migrations at once don't interleave
+const advisoryLockKey = 7311_2025
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// parses the embedded sql directory into migrations sorted by version
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(sqlFiles, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name: %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		contents, err := fs.ReadFile(sqlFiles, "sql/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has mismatched names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// applies every pending migration in order, each in its own transaction
+func Up(ctx context.Context, pool *pgxpool.Pool) error {
+	return withLock(ctx, pool, func(conn *pgx.Conn) error {
+		migrations, applied, err := loadState(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		pending := 0
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			pending++
+
+			log.Printf("[MIGRATE] Applying %04d_%s", m.Version, m.Name)
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `
+					INSERT INTO schema_migrations (version, name) VALUES ($1, $2)
+				`, m.Version, m.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+
+		log.Printf("[MIGRATE] Applied %d migration(s)", pending)
+		return nil
+	})
+}
+
+// reverts the most recently applied migrations, newest first
+func Down(ctx context.Context, pool *pgxpool.Pool, steps int) error {
+	return withLock(ctx, pool, func(conn *pgx.Conn) error {
+		migrations, applied, err := loadState(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		reverted := 0
+		for i := len(migrations) - 1; i >= 0 && reverted < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+
+			log.Printf("[MIGRATE] Reverting %04d_%s", m.Version, m.Name)
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `
+					DELETE FROM schema_migrations WHERE version = $1
+				`, m.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to revert migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			reverted++
+		}
+
+		log.Printf("[MIGRATE] Reverted %d migration(s)", reverted)
+		return nil
+	})
+}
+
+// every embedded migration and when (if ever) it was applied
+func Status(ctx context.Context, pool *pgxpool.Pool) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := withLock(ctx, pool, func(conn *pgx.Conn) error {
+		migrations, applied, err := loadState(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			status := MigrationStatus{Migration: m}
+			if appliedAt, ok := applied[m.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// holds a session advisory lock on a single connection for the duration of fn
+func withLock(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgx.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockKey)
+
+	return fn(conn.Conn())
+}
+
+// embedded migrations plus applied versions from schema_migrations (created if missing)
+func loadState(ctx context.Context, conn *pgx.Conn) ([]Migration, map[int]time.Time, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    integer PRIMARY KEY,
+			name       text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	return migrations, applied, nil
+}
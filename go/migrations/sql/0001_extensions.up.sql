@@ -0,0 +1,2 @@
+-- pgvector stores the Gemini embeddings on user_thoughts
+CREATE EXTENSION IF NOT EXISTS vector;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS thought_attachments;
+DROP TABLE IF EXISTS user_thoughts;
+DROP TABLE IF EXISTS users;
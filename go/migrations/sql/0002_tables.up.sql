@@ -0,0 +1,33 @@
+-- IF NOT EXISTS so this can be recorded against the existing Supabase project without touching data
+
+CREATE TABLE IF NOT EXISTS users (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    uuid UNIQUE,                 -- supabase auth user id
+    created_at timestamptz DEFAULT now(),
+    updated_at timestamptz DEFAULT now()
+);
+
+-- gemini-embedding-exp-03-07 returns 3072 dimensions, which is over the 2000 dimension limit for
+-- pgvector ANN indexes, so similarity queries are exact scans filtered by user_id
+CREATE TABLE IF NOT EXISTS user_thoughts (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    uuid REFERENCES users (user_id) ON DELETE CASCADE,
+    thought    text,
+    embedding  vector(3072),
+    pinned     boolean DEFAULT false,
+    created_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS user_thoughts_user_created_idx
+    ON user_thoughts (user_id, created_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS thought_attachments (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    thought_id  uuid REFERENCES user_thoughts (id) ON DELETE CASCADE,
+    file_name   text,
+    url         text,
+    uploaded_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS thought_attachments_thought_idx
+    ON thought_attachments (thought_id);
@@ -0,0 +1,6 @@
+DROP FUNCTION IF EXISTS delete_thought(uuid, uuid);
+DROP FUNCTION IF EXISTS new_thought(uuid, text, vector, jsonb);
+DROP FUNCTION IF EXISTS load_more(uuid, uuid);
+DROP FUNCTION IF EXISTS load_thoughts_and_pins(uuid);
+DROP FUNCTION IF EXISTS thoughts_page_before(uuid, timestamptz, uuid);
+DROP FUNCTION IF EXISTS thought_json(user_thoughts);
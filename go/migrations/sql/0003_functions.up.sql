@@ -0,0 +1,139 @@
+-- every function called from go/stores/postgres.go returns a single JSON document
+
+-- shape of types.Thought
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_build_object(
+        'id',          t.id,
+        'thought',     t.thought,
+        'pinned',      coalesce(t.pinned, false),
+        'created_at',  t.created_at,
+        'attachments', coalesce((
+            SELECT jsonb_agg(a.url ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.url IS NOT NULL
+        ), '[]'::jsonb)
+    )
+$$;
+
+-- one page of thoughts (oldest first) strictly before the (created_at, id) cursor; a NULL cursor means the latest page
+-- page size must match stores.PageSize
+CREATE OR REPLACE FUNCTION thoughts_page_before(p_user_id uuid, p_before_created timestamptz, p_before_id uuid)
+RETURNS jsonb
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    page_size constant int := 25;
+    v_thoughts jsonb;
+    v_has_more boolean;
+BEGIN
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at, t.id), '[]'::jsonb)
+    INTO v_thoughts
+    FROM user_thoughts t
+    WHERE t.id IN (
+        SELECT id FROM user_thoughts
+        WHERE user_id = p_user_id
+          AND (p_before_created IS NULL OR (created_at, id) < (p_before_created, p_before_id))
+        ORDER BY created_at DESC, id DESC
+        LIMIT page_size
+    );
+
+    SELECT EXISTS (
+        SELECT 1 FROM user_thoughts
+        WHERE user_id = p_user_id
+          AND (p_before_created IS NULL OR (created_at, id) < (p_before_created, p_before_id))
+        ORDER BY created_at DESC, id DESC
+        OFFSET page_size
+    ) INTO v_has_more;
+
+    RETURN jsonb_build_object('thoughts', v_thoughts, 'has_more_above', v_has_more);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_thoughts_and_pins(p_user_id uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_page jsonb;
+    v_pinned jsonb;
+BEGIN
+    v_page := thoughts_page_before(p_user_id, NULL, NULL);
+
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at DESC, t.id DESC), '[]'::jsonb)
+    INTO v_pinned
+    FROM user_thoughts t
+    WHERE t.user_id = p_user_id AND t.pinned;
+
+    RETURN (v_page || jsonb_build_object('pinned_thoughts', v_pinned))::json;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_more(p_user_id uuid, p_cursor uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_created timestamptz;
+BEGIN
+    IF p_cursor IS NULL OR p_cursor = '00000000-0000-0000-0000-000000000000'::uuid THEN
+        RETURN thoughts_page_before(p_user_id, NULL, NULL)::json;
+    END IF;
+
+    SELECT created_at INTO v_created
+    FROM user_thoughts
+    WHERE id = p_cursor AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('thoughts', '[]'::json, 'has_more_above', false);
+    END IF;
+
+    RETURN thoughts_page_before(p_user_id, v_created, p_cursor)::json;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION new_thought(p_user_id uuid, p_thought text, p_embedding vector, p_attachment_urls jsonb)
+RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_id uuid;
+    v_created timestamptz;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding)
+    VALUES (p_user_id, p_thought, p_embedding)
+    RETURNING id, created_at INTO v_id, v_created;
+
+    INSERT INTO thought_attachments (thought_id, file_name, url)
+    SELECT v_id, regexp_replace(u.url, '^.*/', ''), u.url
+    FROM jsonb_array_elements_text(coalesce(p_attachment_urls, '[]'::jsonb)) AS u(url);
+
+    RETURN json_build_object('id', v_id, 'created_at', v_created);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION delete_thought(p_user_id uuid, p_thought_id uuid) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_urls json;
+    v_deleted boolean;
+BEGIN
+    SELECT coalesce(json_agg(a.url), '[]'::json)
+    INTO v_urls
+    FROM thought_attachments a
+    JOIN user_thoughts t ON t.id = a.thought_id
+    WHERE t.id = p_thought_id AND t.user_id = p_user_id AND a.url IS NOT NULL;
+
+    -- attachments rows go with the thought (ON DELETE CASCADE)
+    DELETE FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id;
+    v_deleted := FOUND;
+
+    IF NOT v_deleted THEN
+        v_urls := '[]'::json;
+    END IF;
+
+    RETURN json_build_object(
+        'deleted',         v_deleted,
+        'attachment_urls', v_urls,
+        'thought_id',      p_thought_id
+    );
+END;
+$$;
@@ -0,0 +1,6 @@
+DROP FUNCTION IF EXISTS load_around(uuid, uuid, int);
+DROP FUNCTION IF EXISTS load_after(uuid, uuid);
+DROP FUNCTION IF EXISTS thoughts_window(uuid, timestamptz, uuid, text, int);
+DROP FUNCTION IF EXISTS unpin_thought(uuid, uuid);
+DROP FUNCTION IF EXISTS pin_thought(uuid, uuid, int);
+DROP FUNCTION IF EXISTS pinned_thoughts_json(uuid);
@@ -0,0 +1,147 @@
+-- pinned thoughts (newest first), shared by pin_thought and unpin_thought
+CREATE OR REPLACE FUNCTION pinned_thoughts_json(p_user_id uuid) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at DESC, t.id DESC), '[]'::jsonb)
+    FROM user_thoughts t
+    WHERE t.user_id = p_user_id AND t.pinned
+$$;
+
+-- status is one of: ok, not_found, limit_reached
+CREATE OR REPLACE FUNCTION pin_thought(p_user_id uuid, p_thought_id uuid, p_max_pins int) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_pinned boolean;
+    v_count int;
+BEGIN
+    -- serialize pins per user so two concurrent pins can't both slip under the cap
+    PERFORM 1 FROM users WHERE user_id = p_user_id FOR UPDATE;
+
+    SELECT coalesce(pinned, false) INTO v_pinned
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'not_found');
+    END IF;
+
+    IF NOT v_pinned THEN
+        SELECT count(*) INTO v_count
+        FROM user_thoughts
+        WHERE user_id = p_user_id AND pinned;
+
+        IF v_count >= p_max_pins THEN
+            RETURN json_build_object('status', 'limit_reached');
+        END IF;
+
+        UPDATE user_thoughts SET pinned = true
+        WHERE id = p_thought_id AND user_id = p_user_id;
+    END IF;
+
+    RETURN json_build_object('status', 'ok', 'pinned_thoughts', pinned_thoughts_json(p_user_id));
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION unpin_thought(p_user_id uuid, p_thought_id uuid) RETURNS json
+LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE user_thoughts SET pinned = false
+    WHERE id = p_thought_id AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'not_found');
+    END IF;
+
+    RETURN json_build_object('status', 'ok', 'pinned_thoughts', pinned_thoughts_json(p_user_id));
+END;
+$$;
+
+-- up to p_limit thoughts (oldest first) on one side of the (created_at, id) cursor
+-- p_direction is 'before' or 'after'; has_more says whether anything is left past the page on that side
+CREATE OR REPLACE FUNCTION thoughts_window(p_user_id uuid, p_created timestamptz, p_id uuid, p_direction text, p_limit int)
+RETURNS jsonb
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_ids uuid[];
+    v_thoughts jsonb;
+    v_has_more boolean;
+BEGIN
+    IF p_direction = 'before' THEN
+        SELECT array_agg(id ORDER BY created_at DESC, id DESC) INTO v_ids FROM (
+            SELECT id, created_at FROM user_thoughts
+            WHERE user_id = p_user_id AND (created_at, id) < (p_created, p_id)
+            ORDER BY created_at DESC, id DESC
+            LIMIT p_limit + 1
+        ) page;
+    ELSE
+        SELECT array_agg(id ORDER BY created_at, id) INTO v_ids FROM (
+            SELECT id, created_at FROM user_thoughts
+            WHERE user_id = p_user_id AND (created_at, id) > (p_created, p_id)
+            ORDER BY created_at, id
+            LIMIT p_limit + 1
+        ) page;
+    END IF;
+
+    -- fetched one extra row to know whether there is more; drop it from the page
+    v_has_more := coalesce(array_length(v_ids, 1), 0) > p_limit;
+    v_ids := v_ids[1:p_limit];
+
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at, t.id), '[]'::jsonb)
+    INTO v_thoughts
+    FROM user_thoughts t
+    WHERE t.id = ANY (coalesce(v_ids, '{}'));
+
+    RETURN jsonb_build_object('thoughts', v_thoughts, 'has_more', v_has_more);
+END;
+$$;
+
+-- mirrors load_more but scrolls down; page size must match stores.PageSize
+CREATE OR REPLACE FUNCTION load_after(p_user_id uuid, p_cursor uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_created timestamptz;
+    v_page jsonb;
+BEGIN
+    SELECT created_at INTO v_created
+    FROM user_thoughts
+    WHERE id = p_cursor AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('thoughts', '[]'::json, 'has_more_below', false);
+    END IF;
+
+    v_page := thoughts_window(p_user_id, v_created, p_cursor, 'after', 25);
+
+    RETURN json_build_object(
+        'thoughts',       v_page -> 'thoughts',
+        'has_more_below', v_page -> 'has_more'
+    );
+END;
+$$;
+
+-- the thought plus p_half_window thoughts on either side, oldest first
+CREATE OR REPLACE FUNCTION load_around(p_user_id uuid, p_thought_id uuid, p_half_window int) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_thought user_thoughts;
+    v_above jsonb;
+    v_below jsonb;
+BEGIN
+    SELECT * INTO v_thought
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('found', false);
+    END IF;
+
+    v_above := thoughts_window(p_user_id, v_thought.created_at, v_thought.id, 'before', p_half_window);
+    v_below := thoughts_window(p_user_id, v_thought.created_at, v_thought.id, 'after', p_half_window);
+
+    RETURN json_build_object(
+        'found',          true,
+        'thoughts',       (v_above -> 'thoughts') || jsonb_build_array(thought_json(v_thought)) || (v_below -> 'thoughts'),
+        'has_more_above', v_above -> 'has_more',
+        'has_more_below', v_below -> 'has_more'
+    );
+END;
+$$;
@@ -0,0 +1,4 @@
+DROP FUNCTION IF EXISTS search_vector(uuid, vector, int);
+DROP FUNCTION IF EXISTS search_fulltext(uuid, text, int);
+DROP INDEX IF EXISTS user_thoughts_tsv_idx;
+ALTER TABLE user_thoughts DROP COLUMN IF EXISTS thought_tsv;
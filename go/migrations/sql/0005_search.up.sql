@@ -0,0 +1,38 @@
+-- full-text half of hybrid search; the vector half uses user_thoughts.embedding
+ALTER TABLE user_thoughts
+    ADD COLUMN IF NOT EXISTS thought_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', coalesce(thought, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS user_thoughts_tsv_idx ON user_thoughts USING gin (thought_tsv);
+
+-- [{thought, score}] best first; score is ts_rank_cd
+CREATE OR REPLACE FUNCTION search_fulltext(p_user_id uuid, p_query text, p_limit int) RETURNS json
+LANGUAGE sql STABLE AS $$
+    WITH q AS (
+        SELECT websearch_to_tsquery('english', p_query) AS query
+    ), hits AS (
+        SELECT t, ts_rank_cd(t.thought_tsv, q.query) AS score
+        FROM user_thoughts t, q
+        WHERE t.user_id = p_user_id AND t.thought_tsv @@ q.query
+        ORDER BY score DESC, t.created_at DESC
+        LIMIT p_limit
+    )
+    SELECT coalesce(json_agg(json_build_object('thought', thought_json(hits.t), 'score', hits.score)
+                    ORDER BY hits.score DESC, (hits.t).created_at DESC), '[]'::json)
+    FROM hits
+$$;
+
+-- [{thought, score}] best first; score is cosine similarity (1 - cosine distance)
+CREATE OR REPLACE FUNCTION search_vector(p_user_id uuid, p_embedding vector, p_limit int) RETURNS json
+LANGUAGE sql STABLE AS $$
+    WITH hits AS (
+        SELECT t, 1 - (t.embedding <=> p_embedding) AS score
+        FROM user_thoughts t
+        WHERE t.user_id = p_user_id AND t.embedding IS NOT NULL
+        ORDER BY t.embedding <=> p_embedding
+        LIMIT p_limit
+    )
+    SELECT coalesce(json_agg(json_build_object('thought', thought_json(hits.t), 'score', hits.score)
+                    ORDER BY hits.score DESC), '[]'::json)
+    FROM hits
+$$;
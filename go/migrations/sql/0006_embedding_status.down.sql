@@ -0,0 +1,49 @@
+DROP FUNCTION IF EXISTS list_pending_embeddings(int, int);
+DROP FUNCTION IF EXISTS mark_embedding_failed(uuid, text, int);
+DROP FUNCTION IF EXISTS set_thought_embedding(uuid, vector);
+DROP FUNCTION IF EXISTS get_thought(uuid, uuid);
+
+-- restore the 0003 versions
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_build_object(
+        'id',          t.id,
+        'thought',     t.thought,
+        'pinned',      coalesce(t.pinned, false),
+        'created_at',  t.created_at,
+        'attachments', coalesce((
+            SELECT jsonb_agg(a.url ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.url IS NOT NULL
+        ), '[]'::jsonb)
+    )
+$$;
+
+CREATE OR REPLACE FUNCTION new_thought(p_user_id uuid, p_thought text, p_embedding vector, p_attachment_urls jsonb)
+RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_id uuid;
+    v_created timestamptz;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding)
+    VALUES (p_user_id, p_thought, p_embedding)
+    RETURNING id, created_at INTO v_id, v_created;
+
+    INSERT INTO thought_attachments (thought_id, file_name, url)
+    SELECT v_id, regexp_replace(u.url, '^.*/', ''), u.url
+    FROM jsonb_array_elements_text(coalesce(p_attachment_urls, '[]'::jsonb)) AS u(url);
+
+    RETURN json_build_object('id', v_id, 'created_at', v_created);
+END;
+$$;
+
+DROP INDEX IF EXISTS user_thoughts_embedding_pending_idx;
+ALTER TABLE user_thoughts
+    DROP COLUMN IF EXISTS embedding_updated_at,
+    DROP COLUMN IF EXISTS embedding_error,
+    DROP COLUMN IF EXISTS embedding_attempts,
+    DROP COLUMN IF EXISTS embedding_status;
@@ -0,0 +1,107 @@
+-- thoughts are saved before they are embedded; the embedding worker fills the vector in later
+-- pending -> ready on success, pending -> failed once embedding_attempts hits the worker's limit
+ALTER TABLE user_thoughts
+    ADD COLUMN IF NOT EXISTS embedding_status   text NOT NULL DEFAULT 'pending'
+        CHECK (embedding_status IN ('pending', 'ready', 'failed')),
+    ADD COLUMN IF NOT EXISTS embedding_attempts int NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS embedding_error    text,
+    ADD COLUMN IF NOT EXISTS embedding_updated_at timestamptz NOT NULL DEFAULT now();
+
+UPDATE user_thoughts SET embedding_status = 'ready' WHERE embedding IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS user_thoughts_embedding_pending_idx
+    ON user_thoughts (embedding_updated_at)
+    WHERE embedding_status = 'pending';
+
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_build_object(
+        'id',               t.id,
+        'thought',          t.thought,
+        'pinned',           coalesce(t.pinned, false),
+        'created_at',       t.created_at,
+        'embedding_status', t.embedding_status,
+        'attachments',      coalesce((
+            SELECT jsonb_agg(a.url ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.url IS NOT NULL
+        ), '[]'::jsonb)
+    )
+$$;
+
+-- p_embedding may be NULL, in which case the thought is left pending for the embedding worker
+CREATE OR REPLACE FUNCTION new_thought(p_user_id uuid, p_thought text, p_embedding vector, p_attachment_urls jsonb)
+RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_id uuid;
+    v_created timestamptz;
+    v_status text;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding, embedding_status)
+    VALUES (p_user_id, p_thought, p_embedding, CASE WHEN p_embedding IS NULL THEN 'pending' ELSE 'ready' END)
+    RETURNING id, created_at, embedding_status INTO v_id, v_created, v_status;
+
+    INSERT INTO thought_attachments (thought_id, file_name, url)
+    SELECT v_id, regexp_replace(u.url, '^.*/', ''), u.url
+    FROM jsonb_array_elements_text(coalesce(p_attachment_urls, '[]'::jsonb)) AS u(url);
+
+    RETURN json_build_object('id', v_id, 'created_at', v_created, 'embedding_status', v_status);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_thought(p_user_id uuid, p_thought_id uuid) RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT thought_json(t)::json
+    FROM user_thoughts t
+    WHERE t.id = p_thought_id AND t.user_id = p_user_id
+$$;
+
+-- returns false if the thought no longer exists
+CREATE OR REPLACE FUNCTION set_thought_embedding(p_thought_id uuid, p_embedding vector) RETURNS boolean
+LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE user_thoughts
+    SET embedding = p_embedding,
+        embedding_status = 'ready',
+        embedding_error = NULL,
+        embedding_updated_at = now()
+    WHERE id = p_thought_id;
+
+    RETURN FOUND;
+END;
+$$;
+
+-- records a failed attempt; gives up (status failed) once p_max_attempts is reached
+CREATE OR REPLACE FUNCTION mark_embedding_failed(p_thought_id uuid, p_error text, p_max_attempts int) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_attempts int;
+    v_status text;
+BEGIN
+    UPDATE user_thoughts
+    SET embedding_attempts = embedding_attempts + 1,
+        embedding_error = p_error,
+        embedding_status = CASE WHEN embedding_attempts + 1 >= p_max_attempts THEN 'failed' ELSE 'pending' END,
+        embedding_updated_at = now()
+    WHERE id = p_thought_id AND embedding_status <> 'ready'
+    RETURNING embedding_attempts, embedding_status INTO v_attempts, v_status;
+
+    RETURN json_build_object('attempts', coalesce(v_attempts, 0), 'status', coalesce(v_status, 'ready'));
+END;
+$$;
+
+-- thoughts that have been pending longer than p_older_than_secs, for re-enqueueing lost jobs
+CREATE OR REPLACE FUNCTION list_pending_embeddings(p_older_than_secs int, p_limit int) RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(json_agg(json_build_object('user_id', p.user_id, 'thought_id', p.id)), '[]'::json)
+    FROM (
+        SELECT id, user_id FROM user_thoughts
+        WHERE embedding_status = 'pending' AND embedding_updated_at < now() - make_interval(secs => p_older_than_secs)
+        ORDER BY embedding_updated_at
+        LIMIT p_limit
+    ) p
+$$;
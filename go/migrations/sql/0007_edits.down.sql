@@ -0,0 +1,37 @@
+DROP FUNCTION IF EXISTS set_thought_embedding(uuid, text, vector);
+DROP FUNCTION IF EXISTS list_thought_versions(uuid, uuid);
+DROP FUNCTION IF EXISTS edit_thought(uuid, uuid, text);
+
+-- restore the 0006 versions
+CREATE OR REPLACE FUNCTION set_thought_embedding(p_thought_id uuid, p_embedding vector) RETURNS boolean
+LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE user_thoughts
+    SET embedding = p_embedding,
+        embedding_status = 'ready',
+        embedding_error = NULL,
+        embedding_updated_at = now()
+    WHERE id = p_thought_id;
+
+    RETURN FOUND;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_build_object(
+        'id',               t.id,
+        'thought',          t.thought,
+        'pinned',           coalesce(t.pinned, false),
+        'created_at',       t.created_at,
+        'embedding_status', t.embedding_status,
+        'attachments',      coalesce((
+            SELECT jsonb_agg(a.url ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.url IS NOT NULL
+        ), '[]'::jsonb)
+    )
+$$;
+
+DROP TABLE IF EXISTS thought_versions;
+ALTER TABLE user_thoughts DROP COLUMN IF EXISTS edited_at;
@@ -0,0 +1,112 @@
+-- thoughts can be edited in place; every replaced text is kept in thought_versions
+ALTER TABLE user_thoughts ADD COLUMN IF NOT EXISTS edited_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS thought_versions (
+    id          bigserial PRIMARY KEY,
+    thought_id  uuid NOT NULL REFERENCES user_thoughts(id) ON DELETE CASCADE,
+    thought     text NOT NULL,
+    written_at  timestamptz NOT NULL,           -- when this text was created or last edited
+    replaced_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS thought_versions_thought_id_idx ON thought_versions (thought_id, replaced_at DESC);
+
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id',               t.id,
+        'thought',          t.thought,
+        'pinned',           coalesce(t.pinned, false),
+        'created_at',       t.created_at,
+        'edited_at',        t.edited_at,
+        'embedding_status', t.embedding_status,
+        'attachments',      coalesce((
+            SELECT jsonb_agg(a.url ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.url IS NOT NULL
+        ), '[]'::jsonb)
+    ))
+$$;
+
+-- returns NULL if the thought doesn't exist or isn't the user's
+-- the old embedding stays in place for vector search until the worker replaces it
+CREATE OR REPLACE FUNCTION edit_thought(p_user_id uuid, p_thought_id uuid, p_thought text) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_old user_thoughts;
+    v_new user_thoughts;
+BEGIN
+    SELECT * INTO v_old
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RETURN NULL;
+    END IF;
+
+    -- saving without changes doesn't create a version or re-embed
+    IF v_old.thought = p_thought THEN
+        RETURN thought_json(v_old)::json;
+    END IF;
+
+    INSERT INTO thought_versions (thought_id, thought, written_at)
+    VALUES (v_old.id, v_old.thought, coalesce(v_old.edited_at, v_old.created_at));
+
+    UPDATE user_thoughts
+    SET thought = p_thought,
+        edited_at = now(),
+        embedding_status = 'pending',
+        embedding_attempts = 0,
+        embedding_error = NULL,
+        embedding_updated_at = now()
+    WHERE id = v_old.id
+    RETURNING * INTO v_new;
+
+    RETURN thought_json(v_new)::json;
+END;
+$$;
+
+-- previous versions, newest first; NULL if the thought doesn't exist or isn't the user's
+CREATE OR REPLACE FUNCTION list_thought_versions(p_user_id uuid, p_thought_id uuid) RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce((
+        SELECT json_agg(json_build_object(
+            'thought',     v.thought,
+            'written_at',  v.written_at,
+            'replaced_at', v.replaced_at
+        ) ORDER BY v.replaced_at DESC, v.id DESC)
+        FROM thought_versions v
+        WHERE v.thought_id = t.id
+    ), '[]'::json)
+    FROM user_thoughts t
+    WHERE t.id = p_thought_id AND t.user_id = p_user_id
+$$;
+
+-- the worker passes the text it embedded so a result for a since-edited thought is discarded
+-- returns 'ok', 'not_found' or 'changed'
+DROP FUNCTION IF EXISTS set_thought_embedding(uuid, vector);
+
+CREATE OR REPLACE FUNCTION set_thought_embedding(p_thought_id uuid, p_thought text, p_embedding vector) RETURNS text
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_current text;
+BEGIN
+    SELECT thought INTO v_current FROM user_thoughts WHERE id = p_thought_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RETURN 'not_found';
+    END IF;
+    IF v_current <> p_thought THEN
+        RETURN 'changed';
+    END IF;
+
+    UPDATE user_thoughts
+    SET embedding = p_embedding,
+        embedding_status = 'ready',
+        embedding_error = NULL,
+        embedding_updated_at = now()
+    WHERE id = p_thought_id;
+
+    RETURN 'ok';
+END;
+$$;
@@ -0,0 +1,309 @@
+DROP FUNCTION IF EXISTS purge_trash(int, int);
+DROP FUNCTION IF EXISTS list_trash(uuid, int);
+DROP FUNCTION IF EXISTS restore_thought(uuid, uuid, int);
+
+-- restore the earlier versions (0003, 0004, 0005, 0007)
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id',               t.id,
+        'thought',          t.thought,
+        'pinned',           coalesce(t.pinned, false),
+        'created_at',       t.created_at,
+        'edited_at',        t.edited_at,
+        'embedding_status', t.embedding_status,
+        'attachments',      coalesce((
+            SELECT jsonb_agg(a.url ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.url IS NOT NULL
+        ), '[]'::jsonb)
+    ))
+$$;
+
+CREATE OR REPLACE FUNCTION thoughts_page_before(p_user_id uuid, p_before_created timestamptz, p_before_id uuid)
+RETURNS jsonb
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    page_size constant int := 25;
+    v_thoughts jsonb;
+    v_has_more boolean;
+BEGIN
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at, t.id), '[]'::jsonb)
+    INTO v_thoughts
+    FROM user_thoughts t
+    WHERE t.id IN (
+        SELECT id FROM user_thoughts
+        WHERE user_id = p_user_id
+          AND (p_before_created IS NULL OR (created_at, id) < (p_before_created, p_before_id))
+        ORDER BY created_at DESC, id DESC
+        LIMIT page_size
+    );
+
+    SELECT EXISTS (
+        SELECT 1 FROM user_thoughts
+        WHERE user_id = p_user_id
+          AND (p_before_created IS NULL OR (created_at, id) < (p_before_created, p_before_id))
+        ORDER BY created_at DESC, id DESC
+        OFFSET page_size
+    ) INTO v_has_more;
+
+    RETURN jsonb_build_object('thoughts', v_thoughts, 'has_more_above', v_has_more);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION pinned_thoughts_json(p_user_id uuid) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at DESC, t.id DESC), '[]'::jsonb)
+    FROM user_thoughts t
+    WHERE t.user_id = p_user_id AND t.pinned
+$$;
+
+CREATE OR REPLACE FUNCTION load_thoughts_and_pins(p_user_id uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_page jsonb;
+    v_pinned jsonb;
+BEGIN
+    v_page := thoughts_page_before(p_user_id, NULL, NULL);
+
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at DESC, t.id DESC), '[]'::jsonb)
+    INTO v_pinned
+    FROM user_thoughts t
+    WHERE t.user_id = p_user_id AND t.pinned;
+
+    RETURN (v_page || jsonb_build_object('pinned_thoughts', v_pinned))::json;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_more(p_user_id uuid, p_cursor uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_created timestamptz;
+BEGIN
+    IF p_cursor IS NULL OR p_cursor = '00000000-0000-0000-0000-000000000000'::uuid THEN
+        RETURN thoughts_page_before(p_user_id, NULL, NULL)::json;
+    END IF;
+
+    SELECT created_at INTO v_created
+    FROM user_thoughts
+    WHERE id = p_cursor AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('thoughts', '[]'::json, 'has_more_above', false);
+    END IF;
+
+    RETURN thoughts_page_before(p_user_id, v_created, p_cursor)::json;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION thoughts_window(p_user_id uuid, p_created timestamptz, p_id uuid, p_direction text, p_limit int)
+RETURNS jsonb
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_ids uuid[];
+    v_thoughts jsonb;
+    v_has_more boolean;
+BEGIN
+    IF p_direction = 'before' THEN
+        SELECT array_agg(id ORDER BY created_at DESC, id DESC) INTO v_ids FROM (
+            SELECT id, created_at FROM user_thoughts
+            WHERE user_id = p_user_id AND (created_at, id) < (p_created, p_id)
+            ORDER BY created_at DESC, id DESC
+            LIMIT p_limit + 1
+        ) page;
+    ELSE
+        SELECT array_agg(id ORDER BY created_at, id) INTO v_ids FROM (
+            SELECT id, created_at FROM user_thoughts
+            WHERE user_id = p_user_id AND (created_at, id) > (p_created, p_id)
+            ORDER BY created_at, id
+            LIMIT p_limit + 1
+        ) page;
+    END IF;
+
+    -- fetched one extra row to know whether there is more; drop it from the page
+    v_has_more := coalesce(array_length(v_ids, 1), 0) > p_limit;
+    v_ids := v_ids[1:p_limit];
+
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at, t.id), '[]'::jsonb)
+    INTO v_thoughts
+    FROM user_thoughts t
+    WHERE t.id = ANY (coalesce(v_ids, '{}'));
+
+    RETURN jsonb_build_object('thoughts', v_thoughts, 'has_more', v_has_more);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_around(p_user_id uuid, p_thought_id uuid, p_half_window int) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_thought user_thoughts;
+    v_above jsonb;
+    v_below jsonb;
+BEGIN
+    SELECT * INTO v_thought
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('found', false);
+    END IF;
+
+    v_above := thoughts_window(p_user_id, v_thought.created_at, v_thought.id, 'before', p_half_window);
+    v_below := thoughts_window(p_user_id, v_thought.created_at, v_thought.id, 'after', p_half_window);
+
+    RETURN json_build_object(
+        'found',          true,
+        'thoughts',       (v_above -> 'thoughts') || jsonb_build_array(thought_json(v_thought)) || (v_below -> 'thoughts'),
+        'has_more_above', v_above -> 'has_more',
+        'has_more_below', v_below -> 'has_more'
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION pin_thought(p_user_id uuid, p_thought_id uuid, p_max_pins int) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_pinned boolean;
+    v_count int;
+BEGIN
+    -- serialize pins per user so two concurrent pins can't both slip under the cap
+    PERFORM 1 FROM users WHERE user_id = p_user_id FOR UPDATE;
+
+    SELECT coalesce(pinned, false) INTO v_pinned
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'not_found');
+    END IF;
+
+    IF NOT v_pinned THEN
+        SELECT count(*) INTO v_count
+        FROM user_thoughts
+        WHERE user_id = p_user_id AND pinned;
+
+        IF v_count >= p_max_pins THEN
+            RETURN json_build_object('status', 'limit_reached');
+        END IF;
+
+        UPDATE user_thoughts SET pinned = true
+        WHERE id = p_thought_id AND user_id = p_user_id;
+    END IF;
+
+    RETURN json_build_object('status', 'ok', 'pinned_thoughts', pinned_thoughts_json(p_user_id));
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION unpin_thought(p_user_id uuid, p_thought_id uuid) RETURNS json
+LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE user_thoughts SET pinned = false
+    WHERE id = p_thought_id AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'not_found');
+    END IF;
+
+    RETURN json_build_object('status', 'ok', 'pinned_thoughts', pinned_thoughts_json(p_user_id));
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION search_fulltext(p_user_id uuid, p_query text, p_limit int) RETURNS json
+LANGUAGE sql STABLE AS $$
+    WITH q AS (
+        SELECT websearch_to_tsquery('english', p_query) AS query
+    ), hits AS (
+        SELECT t, ts_rank_cd(t.thought_tsv, q.query) AS score
+        FROM user_thoughts t, q
+        WHERE t.user_id = p_user_id AND t.thought_tsv @@ q.query
+        ORDER BY score DESC, t.created_at DESC
+        LIMIT p_limit
+    )
+    SELECT coalesce(json_agg(json_build_object('thought', thought_json(hits.t), 'score', hits.score)
+                    ORDER BY hits.score DESC, (hits.t).created_at DESC), '[]'::json)
+    FROM hits
+$$;
+
+CREATE OR REPLACE FUNCTION search_vector(p_user_id uuid, p_embedding vector, p_limit int) RETURNS json
+LANGUAGE sql STABLE AS $$
+    WITH hits AS (
+        SELECT t, 1 - (t.embedding <=> p_embedding) AS score
+        FROM user_thoughts t
+        WHERE t.user_id = p_user_id AND t.embedding IS NOT NULL
+        ORDER BY t.embedding <=> p_embedding
+        LIMIT p_limit
+    )
+    SELECT coalesce(json_agg(json_build_object('thought', thought_json(hits.t), 'score', hits.score)
+                    ORDER BY hits.score DESC), '[]'::json)
+    FROM hits
+$$;
+
+CREATE OR REPLACE FUNCTION edit_thought(p_user_id uuid, p_thought_id uuid, p_thought text) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_old user_thoughts;
+    v_new user_thoughts;
+BEGIN
+    SELECT * INTO v_old
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RETURN NULL;
+    END IF;
+
+    -- saving without changes doesn't create a version or re-embed
+    IF v_old.thought = p_thought THEN
+        RETURN thought_json(v_old)::json;
+    END IF;
+
+    INSERT INTO thought_versions (thought_id, thought, written_at)
+    VALUES (v_old.id, v_old.thought, coalesce(v_old.edited_at, v_old.created_at));
+
+    UPDATE user_thoughts
+    SET thought = p_thought,
+        edited_at = now(),
+        embedding_status = 'pending',
+        embedding_attempts = 0,
+        embedding_error = NULL,
+        embedding_updated_at = now()
+    WHERE id = v_old.id
+    RETURNING * INTO v_new;
+
+    RETURN thought_json(v_new)::json;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION delete_thought(p_user_id uuid, p_thought_id uuid) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_urls json;
+    v_deleted boolean;
+BEGIN
+    SELECT coalesce(json_agg(a.url), '[]'::json)
+    INTO v_urls
+    FROM thought_attachments a
+    JOIN user_thoughts t ON t.id = a.thought_id
+    WHERE t.id = p_thought_id AND t.user_id = p_user_id AND a.url IS NOT NULL;
+
+    -- attachments rows go with the thought (ON DELETE CASCADE)
+    DELETE FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id;
+    v_deleted := FOUND;
+
+    IF NOT v_deleted THEN
+        v_urls := '[]'::json;
+    END IF;
+
+    RETURN json_build_object(
+        'deleted',         v_deleted,
+        'attachment_urls', v_urls,
+        'thought_id',      p_thought_id
+    );
+END;
+$$;
+
+-- anything still in the trash comes back rather than being lost
+DROP INDEX IF EXISTS user_thoughts_deleted_at_idx;
+ALTER TABLE user_thoughts DROP COLUMN IF EXISTS deleted_at;
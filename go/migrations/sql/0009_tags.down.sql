@@ -0,0 +1,267 @@
+DROP FUNCTION IF EXISTS list_tags(uuid);
+DROP FUNCTION IF EXISTS search_vector(uuid, vector, text, int);
+DROP FUNCTION IF EXISTS search_fulltext(uuid, text, text, int);
+DROP FUNCTION IF EXISTS load_after(uuid, uuid, text);
+DROP FUNCTION IF EXISTS load_more(uuid, uuid, text);
+DROP FUNCTION IF EXISTS thoughts_window(uuid, timestamptz, uuid, text, int, text);
+DROP FUNCTION IF EXISTS thoughts_page_before(uuid, timestamptz, uuid, text);
+DROP FUNCTION IF EXISTS edit_thought(uuid, uuid, text, jsonb);
+DROP FUNCTION IF EXISTS new_thought(uuid, text, vector, jsonb, jsonb);
+DROP FUNCTION IF EXISTS thought_has_tag(uuid, text);
+DROP FUNCTION IF EXISTS set_thought_tags(uuid, uuid, jsonb);
+
+-- restore the earlier versions (0004, 0006, 0008)
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id',               t.id,
+        'thought',          t.thought,
+        'pinned',           coalesce(t.pinned, false),
+        'created_at',       t.created_at,
+        'edited_at',        t.edited_at,
+        'deleted_at',       t.deleted_at,
+        'embedding_status', t.embedding_status,
+        'attachments',      coalesce((
+            SELECT jsonb_agg(a.url ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.url IS NOT NULL
+        ), '[]'::jsonb)
+    ))
+$$;
+
+CREATE OR REPLACE FUNCTION new_thought(p_user_id uuid, p_thought text, p_embedding vector, p_attachment_urls jsonb)
+RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_id uuid;
+    v_created timestamptz;
+    v_status text;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding, embedding_status)
+    VALUES (p_user_id, p_thought, p_embedding, CASE WHEN p_embedding IS NULL THEN 'pending' ELSE 'ready' END)
+    RETURNING id, created_at, embedding_status INTO v_id, v_created, v_status;
+
+    INSERT INTO thought_attachments (thought_id, file_name, url)
+    SELECT v_id, regexp_replace(u.url, '^.*/', ''), u.url
+    FROM jsonb_array_elements_text(coalesce(p_attachment_urls, '[]'::jsonb)) AS u(url);
+
+    RETURN json_build_object('id', v_id, 'created_at', v_created, 'embedding_status', v_status);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION edit_thought(p_user_id uuid, p_thought_id uuid, p_thought text) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_old user_thoughts;
+    v_new user_thoughts;
+BEGIN
+    SELECT * INTO v_old
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id AND deleted_at IS NULL
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RETURN NULL;
+    END IF;
+
+    IF v_old.thought = p_thought THEN
+        RETURN thought_json(v_old)::json;
+    END IF;
+
+    INSERT INTO thought_versions (thought_id, thought, written_at)
+    VALUES (v_old.id, v_old.thought, coalesce(v_old.edited_at, v_old.created_at));
+
+    UPDATE user_thoughts
+    SET thought = p_thought,
+        edited_at = now(),
+        embedding_status = 'pending',
+        embedding_attempts = 0,
+        embedding_error = NULL,
+        embedding_updated_at = now()
+    WHERE id = v_old.id
+    RETURNING * INTO v_new;
+
+    RETURN thought_json(v_new)::json;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION thoughts_page_before(p_user_id uuid, p_before_created timestamptz, p_before_id uuid)
+RETURNS jsonb
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    page_size constant int := 25;
+    v_thoughts jsonb;
+    v_has_more boolean;
+BEGIN
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at, t.id), '[]'::jsonb)
+    INTO v_thoughts
+    FROM user_thoughts t
+    WHERE t.id IN (
+        SELECT id FROM user_thoughts
+        WHERE user_id = p_user_id AND deleted_at IS NULL
+          AND (p_before_created IS NULL OR (created_at, id) < (p_before_created, p_before_id))
+        ORDER BY created_at DESC, id DESC
+        LIMIT page_size
+    );
+
+    SELECT EXISTS (
+        SELECT 1 FROM user_thoughts
+        WHERE user_id = p_user_id AND deleted_at IS NULL
+          AND (p_before_created IS NULL OR (created_at, id) < (p_before_created, p_before_id))
+        ORDER BY created_at DESC, id DESC
+        OFFSET page_size
+    ) INTO v_has_more;
+
+    RETURN jsonb_build_object('thoughts', v_thoughts, 'has_more_above', v_has_more);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION thoughts_window(p_user_id uuid, p_created timestamptz, p_id uuid, p_direction text, p_limit int)
+RETURNS jsonb
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_ids uuid[];
+    v_thoughts jsonb;
+    v_has_more boolean;
+BEGIN
+    IF p_direction = 'before' THEN
+        SELECT array_agg(id ORDER BY created_at DESC, id DESC) INTO v_ids FROM (
+            SELECT id, created_at FROM user_thoughts
+            WHERE user_id = p_user_id AND deleted_at IS NULL AND (created_at, id) < (p_created, p_id)
+            ORDER BY created_at DESC, id DESC
+            LIMIT p_limit + 1
+        ) page;
+    ELSE
+        SELECT array_agg(id ORDER BY created_at, id) INTO v_ids FROM (
+            SELECT id, created_at FROM user_thoughts
+            WHERE user_id = p_user_id AND deleted_at IS NULL AND (created_at, id) > (p_created, p_id)
+            ORDER BY created_at, id
+            LIMIT p_limit + 1
+        ) page;
+    END IF;
+
+    v_has_more := coalesce(array_length(v_ids, 1), 0) > p_limit;
+    v_ids := v_ids[1:p_limit];
+
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at, t.id), '[]'::jsonb)
+    INTO v_thoughts
+    FROM user_thoughts t
+    WHERE t.id = ANY (coalesce(v_ids, '{}'));
+
+    RETURN jsonb_build_object('thoughts', v_thoughts, 'has_more', v_has_more);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_thoughts_and_pins(p_user_id uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+BEGIN
+    RETURN (thoughts_page_before(p_user_id, NULL, NULL) || jsonb_build_object('pinned_thoughts', pinned_thoughts_json(p_user_id)))::json;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_more(p_user_id uuid, p_cursor uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_created timestamptz;
+BEGIN
+    IF p_cursor IS NULL OR p_cursor = '00000000-0000-0000-0000-000000000000'::uuid THEN
+        RETURN thoughts_page_before(p_user_id, NULL, NULL)::json;
+    END IF;
+
+    -- a trashed cursor still works, so the UI can keep scrolling past a thought it just deleted
+    SELECT created_at INTO v_created
+    FROM user_thoughts
+    WHERE id = p_cursor AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('thoughts', '[]'::json, 'has_more_above', false);
+    END IF;
+
+    RETURN thoughts_page_before(p_user_id, v_created, p_cursor)::json;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_after(p_user_id uuid, p_cursor uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_created timestamptz;
+    v_page jsonb;
+BEGIN
+    SELECT created_at INTO v_created
+    FROM user_thoughts
+    WHERE id = p_cursor AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('thoughts', '[]'::json, 'has_more_below', false);
+    END IF;
+
+    v_page := thoughts_window(p_user_id, v_created, p_cursor, 'after', 25);
+
+    RETURN json_build_object(
+        'thoughts',       v_page -> 'thoughts',
+        'has_more_below', v_page -> 'has_more'
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_around(p_user_id uuid, p_thought_id uuid, p_half_window int) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_thought user_thoughts;
+    v_above jsonb;
+    v_below jsonb;
+BEGIN
+    SELECT * INTO v_thought
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id AND deleted_at IS NULL;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('found', false);
+    END IF;
+
+    v_above := thoughts_window(p_user_id, v_thought.created_at, v_thought.id, 'before', p_half_window);
+    v_below := thoughts_window(p_user_id, v_thought.created_at, v_thought.id, 'after', p_half_window);
+
+    RETURN json_build_object(
+        'found',          true,
+        'thoughts',       (v_above -> 'thoughts') || jsonb_build_array(thought_json(v_thought)) || (v_below -> 'thoughts'),
+        'has_more_above', v_above -> 'has_more',
+        'has_more_below', v_below -> 'has_more'
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION search_fulltext(p_user_id uuid, p_query text, p_limit int) RETURNS json
+LANGUAGE sql STABLE AS $$
+    WITH q AS (
+        SELECT websearch_to_tsquery('english', p_query) AS query
+    ), hits AS (
+        SELECT t, ts_rank_cd(t.thought_tsv, q.query) AS score
+        FROM user_thoughts t, q
+        WHERE t.user_id = p_user_id AND t.deleted_at IS NULL AND t.thought_tsv @@ q.query
+        ORDER BY score DESC, t.created_at DESC
+        LIMIT p_limit
+    )
+    SELECT coalesce(json_agg(json_build_object('thought', thought_json(hits.t), 'score', hits.score)
+                    ORDER BY hits.score DESC, (hits.t).created_at DESC), '[]'::json)
+    FROM hits
+$$;
+
+CREATE OR REPLACE FUNCTION search_vector(p_user_id uuid, p_embedding vector, p_limit int) RETURNS json
+LANGUAGE sql STABLE AS $$
+    WITH hits AS (
+        SELECT t, 1 - (t.embedding <=> p_embedding) AS score
+        FROM user_thoughts t
+        WHERE t.user_id = p_user_id AND t.deleted_at IS NULL AND t.embedding IS NOT NULL
+        ORDER BY t.embedding <=> p_embedding
+        LIMIT p_limit
+    )
+    SELECT coalesce(json_agg(json_build_object('thought', thought_json(hits.t), 'score', hits.score)
+                    ORDER BY hits.score DESC), '[]'::json)
+    FROM hits
+$$;
+
+DROP TABLE IF EXISTS thought_tags;
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS related_thoughts(uuid, uuid, float8, int);
@@ -0,0 +1,39 @@
+-- nearest neighbours of one of the user's thoughts by its stored embedding, for /relatedThoughts
+-- {status: 'ok' | 'not_found' | 'not_embedded', hits: [{thought, score}]}, score is cosine similarity
+-- the k nearest are taken first and then cut at p_min_similarity, same exact scan as search_vector
+CREATE OR REPLACE FUNCTION related_thoughts(p_user_id uuid, p_thought_id uuid, p_min_similarity float8, p_limit int)
+RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_embedding vector;
+    v_hits json;
+BEGIN
+    SELECT embedding INTO v_embedding
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id AND deleted_at IS NULL;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'not_found', 'hits', '[]'::json);
+    END IF;
+
+    IF v_embedding IS NULL THEN
+        RETURN json_build_object('status', 'not_embedded', 'hits', '[]'::json);
+    END IF;
+
+    WITH nearest AS (
+        SELECT t, 1 - (t.embedding <=> v_embedding) AS score
+        FROM user_thoughts t
+        WHERE t.user_id = p_user_id AND t.deleted_at IS NULL AND t.embedding IS NOT NULL
+          AND t.id <> p_thought_id
+        ORDER BY t.embedding <=> v_embedding
+        LIMIT p_limit
+    )
+    SELECT coalesce(json_agg(json_build_object('thought', thought_json(nearest.t), 'score', nearest.score)
+                    ORDER BY nearest.score DESC), '[]'::json)
+    INTO v_hits
+    FROM nearest
+    WHERE nearest.score >= p_min_similarity;
+
+    RETURN json_build_object('status', 'ok', 'hits', v_hits);
+END;
+$$;
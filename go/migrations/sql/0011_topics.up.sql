@@ -0,0 +1,280 @@
+-- topics are clusters of a user's thoughts by embedding, computed in Go by the scheduled clustering job
+-- (handlers.clusterTopics) and labelled by Gemini; every run replaces the user's previous topics
+CREATE TABLE IF NOT EXISTS topics (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    uuid NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    label      text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS topics_user_idx ON topics (user_id);
+
+-- a thought belongs to at most one topic; thoughts in clusters too small to label have none
+ALTER TABLE user_thoughts ADD COLUMN IF NOT EXISTS topic_id uuid REFERENCES topics (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS user_thoughts_topic_idx
+    ON user_thoughts (topic_id, created_at DESC, id DESC) WHERE topic_id IS NOT NULL;
+
+-- when each user was last clustered, so the job only revisits users whose embeddings changed since
+CREATE TABLE IF NOT EXISTS topic_runs (
+    user_id      uuid PRIMARY KEY REFERENCES users (user_id) ON DELETE CASCADE,
+    clustered_at timestamptz NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id',               t.id,
+        'thought',          t.thought,
+        'pinned',           coalesce(t.pinned, false),
+        'created_at',       t.created_at,
+        'edited_at',        t.edited_at,
+        'deleted_at',       t.deleted_at,
+        'embedding_status', t.embedding_status,
+        'topic_id',         t.topic_id,
+        'attachments',      coalesce((
+            SELECT jsonb_agg(a.url ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.url IS NOT NULL
+        ), '[]'::jsonb),
+        'tags',             coalesce((
+            SELECT jsonb_agg(g.tag ORDER BY g.tag)
+            FROM thought_tags g
+            WHERE g.thought_id = t.id
+        ), '[]'::jsonb)
+    ))
+$$;
+
+-- the paging helpers take an optional topic next to the tag; NULL means every thought
+DROP FUNCTION IF EXISTS load_more(uuid, uuid, text);
+DROP FUNCTION IF EXISTS load_after(uuid, uuid, text);
+DROP FUNCTION IF EXISTS thoughts_page_before(uuid, timestamptz, uuid, text);
+DROP FUNCTION IF EXISTS thoughts_window(uuid, timestamptz, uuid, text, int, text);
+
+CREATE OR REPLACE FUNCTION thoughts_page_before(p_user_id uuid, p_before_created timestamptz, p_before_id uuid, p_tag text, p_topic_id uuid)
+RETURNS jsonb
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    page_size constant int := 25;
+    v_thoughts jsonb;
+    v_has_more boolean;
+BEGIN
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at, t.id), '[]'::jsonb)
+    INTO v_thoughts
+    FROM user_thoughts t
+    WHERE t.id IN (
+        SELECT id FROM user_thoughts
+        WHERE user_id = p_user_id AND deleted_at IS NULL AND thought_has_tag(id, p_tag)
+          AND (p_topic_id IS NULL OR topic_id = p_topic_id)
+          AND (p_before_created IS NULL OR (created_at, id) < (p_before_created, p_before_id))
+        ORDER BY created_at DESC, id DESC
+        LIMIT page_size
+    );
+
+    SELECT EXISTS (
+        SELECT 1 FROM user_thoughts
+        WHERE user_id = p_user_id AND deleted_at IS NULL AND thought_has_tag(id, p_tag)
+          AND (p_topic_id IS NULL OR topic_id = p_topic_id)
+          AND (p_before_created IS NULL OR (created_at, id) < (p_before_created, p_before_id))
+        ORDER BY created_at DESC, id DESC
+        OFFSET page_size
+    ) INTO v_has_more;
+
+    RETURN jsonb_build_object('thoughts', v_thoughts, 'has_more_above', v_has_more);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION thoughts_window(p_user_id uuid, p_created timestamptz, p_id uuid, p_direction text, p_limit int, p_tag text, p_topic_id uuid)
+RETURNS jsonb
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_ids uuid[];
+    v_thoughts jsonb;
+    v_has_more boolean;
+BEGIN
+    IF p_direction = 'before' THEN
+        SELECT array_agg(id ORDER BY created_at DESC, id DESC) INTO v_ids FROM (
+            SELECT id, created_at FROM user_thoughts
+            WHERE user_id = p_user_id AND deleted_at IS NULL AND thought_has_tag(id, p_tag)
+              AND (p_topic_id IS NULL OR topic_id = p_topic_id)
+              AND (created_at, id) < (p_created, p_id)
+            ORDER BY created_at DESC, id DESC
+            LIMIT p_limit + 1
+        ) page;
+    ELSE
+        SELECT array_agg(id ORDER BY created_at, id) INTO v_ids FROM (
+            SELECT id, created_at FROM user_thoughts
+            WHERE user_id = p_user_id AND deleted_at IS NULL AND thought_has_tag(id, p_tag)
+              AND (p_topic_id IS NULL OR topic_id = p_topic_id)
+              AND (created_at, id) > (p_created, p_id)
+            ORDER BY created_at, id
+            LIMIT p_limit + 1
+        ) page;
+    END IF;
+
+    v_has_more := coalesce(array_length(v_ids, 1), 0) > p_limit;
+    v_ids := v_ids[1:p_limit];
+
+    SELECT coalesce(jsonb_agg(thought_json(t) ORDER BY t.created_at, t.id), '[]'::jsonb)
+    INTO v_thoughts
+    FROM user_thoughts t
+    WHERE t.id = ANY (coalesce(v_ids, '{}'));
+
+    RETURN jsonb_build_object('thoughts', v_thoughts, 'has_more', v_has_more);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_thoughts_and_pins(p_user_id uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+BEGIN
+    RETURN (thoughts_page_before(p_user_id, NULL, NULL, NULL, NULL) || jsonb_build_object('pinned_thoughts', pinned_thoughts_json(p_user_id)))::json;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_more(p_user_id uuid, p_cursor uuid, p_tag text, p_topic_id uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_created timestamptz;
+BEGIN
+    IF p_cursor IS NULL OR p_cursor = '00000000-0000-0000-0000-000000000000'::uuid THEN
+        RETURN thoughts_page_before(p_user_id, NULL, NULL, p_tag, p_topic_id)::json;
+    END IF;
+
+    -- the cursor only marks a position, it doesn't need the tag or topic itself (or to be out of the trash)
+    SELECT created_at INTO v_created
+    FROM user_thoughts
+    WHERE id = p_cursor AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('thoughts', '[]'::json, 'has_more_above', false);
+    END IF;
+
+    RETURN thoughts_page_before(p_user_id, v_created, p_cursor, p_tag, p_topic_id)::json;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_after(p_user_id uuid, p_cursor uuid, p_tag text, p_topic_id uuid) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_created timestamptz;
+    v_page jsonb;
+BEGIN
+    SELECT created_at INTO v_created
+    FROM user_thoughts
+    WHERE id = p_cursor AND user_id = p_user_id;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('thoughts', '[]'::json, 'has_more_below', false);
+    END IF;
+
+    v_page := thoughts_window(p_user_id, v_created, p_cursor, 'after', 25, p_tag, p_topic_id);
+
+    RETURN json_build_object(
+        'thoughts',       v_page -> 'thoughts',
+        'has_more_below', v_page -> 'has_more'
+    );
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION load_around(p_user_id uuid, p_thought_id uuid, p_half_window int) RETURNS json
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+    v_thought user_thoughts;
+    v_above jsonb;
+    v_below jsonb;
+BEGIN
+    SELECT * INTO v_thought
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id AND deleted_at IS NULL;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('found', false);
+    END IF;
+
+    v_above := thoughts_window(p_user_id, v_thought.created_at, v_thought.id, 'before', p_half_window, NULL, NULL);
+    v_below := thoughts_window(p_user_id, v_thought.created_at, v_thought.id, 'after', p_half_window, NULL, NULL);
+
+    RETURN json_build_object(
+        'found',          true,
+        'thoughts',       (v_above -> 'thoughts') || jsonb_build_array(thought_json(v_thought)) || (v_below -> 'thoughts'),
+        'has_more_above', v_above -> 'has_more',
+        'has_more_below', v_below -> 'has_more'
+    );
+END;
+$$;
+
+-- users with at least p_min_thoughts embedded thoughts who were never clustered, or who have thoughts
+-- embedded since their last run and weren't clustered in the last p_min_interval_secs; never clustered first
+CREATE OR REPLACE FUNCTION list_topic_candidates(p_min_thoughts int, p_min_interval_secs double precision, p_limit int)
+RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(json_agg(c.user_id ORDER BY c.clustered_at NULLS FIRST, c.user_id), '[]'::json)
+    FROM (
+        SELECT t.user_id, r.clustered_at
+        FROM user_thoughts t
+        LEFT JOIN topic_runs r ON r.user_id = t.user_id
+        WHERE t.embedding IS NOT NULL AND t.deleted_at IS NULL
+        GROUP BY t.user_id, r.clustered_at
+        HAVING count(*) >= p_min_thoughts
+           AND (r.clustered_at IS NULL
+                OR (r.clustered_at < now() - make_interval(secs => p_min_interval_secs)
+                    AND max(t.embedding_updated_at) > r.clustered_at))
+        ORDER BY r.clustered_at NULLS FIRST, t.user_id
+        LIMIT p_limit
+    ) c
+$$;
+
+-- p_topics is [{label, thought_ids}]; p_clustered_at is when the embeddings were read, so thoughts embedded
+-- while the job ran still count as changed on the next run
+CREATE OR REPLACE FUNCTION replace_topics(p_user_id uuid, p_topics jsonb, p_clustered_at timestamptz) RETURNS void
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_topic jsonb;
+    v_id uuid;
+BEGIN
+    -- ON DELETE SET NULL clears the old assignments
+    DELETE FROM topics WHERE user_id = p_user_id;
+
+    FOR v_topic IN SELECT * FROM jsonb_array_elements(coalesce(p_topics, '[]'::jsonb)) LOOP
+        INSERT INTO topics (user_id, label)
+        VALUES (p_user_id, v_topic ->> 'label')
+        RETURNING id INTO v_id;
+
+        UPDATE user_thoughts
+        SET topic_id = v_id
+        WHERE user_id = p_user_id
+          AND id IN (SELECT e.id::uuid FROM jsonb_array_elements_text(v_topic -> 'thought_ids') AS e(id));
+    END LOOP;
+
+    INSERT INTO topic_runs (user_id, clustered_at)
+    VALUES (p_user_id, p_clustered_at)
+    ON CONFLICT (user_id) DO UPDATE SET clustered_at = excluded.clustered_at;
+END;
+$$;
+
+-- [{id, label, size, created_at, sample_thoughts}], largest first; sizes and samples leave out the trash
+-- and topics emptied by deletes are skipped until the next run replaces them
+CREATE OR REPLACE FUNCTION list_topics(p_user_id uuid, p_samples int) RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(json_agg(json_build_object(
+               'id',              c.id,
+               'label',           c.label,
+               'size',            c.size,
+               'created_at',      c.created_at,
+               'sample_thoughts', c.samples
+           ) ORDER BY c.size DESC, c.label, c.id), '[]'::json)
+    FROM (
+        SELECT p.id, p.label, p.created_at,
+            (SELECT count(*) FROM user_thoughts t WHERE t.topic_id = p.id AND t.deleted_at IS NULL) AS size,
+            (SELECT coalesce(jsonb_agg(thought_json(s.t) ORDER BY (s.t).created_at DESC, (s.t).id DESC), '[]'::jsonb)
+             FROM (
+                 SELECT t FROM user_thoughts t
+                 WHERE t.topic_id = p.id AND t.deleted_at IS NULL
+                 ORDER BY t.created_at DESC, t.id DESC
+                 LIMIT p_samples
+             ) s) AS samples
+        FROM topics p
+        WHERE p.user_id = p_user_id
+    ) c
+    WHERE c.size > 0
+$$;
@@ -0,0 +1,6 @@
+DROP FUNCTION IF EXISTS list_digests(uuid, text, int);
+DROP FUNCTION IF EXISTS save_digest(uuid, text, timestamptz, timestamptz, jsonb, jsonb, jsonb, jsonb);
+DROP FUNCTION IF EXISTS list_digest_candidates(text, timestamptz, timestamptz, int, int);
+DROP FUNCTION IF EXISTS list_thoughts_between(uuid, timestamptz, timestamptz, int);
+DROP FUNCTION IF EXISTS digest_json(digests);
+DROP TABLE IF EXISTS digests;
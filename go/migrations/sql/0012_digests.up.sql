@@ -0,0 +1,108 @@
+-- Gemini summaries of a user's thoughts over a day or a week, generated on demand (/generateDigest) or by
+-- the scheduled tasks for the previous day and week; one digest per user, period and start, regenerating replaces it
+-- themes, open_questions and action_items are [{..., thought_ids}] as produced by handlers.buildDigest
+CREATE TABLE IF NOT EXISTS digests (
+    id                 uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id            uuid NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    period             text NOT NULL CHECK (period IN ('day', 'week')),
+    period_start       timestamptz NOT NULL,
+    period_end         timestamptz NOT NULL,
+    themes             jsonb NOT NULL DEFAULT '[]'::jsonb,
+    open_questions     jsonb NOT NULL DEFAULT '[]'::jsonb,
+    action_items       jsonb NOT NULL DEFAULT '[]'::jsonb,
+    source_thought_ids uuid[] NOT NULL DEFAULT '{}',
+    created_at         timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (user_id, period, period_start)
+);
+
+CREATE INDEX IF NOT EXISTS digests_user_start_idx ON digests (user_id, period_start DESC);
+
+CREATE OR REPLACE FUNCTION digest_json(d digests) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_build_object(
+        'id',                 d.id,
+        'period',             d.period,
+        'period_start',       d.period_start,
+        'period_end',         d.period_end,
+        'themes',             d.themes,
+        'open_questions',     d.open_questions,
+        'action_items',       d.action_items,
+        'source_thought_ids', to_jsonb(d.source_thought_ids),
+        'created_at',         d.created_at
+    )
+$$;
+
+-- thoughts created in [p_start, p_end) outside the trash, oldest first
+CREATE OR REPLACE FUNCTION list_thoughts_between(p_user_id uuid, p_start timestamptz, p_end timestamptz, p_limit int)
+RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(json_agg(thought_json(s.t) ORDER BY (s.t).created_at, (s.t).id), '[]'::json)
+    FROM (
+        SELECT t FROM user_thoughts t
+        WHERE t.user_id = p_user_id AND t.deleted_at IS NULL
+          AND t.created_at >= p_start AND t.created_at < p_end
+        ORDER BY t.created_at, t.id
+        LIMIT p_limit
+    ) s
+$$;
+
+-- users with at least p_min_thoughts thoughts in the window who don't have its digest yet
+CREATE OR REPLACE FUNCTION list_digest_candidates(p_period text, p_start timestamptz, p_end timestamptz, p_min_thoughts int, p_limit int)
+RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(json_agg(c.user_id ORDER BY c.user_id), '[]'::json)
+    FROM (
+        SELECT t.user_id
+        FROM user_thoughts t
+        WHERE t.deleted_at IS NULL AND t.created_at >= p_start AND t.created_at < p_end
+          AND NOT EXISTS (
+              SELECT 1 FROM digests d
+              WHERE d.user_id = t.user_id AND d.period = p_period AND d.period_start = p_start
+          )
+        GROUP BY t.user_id
+        HAVING count(*) >= p_min_thoughts
+        ORDER BY t.user_id
+        LIMIT p_limit
+    ) c
+$$;
+
+CREATE OR REPLACE FUNCTION save_digest(
+    p_user_id uuid, p_period text, p_start timestamptz, p_end timestamptz,
+    p_themes jsonb, p_open_questions jsonb, p_action_items jsonb, p_source_thought_ids jsonb
+) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_digest digests;
+BEGIN
+    INSERT INTO digests (user_id, period, period_start, period_end, themes, open_questions, action_items, source_thought_ids)
+    VALUES (
+        p_user_id, p_period, p_start, p_end,
+        coalesce(p_themes, '[]'::jsonb),
+        coalesce(p_open_questions, '[]'::jsonb),
+        coalesce(p_action_items, '[]'::jsonb),
+        ARRAY(SELECT e.id::uuid FROM jsonb_array_elements_text(coalesce(p_source_thought_ids, '[]'::jsonb)) AS e(id))
+    )
+    ON CONFLICT (user_id, period, period_start) DO UPDATE
+    SET period_end = excluded.period_end,
+        themes = excluded.themes,
+        open_questions = excluded.open_questions,
+        action_items = excluded.action_items,
+        source_thought_ids = excluded.source_thought_ids,
+        created_at = now()
+    RETURNING * INTO v_digest;
+
+    RETURN digest_json(v_digest)::json;
+END;
+$$;
+
+-- newest period first; a NULL period lists days and weeks together
+CREATE OR REPLACE FUNCTION list_digests(p_user_id uuid, p_period text, p_limit int) RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(json_agg(digest_json(s.d) ORDER BY (s.d).period_start DESC, (s.d).period), '[]'::json)
+    FROM (
+        SELECT d FROM digests d
+        WHERE d.user_id = p_user_id AND (p_period IS NULL OR d.period = p_period)
+        ORDER BY d.period_start DESC, d.period
+        LIMIT p_limit
+    ) s
+$$;
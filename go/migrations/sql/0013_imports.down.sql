@@ -0,0 +1,7 @@
+DROP FUNCTION IF EXISTS imported_source_ids(uuid, text, jsonb);
+DROP FUNCTION IF EXISTS import_thought(uuid, text, timestamptz, vector, jsonb, jsonb, text, text);
+DROP INDEX IF EXISTS user_thoughts_source_idx;
+
+ALTER TABLE user_thoughts
+    DROP COLUMN IF EXISTS source_id,
+    DROP COLUMN IF EXISTS source;
@@ -0,0 +1,54 @@
+-- where an imported thought came from (e.g. 'discord' and the message ID), so importing the same
+-- export again skips everything that's already there; NULL for thoughts captured in the app
+ALTER TABLE user_thoughts
+    ADD COLUMN IF NOT EXISTS source    text,
+    ADD COLUMN IF NOT EXISTS source_id text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_thoughts_source_idx
+    ON user_thoughts (user_id, source, source_id)
+    WHERE source_id IS NOT NULL;
+
+-- like new_thought, but keeps the original created_at; status 'exists' when the source ID was imported
+-- before (trashed thoughts count, so an import doesn't bring back what the user deleted)
+CREATE OR REPLACE FUNCTION import_thought(
+    p_user_id uuid, p_thought text, p_created_at timestamptz, p_embedding vector,
+    p_attachment_urls jsonb, p_tags jsonb, p_source text, p_source_id text
+) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_thought user_thoughts;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding, embedding_status, created_at, source, source_id)
+    VALUES (
+        p_user_id, p_thought, p_embedding, CASE WHEN p_embedding IS NULL THEN 'pending' ELSE 'ready' END,
+        p_created_at, p_source, p_source_id
+    )
+    ON CONFLICT (user_id, source, source_id) WHERE source_id IS NOT NULL DO NOTHING
+    RETURNING * INTO v_thought;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'exists');
+    END IF;
+
+    INSERT INTO thought_attachments (thought_id, file_name, url)
+    SELECT v_thought.id, regexp_replace(u.url, '^.*/', ''), u.url
+    FROM jsonb_array_elements_text(coalesce(p_attachment_urls, '[]'::jsonb)) AS u(url);
+
+    PERFORM set_thought_tags(p_user_id, v_thought.id, p_tags);
+
+    RETURN json_build_object('status', 'created', 'thought', thought_json(v_thought));
+END;
+$$;
+
+-- the subset of p_source_ids (a JSON array) already imported from p_source, trashed thoughts included
+CREATE OR REPLACE FUNCTION imported_source_ids(p_user_id uuid, p_source text, p_source_ids jsonb)
+RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(json_agg(t.source_id), '[]'::json)
+    FROM user_thoughts t
+    WHERE t.user_id = p_user_id AND t.source = p_source
+      AND t.source_id IN (SELECT jsonb_array_elements_text(coalesce(p_source_ids, '[]'::jsonb)))
+$$;
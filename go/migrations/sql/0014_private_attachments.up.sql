@@ -0,0 +1,131 @@
+-- the bucket is private: attachments are stored by object key and the API hands out presigned URLs
+-- url is kept for rows written before this migration, new rows only have a key
+ALTER TABLE thought_attachments ADD COLUMN IF NOT EXISTS key text;
+
+-- https://<bucket>.s3.amazonaws.com/<key> and the local store's http://<host>/blobs/<key>
+UPDATE thought_attachments
+SET key = regexp_replace(url, '^[a-z]+://[^/]+/(blobs/)?', '')
+WHERE key IS NULL AND url IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id',               t.id,
+        'thought',          t.thought,
+        'pinned',           coalesce(t.pinned, false),
+        'created_at',       t.created_at,
+        'edited_at',        t.edited_at,
+        'deleted_at',       t.deleted_at,
+        'embedding_status', t.embedding_status,
+        'topic_id',         t.topic_id,
+        'attachments',      coalesce((
+            SELECT jsonb_agg(a.key ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.key IS NOT NULL
+        ), '[]'::jsonb),
+        'tags',             coalesce((
+            SELECT jsonb_agg(g.tag ORDER BY g.tag)
+            FROM thought_tags g
+            WHERE g.thought_id = t.id
+        ), '[]'::jsonb)
+    ))
+$$;
+
+DROP FUNCTION IF EXISTS new_thought(uuid, text, vector, jsonb, jsonb);
+
+CREATE OR REPLACE FUNCTION new_thought(p_user_id uuid, p_thought text, p_embedding vector, p_attachment_keys jsonb, p_tags jsonb)
+RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_id uuid;
+    v_created timestamptz;
+    v_status text;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding, embedding_status)
+    VALUES (p_user_id, p_thought, p_embedding, CASE WHEN p_embedding IS NULL THEN 'pending' ELSE 'ready' END)
+    RETURNING id, created_at, embedding_status INTO v_id, v_created, v_status;
+
+    INSERT INTO thought_attachments (thought_id, file_name, key)
+    SELECT v_id, regexp_replace(k.key, '^.*/', ''), k.key
+    FROM jsonb_array_elements_text(coalesce(p_attachment_keys, '[]'::jsonb)) AS k(key);
+
+    PERFORM set_thought_tags(p_user_id, v_id, p_tags);
+
+    RETURN json_build_object('id', v_id, 'created_at', v_created, 'embedding_status', v_status);
+END;
+$$;
+
+DROP FUNCTION IF EXISTS import_thought(uuid, text, timestamptz, vector, jsonb, jsonb, text, text);
+
+CREATE OR REPLACE FUNCTION import_thought(
+    p_user_id uuid, p_thought text, p_created_at timestamptz, p_embedding vector,
+    p_attachment_keys jsonb, p_tags jsonb, p_source text, p_source_id text
+) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_thought user_thoughts;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding, embedding_status, created_at, source, source_id)
+    VALUES (
+        p_user_id, p_thought, p_embedding, CASE WHEN p_embedding IS NULL THEN 'pending' ELSE 'ready' END,
+        p_created_at, p_source, p_source_id
+    )
+    ON CONFLICT (user_id, source, source_id) WHERE source_id IS NOT NULL DO NOTHING
+    RETURNING * INTO v_thought;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'exists');
+    END IF;
+
+    INSERT INTO thought_attachments (thought_id, file_name, key)
+    SELECT v_thought.id, regexp_replace(k.key, '^.*/', ''), k.key
+    FROM jsonb_array_elements_text(coalesce(p_attachment_keys, '[]'::jsonb)) AS k(key);
+
+    PERFORM set_thought_tags(p_user_id, v_thought.id, p_tags);
+
+    RETURN json_build_object('status', 'created', 'thought', thought_json(v_thought));
+END;
+$$;
+
+-- returns [{deleted, attachment_keys, thought_id}] so the caller can remove the files
+CREATE OR REPLACE FUNCTION purge_trash(p_older_than_secs int, p_limit int) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_purged json;
+BEGIN
+    WITH expired AS (
+        SELECT id FROM user_thoughts
+        WHERE deleted_at < now() - make_interval(secs => p_older_than_secs)
+        ORDER BY deleted_at
+        LIMIT p_limit
+        FOR UPDATE SKIP LOCKED
+    ), keys AS (
+        SELECT e.id, coalesce(json_agg(a.key) FILTER (WHERE a.key IS NOT NULL), '[]'::json) AS attachment_keys
+        FROM expired e
+        LEFT JOIN thought_attachments a ON a.thought_id = e.id
+        GROUP BY e.id
+    ), deleted AS (
+        -- attachment rows and versions go with the thought (ON DELETE CASCADE)
+        DELETE FROM user_thoughts t
+        USING expired e
+        WHERE t.id = e.id
+        RETURNING t.id
+    )
+    SELECT coalesce(json_agg(json_build_object(
+        'deleted',         true,
+        'attachment_keys', k.attachment_keys,
+        'thought_id',      d.id
+    )), '[]'::json)
+    INTO v_purged
+    FROM deleted d
+    JOIN keys k ON k.id = d.id;
+
+    RETURN v_purged;
+END;
+$$;
@@ -0,0 +1,93 @@
+-- restore the 0014 versions
+DROP FUNCTION IF EXISTS import_thought(uuid, text, timestamptz, vector, jsonb, jsonb, text, text);
+DROP FUNCTION IF EXISTS new_thought(uuid, text, vector, jsonb, jsonb);
+DROP FUNCTION IF EXISTS insert_attachments(uuid, jsonb);
+
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id',               t.id,
+        'thought',          t.thought,
+        'pinned',           coalesce(t.pinned, false),
+        'created_at',       t.created_at,
+        'edited_at',        t.edited_at,
+        'deleted_at',       t.deleted_at,
+        'embedding_status', t.embedding_status,
+        'topic_id',         t.topic_id,
+        'attachments',      coalesce((
+            SELECT jsonb_agg(a.key ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.key IS NOT NULL
+        ), '[]'::jsonb),
+        'tags',             coalesce((
+            SELECT jsonb_agg(g.tag ORDER BY g.tag)
+            FROM thought_tags g
+            WHERE g.thought_id = t.id
+        ), '[]'::jsonb)
+    ))
+$$;
+
+CREATE OR REPLACE FUNCTION new_thought(p_user_id uuid, p_thought text, p_embedding vector, p_attachment_keys jsonb, p_tags jsonb)
+RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_id uuid;
+    v_created timestamptz;
+    v_status text;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding, embedding_status)
+    VALUES (p_user_id, p_thought, p_embedding, CASE WHEN p_embedding IS NULL THEN 'pending' ELSE 'ready' END)
+    RETURNING id, created_at, embedding_status INTO v_id, v_created, v_status;
+
+    INSERT INTO thought_attachments (thought_id, file_name, key)
+    SELECT v_id, regexp_replace(k.key, '^.*/', ''), k.key
+    FROM jsonb_array_elements_text(coalesce(p_attachment_keys, '[]'::jsonb)) AS k(key);
+
+    PERFORM set_thought_tags(p_user_id, v_id, p_tags);
+
+    RETURN json_build_object('id', v_id, 'created_at', v_created, 'embedding_status', v_status);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION import_thought(
+    p_user_id uuid, p_thought text, p_created_at timestamptz, p_embedding vector,
+    p_attachment_keys jsonb, p_tags jsonb, p_source text, p_source_id text
+) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_thought user_thoughts;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding, embedding_status, created_at, source, source_id)
+    VALUES (
+        p_user_id, p_thought, p_embedding, CASE WHEN p_embedding IS NULL THEN 'pending' ELSE 'ready' END,
+        p_created_at, p_source, p_source_id
+    )
+    ON CONFLICT (user_id, source, source_id) WHERE source_id IS NOT NULL DO NOTHING
+    RETURNING * INTO v_thought;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'exists');
+    END IF;
+
+    INSERT INTO thought_attachments (thought_id, file_name, key)
+    SELECT v_thought.id, regexp_replace(k.key, '^.*/', ''), k.key
+    FROM jsonb_array_elements_text(coalesce(p_attachment_keys, '[]'::jsonb)) AS k(key);
+
+    PERFORM set_thought_tags(p_user_id, v_thought.id, p_tags);
+
+    RETURN json_build_object('status', 'created', 'thought', thought_json(v_thought));
+END;
+$$;
+
+DROP FUNCTION IF EXISTS attachment_json(thought_attachments);
+
+ALTER TABLE thought_attachments
+    DROP COLUMN IF EXISTS sha256,
+    DROP COLUMN IF EXISTS size,
+    DROP COLUMN IF EXISTS content_type;
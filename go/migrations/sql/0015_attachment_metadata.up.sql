@@ -0,0 +1,118 @@
+-- what's known about each attached file; rows saved before this migration only have a key and a
+-- file name (the last segment of the key)
+ALTER TABLE thought_attachments
+    ADD COLUMN IF NOT EXISTS content_type text,
+    ADD COLUMN IF NOT EXISTS size         bigint,
+    ADD COLUMN IF NOT EXISTS sha256       text;
+
+CREATE OR REPLACE FUNCTION attachment_json(a thought_attachments) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id',           a.id,
+        'key',          a.key,
+        'file_name',    a.file_name,
+        'content_type', a.content_type,
+        'size',         a.size,
+        'sha256',       a.sha256,
+        'created_at',   a.uploaded_at
+    ))
+$$;
+
+CREATE OR REPLACE FUNCTION thought_json(t user_thoughts) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id',               t.id,
+        'thought',          t.thought,
+        'pinned',           coalesce(t.pinned, false),
+        'created_at',       t.created_at,
+        'edited_at',        t.edited_at,
+        'deleted_at',       t.deleted_at,
+        'embedding_status', t.embedding_status,
+        'topic_id',         t.topic_id,
+        'attachments',      coalesce((
+            SELECT jsonb_agg(attachment_json(a) ORDER BY a.uploaded_at, a.id)
+            FROM thought_attachments a
+            WHERE a.thought_id = t.id AND a.key IS NOT NULL
+        ), '[]'::jsonb),
+        'tags',             coalesce((
+            SELECT jsonb_agg(g.tag ORDER BY g.tag)
+            FROM thought_tags g
+            WHERE g.thought_id = t.id
+        ), '[]'::jsonb)
+    ))
+$$;
+
+-- p_attachments is a JSON array of {key, file_name, content_type, size, sha256}
+CREATE OR REPLACE FUNCTION insert_attachments(p_thought_id uuid, p_attachments jsonb) RETURNS void
+LANGUAGE sql AS $$
+    INSERT INTO thought_attachments (thought_id, key, file_name, content_type, size, sha256)
+    SELECT p_thought_id, a.key, a.file_name, nullif(a.content_type, ''), nullif(a.size, 0), nullif(a.sha256, '')
+    FROM jsonb_to_recordset(coalesce(p_attachments, '[]'::jsonb))
+        AS a(key text, file_name text, content_type text, size bigint, sha256 text)
+$$;
+
+DROP FUNCTION IF EXISTS new_thought(uuid, text, vector, jsonb, jsonb);
+
+-- returns the new attachment rows too, so the caller has their IDs
+CREATE OR REPLACE FUNCTION new_thought(p_user_id uuid, p_thought text, p_embedding vector, p_attachments jsonb, p_tags jsonb)
+RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_id uuid;
+    v_created timestamptz;
+    v_status text;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding, embedding_status)
+    VALUES (p_user_id, p_thought, p_embedding, CASE WHEN p_embedding IS NULL THEN 'pending' ELSE 'ready' END)
+    RETURNING id, created_at, embedding_status INTO v_id, v_created, v_status;
+
+    PERFORM insert_attachments(v_id, p_attachments);
+
+    PERFORM set_thought_tags(p_user_id, v_id, p_tags);
+
+    RETURN json_build_object(
+        'id', v_id, 'created_at', v_created, 'embedding_status', v_status,
+        'attachments', (
+            SELECT coalesce(jsonb_agg(attachment_json(a) ORDER BY a.uploaded_at, a.id), '[]'::jsonb)
+            FROM thought_attachments a
+            WHERE a.thought_id = v_id
+        )
+    );
+END;
+$$;
+
+DROP FUNCTION IF EXISTS import_thought(uuid, text, timestamptz, vector, jsonb, jsonb, text, text);
+
+CREATE OR REPLACE FUNCTION import_thought(
+    p_user_id uuid, p_thought text, p_created_at timestamptz, p_embedding vector,
+    p_attachments jsonb, p_tags jsonb, p_source text, p_source_id text
+) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_thought user_thoughts;
+BEGIN
+    INSERT INTO users (user_id) VALUES (p_user_id)
+    ON CONFLICT (user_id) DO NOTHING;
+
+    INSERT INTO user_thoughts (user_id, thought, embedding, embedding_status, created_at, source, source_id)
+    VALUES (
+        p_user_id, p_thought, p_embedding, CASE WHEN p_embedding IS NULL THEN 'pending' ELSE 'ready' END,
+        p_created_at, p_source, p_source_id
+    )
+    ON CONFLICT (user_id, source, source_id) WHERE source_id IS NOT NULL DO NOTHING
+    RETURNING * INTO v_thought;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'exists');
+    END IF;
+
+    PERFORM insert_attachments(v_thought.id, p_attachments);
+
+    PERFORM set_thought_tags(p_user_id, v_thought.id, p_tags);
+
+    RETURN json_build_object('status', 'created', 'thought', thought_json(v_thought));
+END;
+$$;
@@ -0,0 +1,64 @@
+-- restore the 0015 versions
+CREATE OR REPLACE FUNCTION attachment_json(a thought_attachments) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id',           a.id,
+        'key',          a.key,
+        'file_name',    a.file_name,
+        'content_type', a.content_type,
+        'size',         a.size,
+        'sha256',       a.sha256,
+        'created_at',   a.uploaded_at
+    ))
+$$;
+
+-- p_attachments is a JSON array of {key, file_name, content_type, size, sha256}
+CREATE OR REPLACE FUNCTION insert_attachments(p_thought_id uuid, p_attachments jsonb) RETURNS void
+LANGUAGE sql AS $$
+    INSERT INTO thought_attachments (thought_id, key, file_name, content_type, size, sha256)
+    SELECT p_thought_id, a.key, a.file_name, nullif(a.content_type, ''), nullif(a.size, 0), nullif(a.sha256, '')
+    FROM jsonb_to_recordset(coalesce(p_attachments, '[]'::jsonb))
+        AS a(key text, file_name text, content_type text, size bigint, sha256 text)
+$$;
+
+-- returns [{deleted, attachment_keys, thought_id}] so the caller can remove the files
+CREATE OR REPLACE FUNCTION purge_trash(p_older_than_secs int, p_limit int) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_purged json;
+BEGIN
+    WITH expired AS (
+        SELECT id FROM user_thoughts
+        WHERE deleted_at < now() - make_interval(secs => p_older_than_secs)
+        ORDER BY deleted_at
+        LIMIT p_limit
+        FOR UPDATE SKIP LOCKED
+    ), keys AS (
+        SELECT e.id, coalesce(json_agg(a.key) FILTER (WHERE a.key IS NOT NULL), '[]'::json) AS attachment_keys
+        FROM expired e
+        LEFT JOIN thought_attachments a ON a.thought_id = e.id
+        GROUP BY e.id
+    ), deleted AS (
+        -- attachment rows and versions go with the thought (ON DELETE CASCADE)
+        DELETE FROM user_thoughts t
+        USING expired e
+        WHERE t.id = e.id
+        RETURNING t.id
+    )
+    SELECT coalesce(json_agg(json_build_object(
+        'deleted',         true,
+        'attachment_keys', k.attachment_keys,
+        'thought_id',      d.id
+    )), '[]'::json)
+    INTO v_purged
+    FROM deleted d
+    JOIN keys k ON k.id = d.id;
+
+    RETURN v_purged;
+END;
+$$;
+
+ALTER TABLE thought_attachments
+    DROP COLUMN IF EXISTS thumbnails,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS width;
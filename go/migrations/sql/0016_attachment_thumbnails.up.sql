@@ -0,0 +1,73 @@
+-- pixel dimensions of image attachments, and their thumbnails as [{width, height, key}], smallest first
+ALTER TABLE thought_attachments
+    ADD COLUMN IF NOT EXISTS width      int,
+    ADD COLUMN IF NOT EXISTS height     int,
+    ADD COLUMN IF NOT EXISTS thumbnails jsonb;
+
+CREATE OR REPLACE FUNCTION attachment_json(a thought_attachments) RETURNS jsonb
+LANGUAGE sql STABLE AS $$
+    SELECT jsonb_strip_nulls(jsonb_build_object(
+        'id',           a.id,
+        'key',          a.key,
+        'file_name',    a.file_name,
+        'content_type', a.content_type,
+        'size',         a.size,
+        'sha256',       a.sha256,
+        'width',        a.width,
+        'height',       a.height,
+        'thumbnails',   a.thumbnails,
+        'created_at',   a.uploaded_at
+    ))
+$$;
+
+-- p_attachments is a JSON array of {key, file_name, content_type, size, sha256, width, height, thumbnails}
+CREATE OR REPLACE FUNCTION insert_attachments(p_thought_id uuid, p_attachments jsonb) RETURNS void
+LANGUAGE sql AS $$
+    INSERT INTO thought_attachments (thought_id, key, file_name, content_type, size, sha256, width, height, thumbnails)
+    SELECT p_thought_id, a.key, a.file_name, nullif(a.content_type, ''), nullif(a.size, 0), nullif(a.sha256, ''),
+        nullif(a.width, 0), nullif(a.height, 0), nullif(nullif(a.thumbnails, 'null'::jsonb), '[]'::jsonb)
+    FROM jsonb_to_recordset(coalesce(p_attachments, '[]'::jsonb))
+        AS a(key text, file_name text, content_type text, size bigint, sha256 text, width int, height int, thumbnails jsonb)
+$$;
+
+-- attachment_keys now include the thumbnails, so purging deletes them too
+CREATE OR REPLACE FUNCTION purge_trash(p_older_than_secs int, p_limit int) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_purged json;
+BEGIN
+    WITH expired AS (
+        SELECT id FROM user_thoughts
+        WHERE deleted_at < now() - make_interval(secs => p_older_than_secs)
+        ORDER BY deleted_at
+        LIMIT p_limit
+        FOR UPDATE SKIP LOCKED
+    ), keys AS (
+        SELECT e.id, coalesce(json_agg(k.key) FILTER (WHERE k.key IS NOT NULL), '[]'::json) AS attachment_keys
+        FROM expired e
+        LEFT JOIN thought_attachments a ON a.thought_id = e.id
+        LEFT JOIN LATERAL (
+            SELECT a.key
+            UNION ALL
+            SELECT t->>'key' FROM jsonb_array_elements(coalesce(a.thumbnails, '[]'::jsonb)) AS t
+        ) k ON true
+        GROUP BY e.id
+    ), deleted AS (
+        -- attachment rows and versions go with the thought (ON DELETE CASCADE)
+        DELETE FROM user_thoughts t
+        USING expired e
+        WHERE t.id = e.id
+        RETURNING t.id
+    )
+    SELECT coalesce(json_agg(json_build_object(
+        'deleted',         true,
+        'attachment_keys', k.attachment_keys,
+        'thought_id',      d.id
+    )), '[]'::json)
+    INTO v_purged
+    FROM deleted d
+    JOIN keys k ON k.id = d.id;
+
+    RETURN v_purged;
+END;
+$$;
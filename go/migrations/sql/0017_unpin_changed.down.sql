@@ -0,0 +1,14 @@
+-- restore the 0008 version
+CREATE OR REPLACE FUNCTION unpin_thought(p_user_id uuid, p_thought_id uuid) RETURNS json
+LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE user_thoughts SET pinned = false
+    WHERE id = p_thought_id AND user_id = p_user_id AND deleted_at IS NULL;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'not_found');
+    END IF;
+
+    RETURN json_build_object('status', 'ok', 'pinned_thoughts', pinned_thoughts_json(p_user_id));
+END;
+$$;
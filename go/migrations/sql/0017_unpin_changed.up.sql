@@ -0,0 +1,22 @@
+-- reports whether the thought was pinned, so unpinning an unpinned thought doesn't notify clients
+CREATE OR REPLACE FUNCTION unpin_thought(p_user_id uuid, p_thought_id uuid) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_pinned boolean;
+BEGIN
+    SELECT coalesce(pinned, false) INTO v_pinned
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id AND deleted_at IS NULL
+    FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'not_found');
+    END IF;
+
+    IF v_pinned THEN
+        UPDATE user_thoughts SET pinned = false WHERE id = p_thought_id;
+    END IF;
+
+    RETURN json_build_object('status', 'ok', 'changed', v_pinned, 'pinned_thoughts', pinned_thoughts_json(p_user_id));
+END;
+$$;
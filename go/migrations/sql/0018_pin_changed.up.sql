@@ -0,0 +1,33 @@
+-- reports whether the thought was unpinned before, so pinning a pinned thought doesn't notify clients
+CREATE OR REPLACE FUNCTION pin_thought(p_user_id uuid, p_thought_id uuid, p_max_pins int) RETURNS json
+LANGUAGE plpgsql AS $$
+DECLARE
+    v_pinned boolean;
+    v_count int;
+BEGIN
+    PERFORM 1 FROM users WHERE user_id = p_user_id FOR UPDATE;
+
+    SELECT coalesce(pinned, false) INTO v_pinned
+    FROM user_thoughts
+    WHERE id = p_thought_id AND user_id = p_user_id AND deleted_at IS NULL;
+
+    IF NOT FOUND THEN
+        RETURN json_build_object('status', 'not_found');
+    END IF;
+
+    IF NOT v_pinned THEN
+        SELECT count(*) INTO v_count
+        FROM user_thoughts
+        WHERE user_id = p_user_id AND pinned AND deleted_at IS NULL;
+
+        IF v_count >= p_max_pins THEN
+            RETURN json_build_object('status', 'limit_reached');
+        END IF;
+
+        UPDATE user_thoughts SET pinned = true
+        WHERE id = p_thought_id AND user_id = p_user_id;
+    END IF;
+
+    RETURN json_build_object('status', 'ok', 'changed', NOT v_pinned, 'pinned_thoughts', pinned_thoughts_json(p_user_id));
+END;
+$$;
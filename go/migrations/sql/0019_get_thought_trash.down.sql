@@ -0,0 +1,18 @@
+-- restore the 0006 versions
+CREATE OR REPLACE FUNCTION get_thought(p_user_id uuid, p_thought_id uuid) RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT thought_json(t)::json
+    FROM user_thoughts t
+    WHERE t.id = p_thought_id AND t.user_id = p_user_id
+$$;
+
+CREATE OR REPLACE FUNCTION list_pending_embeddings(p_older_than_secs int, p_limit int) RETURNS json
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(json_agg(json_build_object('user_id', p.user_id, 'thought_id', p.id)), '[]'::json)
+    FROM (
+        SELECT id, user_id FROM user_thoughts
+        WHERE embedding_status = 'pending' AND embedding_updated_at < now() - make_interval(secs => p_older_than_secs)
+        ORDER BY embedding_updated_at
+        LIMIT p_limit
+    ) p
+$$;
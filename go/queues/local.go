@@ -0,0 +1,80 @@
+package queues
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	localRetryBaseDelay = 2 * time.Second
+	localRetryMaxDelay  = 2 * time.Minute
+)
+
+type localJob struct {
+	job      EmbeddingJob
+	attempts int
+}
+
+// LocalQueue is a buffered channel with a pool of worker goroutines and exponential backoff retries
+// jobs are lost on restart, but the thought stays pending so the scheduled sweep re-enqueues it
+type LocalQueue struct {
+	jobs        chan localJob
+	maxAttempts int
+}
+
+func NewLocalQueue(buffer int, maxAttempts int) *LocalQueue {
+	return &LocalQueue{
+		jobs:        make(chan localJob, buffer),
+		maxAttempts: maxAttempts,
+	}
+}
+
+// never blocks the request; a full buffer is reported so the caller can log it and rely on the sweep
+func (q *LocalQueue) Enqueue(ctx context.Context, job EmbeddingJob) error {
+	select {
+	case q.jobs <- localJob{job: job}:
+		return nil
+	default:
+		return fmt.Errorf("local embedding queue is full")
+	}
+}
+
+// starts workers that run until ctx is cancelled
+func (q *LocalQueue) Start(ctx context.Context, workers int, process ProcessFunc) {
+	for i := 0; i < workers; i++ {
+		go q.work(ctx, process)
+	}
+}
+
+func (q *LocalQueue) work(ctx context.Context, process ProcessFunc) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-q.jobs:
+			err := process(ctx, j.job)
+			if err == nil {
+				continue
+			}
+
+			j.attempts++
+			if j.attempts >= q.maxAttempts {
+				log.Printf("[QUEUE] Giving up on thought %s after %d attempts: %v", j.job.ThoughtID, j.attempts, err)
+				continue
+			}
+
+			delay := min(localRetryBaseDelay<<(j.attempts-1), localRetryMaxDelay)
+			log.Printf("[QUEUE] Job for thought %s failed (attempt %d), retrying in %v: %v", j.job.ThoughtID, j.attempts, delay, err)
+
+			time.AfterFunc(delay, func() {
+				select {
+				case q.jobs <- j:
+				default:
+					log.Printf("[QUEUE] Dropping retry for thought %s, queue is full", j.job.ThoughtID)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package queues
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// EmbeddingJob asks a worker to embed the current text of a thought
+type EmbeddingJob struct {
+	UserID    uuid.UUID `json:"user_id"`
+	ThoughtID uuid.UUID `json:"thought_id"`
+}
+
+// returning an error means the job should be retried
+type ProcessFunc func(ctx context.Context, job EmbeddingJob) error
+
+// SQSQueue is used in production (worker is an SQS-triggered Lambda), LocalQueue runs workers in process
+type EmbeddingQueue interface {
+	Enqueue(ctx context.Context, job EmbeddingJob) error
+}
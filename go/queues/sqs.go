@@ -0,0 +1,65 @@
+package queues
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// SQSQueue sends jobs to SQS; retries come from the visibility timeout and the queue's redrive policy
+type SQSQueue struct {
+	client   *sqs.Client
+	queueURL string
+}
+
+func NewSQSQueue(client *sqs.Client, queueURL string) *SQSQueue {
+	return &SQSQueue{client: client, queueURL: queueURL}
+}
+
+func (q *SQSQueue) Enqueue(ctx context.Context, job EmbeddingJob) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding job: %w", err)
+	}
+
+	_, err = q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.queueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send embedding job to SQS: %w", err)
+	}
+
+	return nil
+}
+
+// Lambda handler for the SQS trigger; failed messages are reported individually so only they are retried
+// (the event source mapping needs ReportBatchItemFailures enabled)
+func NewSQSEventHandler(process ProcessFunc) func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	return func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+		var response events.SQSEventResponse
+
+		for _, message := range event.Records {
+			var job EmbeddingJob
+			if err := json.Unmarshal([]byte(message.Body), &job); err != nil {
+				// retrying a malformed message won't help, let it go
+				log.Printf("[QUEUE] Dropping malformed message %s: %v", message.MessageId, err)
+				continue
+			}
+
+			if err := process(ctx, job); err != nil {
+				log.Printf("[QUEUE] Job for thought %s failed: %v", job.ThoughtID, err)
+				response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{
+					ItemIdentifier: message.MessageId,
+				})
+			}
+		}
+
+		return response, nil
+	}
+}
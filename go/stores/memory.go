@@ -0,0 +1,685 @@
+package stores
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/types"
+	"github.com/skarokin/runsynapse/go/utils"
+)
+
+type memoryThought struct {
+	userID    uuid.UUID
+	thought   types.Thought
+	createdAt time.Time
+	embedding []float32
+
+	embeddingAttempts  int
+	embeddingError     string
+	embeddingUpdatedAt time.Time
+
+	versions []types.ThoughtVersion // oldest first
+
+	deletedAt time.Time // zero unless the thought is in the trash
+
+	topicID uuid.UUID // uuid.Nil until the clustering job assigns a topic
+
+	source   string // set on imported thoughts only
+	sourceID string
+}
+
+type memoryTopic struct {
+	id        uuid.UUID
+	label     string
+	createdAt time.Time
+}
+
+// MemoryStore keeps everything in process memory; mirrors the semantics of the postgres functions
+// nothing survives a restart, so only use it for local development
+type MemoryStore struct {
+	mu     sync.RWMutex
+	byUser map[uuid.UUID][]*memoryThought // ordered oldest first
+	byID   map[uuid.UUID]*memoryThought
+
+	topics    map[uuid.UUID][]*memoryTopic // by user
+	topicRuns map[uuid.UUID]time.Time      // when each user was last clustered
+
+	digests map[uuid.UUID][]types.Digest // by user
+
+	// by user, then source: the source IDs imported so far, trashed thoughts included
+	imported map[uuid.UUID]map[string]map[string]bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		byUser:    make(map[uuid.UUID][]*memoryThought),
+		byID:      make(map[uuid.UUID]*memoryThought),
+		topics:    make(map[uuid.UUID][]*memoryTopic),
+		topicRuns: make(map[uuid.UUID]time.Time),
+		digests:   make(map[uuid.UUID][]types.Digest),
+		imported:  make(map[uuid.UUID]map[string]map[string]bool),
+	}
+}
+
+func (s *MemoryStore) LoadThoughtsAndPins(ctx context.Context, userID uuid.UUID) (*LoadResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userThoughts := s.active(userID, LoadFilter{})
+	thoughts, hasMoreAbove := pageBefore(userThoughts, len(userThoughts))
+
+	return &LoadResult{
+		Thoughts:       thoughts,
+		PinnedThoughts: s.pinned(userID),
+		HasMoreAbove:   hasMoreAbove,
+	}, nil
+}
+
+func (s *MemoryStore) LoadMore(ctx context.Context, userID uuid.UUID, cursor uuid.UUID, filter LoadFilter) (*LoadResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	before := s.active(userID, filter)
+	if cursor != uuid.Nil {
+		var ok bool
+		before, _, ok = s.splitAt(userID, cursor, filter)
+		if !ok {
+			// unknown cursor (purged or not this user's) so there is nothing to page from
+			return &LoadResult{}, nil
+		}
+	}
+
+	thoughts, hasMoreAbove := pageBefore(before, len(before))
+	return &LoadResult{
+		Thoughts:     thoughts,
+		HasMoreAbove: hasMoreAbove,
+	}, nil
+}
+
+func (s *MemoryStore) LoadAfter(ctx context.Context, userID uuid.UUID, cursor uuid.UUID, filter LoadFilter) (*LoadResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, after, ok := s.splitAt(userID, cursor, filter)
+	if !ok {
+		return &LoadResult{}, nil
+	}
+
+	thoughts, hasMoreBelow := pageAfter(after, 0, PageSize)
+	return &LoadResult{
+		Thoughts:     thoughts,
+		HasMoreBelow: hasMoreBelow,
+	}, nil
+}
+
+func (s *MemoryStore) LoadAround(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (*LoadResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.byID[thoughtID]
+	if !ok || t.userID != userID || !t.deletedAt.IsZero() {
+		return nil, ErrThoughtNotFound
+	}
+
+	before, after, _ := s.splitAt(userID, thoughtID, LoadFilter{})
+	above, hasMoreAbove := pageBeforeN(before, len(before), PageSize/2)
+	below, hasMoreBelow := pageAfter(after, 0, PageSize/2)
+
+	thoughts := append(above, copyThought(t))
+	thoughts = append(thoughts, below...)
+
+	return &LoadResult{
+		Thoughts:     thoughts,
+		HasMoreAbove: hasMoreAbove,
+		HasMoreBelow: hasMoreBelow,
+	}, nil
+}
+
+func (s *MemoryStore) NewThought(ctx context.Context, userID uuid.UUID, thought string, embedding []float32, attachments []types.Attachment) (*types.Thought, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := EmbeddingReady
+	if len(embedding) == 0 {
+		status = EmbeddingPending
+	}
+
+	now := time.Now().UTC()
+	t := &memoryThought{
+		userID: userID,
+		thought: types.Thought{
+			ID:              uuid.New(),
+			Thought:         thought,
+			Pinned:          false,
+			Created:         now.Format(time.RFC3339Nano),
+			EmbeddingStatus: status,
+			Attachments:     newAttachments(attachments, now),
+			Tags:            utils.ExtractHashtags(thought),
+		},
+		createdAt:          now,
+		embedding:          embedding,
+		embeddingUpdatedAt: now,
+	}
+
+	s.byUser[userID] = append(s.byUser[userID], t)
+	s.byID[t.thought.ID] = t
+
+	res := copyThought(t)
+	return &res, nil
+}
+
+func (s *MemoryStore) ImportThought(ctx context.Context, userID uuid.UUID, thought ImportedThought) (*types.Thought, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.imported[userID][thought.Source][thought.SourceID] {
+		return nil, ErrAlreadyImported
+	}
+
+	status := EmbeddingReady
+	if len(thought.Embedding) == 0 {
+		status = EmbeddingPending
+	}
+
+	createdAt := thought.CreatedAt.UTC()
+	t := &memoryThought{
+		userID: userID,
+		thought: types.Thought{
+			ID:              uuid.New(),
+			Thought:         thought.Thought,
+			Pinned:          false,
+			Created:         createdAt.Format(time.RFC3339Nano),
+			EmbeddingStatus: status,
+			Attachments:     newAttachments(thought.Attachments, time.Now().UTC()),
+			Tags:            utils.ExtractHashtags(thought.Thought),
+		},
+		createdAt:          createdAt,
+		embedding:          thought.Embedding,
+		embeddingUpdatedAt: time.Now().UTC(),
+		source:             thought.Source,
+		sourceID:           thought.SourceID,
+	}
+
+	// byUser stays in creation order, and imported thoughts are usually older than everything else
+	userThoughts := s.byUser[userID]
+	i := sort.Search(len(userThoughts), func(i int) bool {
+		return userThoughts[i].createdAt.After(createdAt)
+	})
+	s.byUser[userID] = slices.Insert(userThoughts, i, t)
+	s.byID[t.thought.ID] = t
+	s.markImported(t)
+
+	res := copyThought(t)
+	return &res, nil
+}
+
+func (s *MemoryStore) ImportedSourceIDs(ctx context.Context, userID uuid.UUID, source string, sourceIDs []string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.imported[userID][source]
+
+	var imported []string
+	for _, id := range sourceIDs {
+		if index[id] {
+			imported = append(imported, id)
+		}
+	}
+	return imported, nil
+}
+
+// callers must hold the lock
+func (s *MemoryStore) markImported(t *memoryThought) {
+	if t.sourceID == "" {
+		return
+	}
+
+	bySource := s.imported[t.userID]
+	if bySource == nil {
+		bySource = make(map[string]map[string]bool)
+		s.imported[t.userID] = bySource
+	}
+	if bySource[t.source] == nil {
+		bySource[t.source] = make(map[string]bool)
+	}
+	bySource[t.source][t.sourceID] = true
+}
+
+// a purged thought can be imported again; callers must hold the lock
+func (s *MemoryStore) unmarkImported(t *memoryThought) {
+	if t.sourceID == "" {
+		return
+	}
+	delete(s.imported[t.userID][t.source], t.sourceID)
+}
+
+func (s *MemoryStore) GetThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (*types.Thought, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.byID[thoughtID]
+	if !ok || t.userID != userID || !t.deletedAt.IsZero() {
+		return nil, ErrThoughtNotFound
+	}
+
+	res := copyThought(t)
+	return &res, nil
+}
+
+func (s *MemoryStore) EditThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID, thought string) (*types.Thought, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.byID[thoughtID]
+	if !ok || t.userID != userID || !t.deletedAt.IsZero() {
+		return nil, ErrThoughtNotFound
+	}
+
+	if t.thought.Thought != thought {
+		writtenAt := t.thought.EditedAt
+		if writtenAt == "" {
+			writtenAt = t.thought.Created
+		}
+
+		now := time.Now().UTC()
+		t.versions = append(t.versions, types.ThoughtVersion{
+			Thought:    t.thought.Thought,
+			WrittenAt:  writtenAt,
+			ReplacedAt: now.Format(time.RFC3339Nano),
+		})
+
+		// the old embedding stays for vector search until the worker replaces it
+		t.thought.Thought = thought
+		t.thought.Tags = utils.ExtractHashtags(thought)
+		t.thought.EditedAt = now.Format(time.RFC3339Nano)
+		t.thought.EmbeddingStatus = EmbeddingPending
+		t.embeddingAttempts = 0
+		t.embeddingError = ""
+		t.embeddingUpdatedAt = now
+	}
+
+	res := copyThought(t)
+	return &res, nil
+}
+
+func (s *MemoryStore) ListThoughtVersions(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) ([]types.ThoughtVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.byID[thoughtID]
+	if !ok || t.userID != userID {
+		return nil, ErrThoughtNotFound
+	}
+
+	versions := make([]types.ThoughtVersion, 0, len(t.versions))
+	for i := len(t.versions) - 1; i >= 0; i-- {
+		versions = append(versions, t.versions[i])
+	}
+	return versions, nil
+}
+
+func (s *MemoryStore) TrashThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.byID[thoughtID]
+	if !ok || t.userID != userID || !t.deletedAt.IsZero() {
+		return false, nil
+	}
+
+	t.deletedAt = time.Now().UTC()
+	t.thought.DeletedAt = t.deletedAt.Format(time.RFC3339Nano)
+	return true, nil
+}
+
+func (s *MemoryStore) RestoreThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (*types.Thought, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.byID[thoughtID]
+	if !ok || t.userID != userID || t.deletedAt.IsZero() {
+		return nil, ErrThoughtNotFound
+	}
+
+	if t.thought.Pinned && len(s.pinned(userID)) >= MaxPinnedThoughts {
+		t.thought.Pinned = false
+	}
+	t.deletedAt = time.Time{}
+	t.thought.DeletedAt = ""
+
+	res := copyThought(t)
+	return &res, nil
+}
+
+func (s *MemoryStore) ListTrash(ctx context.Context, userID uuid.UUID, limit int) ([]types.Thought, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var trashed []*memoryThought
+	for _, t := range s.byUser[userID] {
+		if !t.deletedAt.IsZero() {
+			trashed = append(trashed, t)
+		}
+	}
+
+	sort.SliceStable(trashed, func(i, j int) bool {
+		return trashed[i].deletedAt.After(trashed[j].deletedAt)
+	})
+	if len(trashed) > limit {
+		trashed = trashed[:limit]
+	}
+
+	thoughts := make([]types.Thought, len(trashed))
+	for i, t := range trashed {
+		thoughts[i] = copyThought(t)
+	}
+	return thoughts, nil
+}
+
+func (s *MemoryStore) PurgeTrash(ctx context.Context, olderThan time.Duration, limit int) ([]DeleteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-olderThan)
+
+	var purged []DeleteResult
+	for id, t := range s.byID {
+		if len(purged) >= limit {
+			break
+		}
+		if t.deletedAt.IsZero() || !t.deletedAt.Before(cutoff) {
+			continue
+		}
+
+		userThoughts := s.byUser[t.userID]
+		i := indexOf(userThoughts, id)
+		s.byUser[t.userID] = append(userThoughts[:i:i], userThoughts[i+1:]...)
+		delete(s.byID, id)
+		s.unmarkImported(t)
+
+		purged = append(purged, DeleteResult{
+			Deleted:        true,
+			AttachmentKeys: types.AttachmentKeys(t.thought.Attachments),
+			ThoughtID:      id.String(),
+		})
+	}
+
+	return purged, nil
+}
+
+func (s *MemoryStore) PinThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) ([]types.Thought, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.byID[thoughtID]
+	if !ok || t.userID != userID || !t.deletedAt.IsZero() {
+		return nil, false, ErrThoughtNotFound
+	}
+
+	changed := !t.thought.Pinned
+	if changed {
+		if len(s.pinned(userID)) >= MaxPinnedThoughts {
+			return nil, false, ErrPinLimitReached
+		}
+		t.thought.Pinned = true
+	}
+
+	return s.pinned(userID), changed, nil
+}
+
+func (s *MemoryStore) UnpinThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) ([]types.Thought, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.byID[thoughtID]
+	if !ok || t.userID != userID || !t.deletedAt.IsZero() {
+		return nil, false, ErrThoughtNotFound
+	}
+
+	changed := t.thought.Pinned
+	t.thought.Pinned = false
+
+	return s.pinned(userID), changed, nil
+}
+
+func (s *MemoryStore) ListTags(ctx context.Context, userID uuid.UUID) ([]types.TagCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, t := range s.active(userID, LoadFilter{}) {
+		for _, tag := range t.thought.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]types.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, types.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags, nil
+}
+
+func (s *MemoryStore) SetEmbedding(ctx context.Context, thoughtID uuid.UUID, thought string, embedding []float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.byID[thoughtID]
+	if !ok {
+		return ErrThoughtNotFound
+	}
+	if t.thought.Thought != thought {
+		return ErrThoughtChanged
+	}
+
+	t.embedding = embedding
+	t.thought.EmbeddingStatus = EmbeddingReady
+	t.embeddingError = ""
+	t.embeddingUpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (s *MemoryStore) MarkEmbeddingFailed(ctx context.Context, thoughtID uuid.UUID, reason string, maxAttempts int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.byID[thoughtID]
+	if !ok || t.thought.EmbeddingStatus == EmbeddingReady {
+		return EmbeddingReady, nil
+	}
+
+	t.embeddingAttempts++
+	t.embeddingError = reason
+	t.embeddingUpdatedAt = time.Now().UTC()
+	if t.embeddingAttempts >= maxAttempts {
+		t.thought.EmbeddingStatus = EmbeddingFailed
+	} else {
+		t.thought.EmbeddingStatus = EmbeddingPending
+	}
+
+	return t.thought.EmbeddingStatus, nil
+}
+
+func (s *MemoryStore) ListPendingEmbeddings(ctx context.Context, olderThan time.Duration, limit int) ([]PendingEmbedding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cutoff := time.Now().UTC().Add(-olderThan)
+
+	var pending []*memoryThought
+	for _, t := range s.byID {
+		if t.thought.EmbeddingStatus == EmbeddingPending && t.deletedAt.IsZero() && t.embeddingUpdatedAt.Before(cutoff) {
+			pending = append(pending, t)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].embeddingUpdatedAt.Before(pending[j].embeddingUpdatedAt)
+	})
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+
+	res := make([]PendingEmbedding, len(pending))
+	for i, t := range pending {
+		res[i] = PendingEmbedding{UserID: t.userID, ThoughtID: t.thought.ID}
+	}
+	return res, nil
+}
+
+// copies are taken under the lock and fn is called after releasing it, since it usually writes to the network
+func (s *MemoryStore) ExportThoughts(ctx context.Context, userID uuid.UUID, fn func(types.Thought) error) error {
+	s.mu.RLock()
+	var thoughts []types.Thought
+	for _, t := range s.active(userID, LoadFilter{}) {
+		thoughts = append(thoughts, copyThought(t))
+	}
+	s.mu.RUnlock()
+
+	for _, thought := range thoughts {
+		if err := fn(thought); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the user's thoughts that aren't in the trash (and match the filter), oldest first
+// callers must hold the lock
+func (s *MemoryStore) active(userID uuid.UUID, filter LoadFilter) []*memoryThought {
+	var active []*memoryThought
+	for _, t := range s.byUser[userID] {
+		if t.visible(filter) {
+			active = append(active, t)
+		}
+	}
+	return active
+}
+
+// active thoughts older and newer than the cursor, both oldest first; the cursor itself may be trashed
+// or outside the filter. ok is false if the cursor doesn't exist or isn't the user's; callers must hold the lock
+func (s *MemoryStore) splitAt(userID uuid.UUID, cursor uuid.UUID, filter LoadFilter) ([]*memoryThought, []*memoryThought, bool) {
+	userThoughts := s.byUser[userID]
+	i := indexOf(userThoughts, cursor)
+	if i == -1 {
+		return nil, nil, false
+	}
+
+	var before, after []*memoryThought
+	for _, t := range userThoughts[:i] {
+		if t.visible(filter) {
+			before = append(before, t)
+		}
+	}
+	for _, t := range userThoughts[i+1:] {
+		if t.visible(filter) {
+			after = append(after, t)
+		}
+	}
+	return before, after, true
+}
+
+func (t *memoryThought) visible(filter LoadFilter) bool {
+	return t.deletedAt.IsZero() &&
+		(filter.Tag == "" || slices.Contains(t.thought.Tags, filter.Tag)) &&
+		(filter.TopicID == uuid.Nil || t.topicID == filter.TopicID)
+}
+
+// pinned thoughts are newest first; callers must hold the lock
+func (s *MemoryStore) pinned(userID uuid.UUID) []types.Thought {
+	userThoughts := s.active(userID, LoadFilter{})
+
+	var pinned []types.Thought
+	for i := len(userThoughts) - 1; i >= 0; i-- {
+		if userThoughts[i].thought.Pinned {
+			pinned = append(pinned, copyThought(userThoughts[i]))
+		}
+	}
+	return pinned
+}
+
+// returns up to PageSize thoughts immediately before end, oldest first
+func pageBefore(userThoughts []*memoryThought, end int) ([]types.Thought, bool) {
+	return pageBeforeN(userThoughts, end, PageSize)
+}
+
+func pageBeforeN(userThoughts []*memoryThought, end int, n int) ([]types.Thought, bool) {
+	start := max(end-n, 0)
+
+	var thoughts []types.Thought
+	for _, t := range userThoughts[start:end] {
+		thoughts = append(thoughts, copyThought(t))
+	}
+	return thoughts, start > 0
+}
+
+// returns up to n thoughts starting at start, oldest first
+func pageAfter(userThoughts []*memoryThought, start int, n int) ([]types.Thought, bool) {
+	end := min(start+n, len(userThoughts))
+
+	var thoughts []types.Thought
+	for _, t := range userThoughts[start:end] {
+		thoughts = append(thoughts, copyThought(t))
+	}
+	return thoughts, end < len(userThoughts)
+}
+
+func indexOf(userThoughts []*memoryThought, thoughtID uuid.UUID) int {
+	for i, t := range userThoughts {
+		if t.thought.ID == thoughtID {
+			return i
+		}
+	}
+	return -1
+}
+
+// callers get their own copy so they can't mutate the store
+func copyThought(t *memoryThought) types.Thought {
+	res := t.thought
+	res.Attachments = copyAttachments(t.thought.Attachments)
+	res.Tags = append([]string(nil), t.thought.Tags...)
+	if t.topicID != uuid.Nil {
+		topicID := t.topicID
+		res.TopicID = &topicID
+	}
+	return res
+}
+
+// like thought_attachments rows: the store assigns the ID and timestamp
+func newAttachments(attachments []types.Attachment, now time.Time) []types.Attachment {
+	var res []types.Attachment
+	for _, a := range attachments {
+		a.ID = uuid.New()
+		a.CreatedAt = now.Format(time.RFC3339Nano)
+		a.URL = ""
+		thumbnails := a.Thumbnails
+		a.Thumbnails = nil
+		for _, t := range thumbnails {
+			t.URL = ""
+			a.Thumbnails = append(a.Thumbnails, t)
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
+// thumbnails too, since responses sign their URLs in place
+func copyAttachments(attachments []types.Attachment) []types.Attachment {
+	var res []types.Attachment
+	for _, a := range attachments {
+		a.Thumbnails = append([]types.Thumbnail(nil), a.Thumbnails...)
+		res = append(res, a)
+	}
+	return res
+}
@@ -0,0 +1,116 @@
+package stores
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+func (s *MemoryStore) ListThoughtsBetween(ctx context.Context, userID uuid.UUID, start time.Time, end time.Time, limit int) ([]types.Thought, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var thoughts []types.Thought
+	for _, t := range s.between(userID, start, end) {
+		if len(thoughts) == limit {
+			break
+		}
+		thoughts = append(thoughts, copyThought(t))
+	}
+	return thoughts, nil
+}
+
+func (s *MemoryStore) ListDigestCandidates(ctx context.Context, period string, start time.Time, end time.Time, minThoughts int, limit int) ([]uuid.UUID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var userIDs []uuid.UUID
+	for userID := range s.byUser {
+		if len(s.between(userID, start, end)) < minThoughts || s.digestIndex(userID, period, start) != -1 {
+			continue
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	sort.Slice(userIDs, func(i, j int) bool {
+		return userIDs[i].String() < userIDs[j].String()
+	})
+	if len(userIDs) > limit {
+		userIDs = userIDs[:limit]
+	}
+	return userIDs, nil
+}
+
+func (s *MemoryStore) SaveDigest(ctx context.Context, userID uuid.UUID, digest types.Digest) (*types.Digest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start, err := time.Parse(time.RFC3339Nano, digest.PeriodStart)
+	if err != nil {
+		return nil, err
+	}
+
+	digest.ID = uuid.New()
+	digest.CreatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+
+	if i := s.digestIndex(userID, digest.Period, start); i != -1 {
+		digest.ID = s.digests[userID][i].ID
+		s.digests[userID][i] = digest
+	} else {
+		s.digests[userID] = append(s.digests[userID], digest)
+	}
+
+	return &digest, nil
+}
+
+func (s *MemoryStore) ListDigests(ctx context.Context, userID uuid.UUID, period string, limit int) ([]types.Digest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var digests []types.Digest
+	for _, d := range s.digests[userID] {
+		if period == "" || d.Period == period {
+			digests = append(digests, d)
+		}
+	}
+
+	// RFC 3339 UTC timestamps sort lexically
+	sort.SliceStable(digests, func(i, j int) bool {
+		if digests[i].PeriodStart != digests[j].PeriodStart {
+			return digests[i].PeriodStart > digests[j].PeriodStart
+		}
+		return digests[i].Period < digests[j].Period
+	})
+	if len(digests) > limit {
+		digests = digests[:limit]
+	}
+	return digests, nil
+}
+
+// active thoughts created in [start, end), oldest first; callers must hold the lock
+func (s *MemoryStore) between(userID uuid.UUID, start time.Time, end time.Time) []*memoryThought {
+	var thoughts []*memoryThought
+	for _, t := range s.active(userID, LoadFilter{}) {
+		if !t.createdAt.Before(start) && t.createdAt.Before(end) {
+			thoughts = append(thoughts, t)
+		}
+	}
+	return thoughts
+}
+
+// callers must hold the lock
+func (s *MemoryStore) digestIndex(userID uuid.UUID, period string, start time.Time) int {
+	for i, d := range s.digests[userID] {
+		if d.Period != period {
+			continue
+		}
+		if dStart, err := time.Parse(time.RFC3339Nano, d.PeriodStart); err == nil && dStart.Equal(start) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,158 @@
+package stores
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/utils"
+)
+
+// rough stand-in for the postgres 'english' text search config
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true,
+	"by": true, "for": true, "if": true, "in": true, "into": true, "is": true, "it": true, "no": true,
+	"not": true, "of": true, "on": true, "or": true, "so": true, "that": true, "the": true, "their": true,
+	"then": true, "there": true, "these": true, "they": true, "this": true, "to": true, "was": true,
+	"will": true, "with": true, "i": true, "my": true, "me": true, "we": true, "you": true,
+}
+
+// every query term has to appear in the thought (like websearch_to_tsquery), score is term frequency
+// normalized by length so short focused thoughts rank above long ones that mention the term once
+func (s *MemoryStore) SearchFullText(ctx context.Context, userID uuid.UUID, query string, tag string, limit int) ([]SearchHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	queryTerms := searchTerms(query)
+	if len(queryTerms) == 0 {
+		return nil, nil
+	}
+
+	var hits []SearchHit
+	for _, t := range newestFirst(s.active(userID, LoadFilter{Tag: tag})) {
+		thoughtTerms := searchTerms(t.thought.Thought)
+
+		counts := make(map[string]int)
+		for _, term := range thoughtTerms {
+			counts[term]++
+		}
+
+		matches := 0
+		for _, term := range queryTerms {
+			if counts[term] == 0 {
+				matches = -1
+				break
+			}
+			matches += counts[term]
+		}
+		if matches <= 0 {
+			continue
+		}
+
+		hits = append(hits, SearchHit{
+			Thought: copyThought(t),
+			Score:   float64(matches) / float64(len(thoughtTerms)),
+		})
+	}
+
+	return topHits(hits, limit), nil
+}
+
+func (s *MemoryStore) SearchVector(ctx context.Context, userID uuid.UUID, embedding []float32, tag string, limit int) ([]SearchHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hits []SearchHit
+	for _, t := range newestFirst(s.active(userID, LoadFilter{Tag: tag})) {
+		if len(t.embedding) == 0 || len(t.embedding) != len(embedding) {
+			continue
+		}
+
+		hits = append(hits, SearchHit{
+			Thought: copyThought(t),
+			Score:   utils.CosineSimilarity(t.embedding, embedding),
+		})
+	}
+
+	return topHits(hits, limit), nil
+}
+
+func (s *MemoryStore) RelatedThoughts(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID, minSimilarity float64, limit int) ([]SearchHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	source, ok := s.byID[thoughtID]
+	if !ok || source.userID != userID || !source.deletedAt.IsZero() {
+		return nil, ErrThoughtNotFound
+	}
+	if len(source.embedding) == 0 {
+		return nil, ErrNotEmbedded
+	}
+
+	var hits []SearchHit
+	for _, t := range newestFirst(s.active(userID, LoadFilter{})) {
+		if t.thought.ID == thoughtID || len(t.embedding) != len(source.embedding) {
+			continue
+		}
+
+		score := utils.CosineSimilarity(t.embedding, source.embedding)
+		if score < minSimilarity {
+			continue
+		}
+
+		hits = append(hits, SearchHit{
+			Thought: copyThought(t),
+			Score:   score,
+		})
+	}
+
+	return topHits(hits, limit), nil
+}
+
+// lowercased words without stop words, with a very small amount of stemming
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var terms []string
+	for _, word := range words {
+		if stopWords[word] {
+			continue
+		}
+		terms = append(terms, stem(word))
+	}
+	return terms
+}
+
+func stem(word string) string {
+	for _, suffix := range []string{"ing", "ed", "es", "s"} {
+		if len(word) > len(suffix)+2 && strings.HasSuffix(word, suffix) {
+			return strings.TrimSuffix(word, suffix)
+		}
+	}
+	return word
+}
+
+func newestFirst(userThoughts []*memoryThought) []*memoryThought {
+	reversed := make([]*memoryThought, len(userThoughts))
+	for i, t := range userThoughts {
+		reversed[len(userThoughts)-1-i] = t
+	}
+	return reversed
+}
+
+// best first; hits are collected newest first and the sort is stable, so ties stay newest first
+func topHits(hits []SearchHit, limit int) []SearchHit {
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
@@ -0,0 +1,139 @@
+package stores
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+func (s *MemoryStore) ListTopicCandidates(ctx context.Context, minThoughts int, minInterval time.Duration, limit int) ([]uuid.UUID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type candidate struct {
+		userID      uuid.UUID
+		clusteredAt time.Time
+	}
+
+	var candidates []candidate
+	for userID := range s.byUser {
+		embedded := 0
+		var lastEmbedded time.Time
+		for _, t := range s.active(userID, LoadFilter{}) {
+			if len(t.embedding) == 0 {
+				continue
+			}
+			embedded++
+			if t.embeddingUpdatedAt.After(lastEmbedded) {
+				lastEmbedded = t.embeddingUpdatedAt
+			}
+		}
+		if embedded < minThoughts {
+			continue
+		}
+
+		clusteredAt, clustered := s.topicRuns[userID]
+		if clustered && (time.Since(clusteredAt) < minInterval || !lastEmbedded.After(clusteredAt)) {
+			continue
+		}
+		candidates = append(candidates, candidate{userID: userID, clusteredAt: clusteredAt})
+	}
+
+	// never clustered (zero time) first, then longest ago
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].clusteredAt.Before(candidates[j].clusteredAt)
+	})
+
+	var userIDs []uuid.UUID
+	for _, c := range candidates {
+		if len(userIDs) == limit {
+			break
+		}
+		userIDs = append(userIDs, c.userID)
+	}
+	return userIDs, nil
+}
+
+func (s *MemoryStore) ListEmbeddings(ctx context.Context, userID uuid.UUID) ([]ThoughtEmbedding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var embeddings []ThoughtEmbedding
+	for _, t := range s.active(userID, LoadFilter{}) {
+		if len(t.embedding) == 0 {
+			continue
+		}
+		embeddings = append(embeddings, ThoughtEmbedding{
+			ThoughtID: t.thought.ID,
+			Thought:   t.thought.Thought,
+			Embedding: append([]float32(nil), t.embedding...),
+		})
+	}
+	return embeddings, nil
+}
+
+func (s *MemoryStore) ReplaceTopics(ctx context.Context, userID uuid.UUID, topics []NewTopic, clusteredAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.byUser[userID] {
+		t.topicID = uuid.Nil
+	}
+
+	now := time.Now().UTC()
+	replaced := make([]*memoryTopic, 0, len(topics))
+	for _, topic := range topics {
+		mt := &memoryTopic{id: uuid.New(), label: topic.Label, createdAt: now}
+		replaced = append(replaced, mt)
+
+		for _, thoughtID := range topic.ThoughtIDs {
+			if t, ok := s.byID[thoughtID]; ok && t.userID == userID {
+				t.topicID = mt.id
+			}
+		}
+	}
+
+	s.topics[userID] = replaced
+	s.topicRuns[userID] = clusteredAt
+	return nil
+}
+
+func (s *MemoryStore) ListTopics(ctx context.Context, userID uuid.UUID, samples int) ([]types.Topic, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var topics []types.Topic
+	for _, mt := range s.topics[userID] {
+		members := s.active(userID, LoadFilter{TopicID: mt.id})
+		if len(members) == 0 {
+			continue
+		}
+
+		topic := types.Topic{
+			ID:             mt.id,
+			Label:          mt.label,
+			Size:           len(members),
+			CreatedAt:      mt.createdAt.Format(time.RFC3339Nano),
+			SampleThoughts: []types.Thought{},
+		}
+		for _, t := range newestFirst(members) {
+			if len(topic.SampleThoughts) == samples {
+				break
+			}
+			topic.SampleThoughts = append(topic.SampleThoughts, copyThought(t))
+		}
+		topics = append(topics, topic)
+	}
+
+	sort.SliceStable(topics, func(i, j int) bool {
+		if topics[i].Size != topics[j].Size {
+			return topics[i].Size > topics[j].Size
+		}
+		return topics[i].Label < topics[j].Label
+	})
+	return topics, nil
+}
@@ -0,0 +1,868 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/skarokin/runsynapse/go/types"
+	"github.com/skarokin/runsynapse/go/utils"
+)
+
+// PostgresStore calls the plpgsql functions in Supabase; every function returns a JSON document
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+func (s *PostgresStore) LoadThoughtsAndPins(ctx context.Context, userID uuid.UUID) (*LoadResult, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT load_thoughts_and_pins($1)
+	`, userID).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load thoughts and pins: %w", err)
+	}
+
+	// parse result into a struct
+	var dbResult struct {
+		Thoughts       []json.RawMessage `json:"thoughts"`
+		PinnedThoughts []json.RawMessage `json:"pinned_thoughts"`
+		HasMoreAbove   bool              `json:"has_more_above"`
+	}
+	if err := json.Unmarshal([]byte(res), &dbResult); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return &LoadResult{
+		Thoughts:       unmarshalThoughts(dbResult.Thoughts),
+		PinnedThoughts: unmarshalThoughts(dbResult.PinnedThoughts),
+		HasMoreAbove:   dbResult.HasMoreAbove,
+	}, nil
+}
+
+func (s *PostgresStore) LoadMore(ctx context.Context, userID uuid.UUID, cursor uuid.UUID, filter LoadFilter) (*LoadResult, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT load_more($1, $2, $3, $4)
+	`, userID, cursor, tagArg(filter.Tag), topicArg(filter.TopicID)).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load more thoughts: %w", err)
+	}
+
+	var dbResult struct {
+		Thoughts     []json.RawMessage `json:"thoughts"`
+		HasMoreAbove bool              `json:"has_more_above"`
+	}
+	if err := json.Unmarshal([]byte(res), &dbResult); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return &LoadResult{
+		Thoughts:     unmarshalThoughts(dbResult.Thoughts),
+		HasMoreAbove: dbResult.HasMoreAbove,
+	}, nil
+}
+
+func (s *PostgresStore) LoadAfter(ctx context.Context, userID uuid.UUID, cursor uuid.UUID, filter LoadFilter) (*LoadResult, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT load_after($1, $2, $3, $4)
+	`, userID, cursor, tagArg(filter.Tag), topicArg(filter.TopicID)).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load newer thoughts: %w", err)
+	}
+
+	var dbResult struct {
+		Thoughts     []json.RawMessage `json:"thoughts"`
+		HasMoreBelow bool              `json:"has_more_below"`
+	}
+	if err := json.Unmarshal([]byte(res), &dbResult); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return &LoadResult{
+		Thoughts:     unmarshalThoughts(dbResult.Thoughts),
+		HasMoreBelow: dbResult.HasMoreBelow,
+	}, nil
+}
+
+func (s *PostgresStore) LoadAround(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (*LoadResult, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT load_around($1, $2, $3)
+	`, userID, thoughtID, PageSize/2).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load thoughts around %s: %w", thoughtID, err)
+	}
+
+	var dbResult struct {
+		Found        bool              `json:"found"`
+		Thoughts     []json.RawMessage `json:"thoughts"`
+		HasMoreAbove bool              `json:"has_more_above"`
+		HasMoreBelow bool              `json:"has_more_below"`
+	}
+	if err := json.Unmarshal([]byte(res), &dbResult); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	if !dbResult.Found {
+		return nil, ErrThoughtNotFound
+	}
+
+	return &LoadResult{
+		Thoughts:     unmarshalThoughts(dbResult.Thoughts),
+		HasMoreAbove: dbResult.HasMoreAbove,
+		HasMoreBelow: dbResult.HasMoreBelow,
+	}, nil
+}
+
+func (s *PostgresStore) NewThought(ctx context.Context, userID uuid.UUID, thought string, embedding []float32, attachments []types.Attachment) (*types.Thought, error) {
+	// postgres expects the attachments as a JSON array so marshal it
+	attachmentsBytes, err := marshalAttachments(attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	// NULL embedding means pending
+	var embeddingArg any
+	if len(embedding) > 0 {
+		embeddingArg = vectorLiteral(embedding)
+	}
+
+	tags := utils.ExtractHashtags(thought)
+	tagsBytes, err := json.Marshal(tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tags: %w", err)
+	}
+
+	var res string
+	err = s.pool.QueryRow(ctx, `
+		SELECT * FROM new_thought($1, $2, $3, $4, $5)
+	`, userID, thought, embeddingArg, string(attachmentsBytes), string(tagsBytes)).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert new thought: %w", err)
+	}
+
+	var dbResult struct {
+		ID              string             `json:"id"`
+		CreatedAt       string             `json:"created_at"`
+		EmbeddingStatus string             `json:"embedding_status"`
+		Attachments     []types.Attachment `json:"attachments"`
+	}
+	if err := json.Unmarshal([]byte(res), &dbResult); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	// validate the thought ID
+	thoughtID, err := uuid.Parse(dbResult.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid thought ID from database: %w", err)
+	}
+
+	return &types.Thought{
+		ID:              thoughtID,
+		Thought:         thought,
+		Pinned:          false, // default to not pinned
+		Created:         dbResult.CreatedAt,
+		EmbeddingStatus: dbResult.EmbeddingStatus,
+		Attachments:     dbResult.Attachments,
+		Tags:            tags,
+	}, nil
+}
+
+func (s *PostgresStore) ImportThought(ctx context.Context, userID uuid.UUID, thought ImportedThought) (*types.Thought, error) {
+	attachmentsBytes, err := marshalAttachments(thought.Attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	tagsBytes, err := json.Marshal(utils.ExtractHashtags(thought.Thought))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tags: %w", err)
+	}
+
+	// NULL embedding means pending
+	var embeddingArg any
+	if len(thought.Embedding) > 0 {
+		embeddingArg = vectorLiteral(thought.Embedding)
+	}
+
+	var res string
+	err = s.pool.QueryRow(ctx, `
+		SELECT import_thought($1, $2, $3, $4, $5, $6, $7, $8)
+	`, userID, thought.Thought, thought.CreatedAt, embeddingArg, string(attachmentsBytes), string(tagsBytes),
+		thought.Source, thought.SourceID).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import thought: %w", err)
+	}
+
+	var dbResult struct {
+		Status  string        `json:"status"`
+		Thought types.Thought `json:"thought"`
+	}
+	if err := json.Unmarshal([]byte(res), &dbResult); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+	if dbResult.Status == "exists" {
+		return nil, ErrAlreadyImported
+	}
+
+	return &dbResult.Thought, nil
+}
+
+func (s *PostgresStore) ImportedSourceIDs(ctx context.Context, userID uuid.UUID, source string, sourceIDs []string) ([]string, error) {
+	sourceIDsBytes, err := json.Marshal(sourceIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal source IDs: %w", err)
+	}
+
+	var res string
+	err = s.pool.QueryRow(ctx, `
+		SELECT imported_source_ids($1, $2, $3)
+	`, userID, source, string(sourceIDsBytes)).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list imported source IDs: %w", err)
+	}
+
+	var imported []string
+	if err := json.Unmarshal([]byte(res), &imported); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return imported, nil
+}
+
+func (s *PostgresStore) GetThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (*types.Thought, error) {
+	// get_thought returns NULL when there's no such thought
+	var res *string
+	err := s.pool.QueryRow(ctx, `
+		SELECT get_thought($1, $2)
+	`, userID, thoughtID).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thought: %w", err)
+	}
+	if res == nil {
+		return nil, ErrThoughtNotFound
+	}
+
+	var thought types.Thought
+	if err := json.Unmarshal([]byte(*res), &thought); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return &thought, nil
+}
+
+func (s *PostgresStore) EditThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID, thought string) (*types.Thought, error) {
+	tagsBytes, err := json.Marshal(utils.ExtractHashtags(thought))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tags: %w", err)
+	}
+
+	// edit_thought returns NULL when there's no such thought
+	var res *string
+	err = s.pool.QueryRow(ctx, `
+		SELECT edit_thought($1, $2, $3, $4)
+	`, userID, thoughtID, thought, string(tagsBytes)).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to edit thought: %w", err)
+	}
+	if res == nil {
+		return nil, ErrThoughtNotFound
+	}
+
+	var edited types.Thought
+	if err := json.Unmarshal([]byte(*res), &edited); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return &edited, nil
+}
+
+func (s *PostgresStore) ListThoughtVersions(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) ([]types.ThoughtVersion, error) {
+	var res *string
+	err := s.pool.QueryRow(ctx, `
+		SELECT list_thought_versions($1, $2)
+	`, userID, thoughtID).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list thought versions: %w", err)
+	}
+	if res == nil {
+		return nil, ErrThoughtNotFound
+	}
+
+	var versions []types.ThoughtVersion
+	if err := json.Unmarshal([]byte(*res), &versions); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return versions, nil
+}
+
+func (s *PostgresStore) TrashThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (bool, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT * FROM delete_thought($1, $2)
+	`, userID, thoughtID).Scan(&res)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete thought: %w", err)
+	}
+
+	var dbResult DeleteResult
+	if err := json.Unmarshal([]byte(res), &dbResult); err != nil {
+		return false, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return dbResult.Deleted, nil
+}
+
+func (s *PostgresStore) RestoreThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (*types.Thought, error) {
+	// restore_thought returns NULL when the thought isn't in the trash
+	var res *string
+	err := s.pool.QueryRow(ctx, `
+		SELECT restore_thought($1, $2, $3)
+	`, userID, thoughtID, MaxPinnedThoughts).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore thought: %w", err)
+	}
+	if res == nil {
+		return nil, ErrThoughtNotFound
+	}
+
+	var thought types.Thought
+	if err := json.Unmarshal([]byte(*res), &thought); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return &thought, nil
+}
+
+func (s *PostgresStore) ListTrash(ctx context.Context, userID uuid.UUID, limit int) ([]types.Thought, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT list_trash($1, $2)
+	`, userID, limit).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+
+	var thoughts []json.RawMessage
+	if err := json.Unmarshal([]byte(res), &thoughts); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return unmarshalThoughts(thoughts), nil
+}
+
+func (s *PostgresStore) PurgeTrash(ctx context.Context, olderThan time.Duration, limit int) ([]DeleteResult, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT purge_trash($1, $2)
+	`, int(olderThan.Seconds()), limit).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge trash: %w", err)
+	}
+
+	var purged []DeleteResult
+	if err := json.Unmarshal([]byte(res), &purged); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return purged, nil
+}
+
+func (s *PostgresStore) PinThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) ([]types.Thought, bool, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT pin_thought($1, $2, $3)
+	`, userID, thoughtID, MaxPinnedThoughts).Scan(&res)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to pin thought: %w", err)
+	}
+
+	return parsePinResult(res)
+}
+
+func (s *PostgresStore) UnpinThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) ([]types.Thought, bool, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT unpin_thought($1, $2)
+	`, userID, thoughtID).Scan(&res)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to unpin thought: %w", err)
+	}
+
+	return parsePinResult(res)
+}
+
+func (s *PostgresStore) SearchFullText(ctx context.Context, userID uuid.UUID, query string, tag string, limit int) ([]SearchHit, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT search_fulltext($1, $2, $3, $4)
+	`, userID, query, tagArg(tag), limit).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run full-text search: %w", err)
+	}
+
+	return parseSearchHits(res)
+}
+
+func (s *PostgresStore) SearchVector(ctx context.Context, userID uuid.UUID, embedding []float32, tag string, limit int) ([]SearchHit, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT search_vector($1, $2, $3, $4)
+	`, userID, vectorLiteral(embedding), tagArg(tag), limit).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run vector search: %w", err)
+	}
+
+	return parseSearchHits(res)
+}
+
+func (s *PostgresStore) RelatedThoughts(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID, minSimilarity float64, limit int) ([]SearchHit, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT related_thoughts($1, $2, $3, $4)
+	`, userID, thoughtID, minSimilarity, limit).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find related thoughts: %w", err)
+	}
+
+	var dbResult struct {
+		Status string      `json:"status"`
+		Hits   []SearchHit `json:"hits"`
+	}
+	if err := json.Unmarshal([]byte(res), &dbResult); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	switch dbResult.Status {
+	case "ok":
+		return dbResult.Hits, nil
+	case "not_found":
+		return nil, ErrThoughtNotFound
+	case "not_embedded":
+		return nil, ErrNotEmbedded
+	default:
+		return nil, fmt.Errorf("unexpected related_thoughts status: %s", dbResult.Status)
+	}
+}
+
+func (s *PostgresStore) ListTopicCandidates(ctx context.Context, minThoughts int, minInterval time.Duration, limit int) ([]uuid.UUID, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT list_topic_candidates($1, $2, $3)
+	`, minThoughts, minInterval.Seconds(), limit).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list topic candidates: %w", err)
+	}
+
+	var userIDs []uuid.UUID
+	if err := json.Unmarshal([]byte(res), &userIDs); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return userIDs, nil
+}
+
+// a plain row query rather than a JSON-returning function: thousands of 3072 dimension vectors
+// would make one enormous JSON document
+func (s *PostgresStore) ListEmbeddings(ctx context.Context, userID uuid.UUID) ([]ThoughtEmbedding, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, thought, embedding::text
+		FROM user_thoughts
+		WHERE user_id = $1 AND deleted_at IS NULL AND embedding IS NOT NULL
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var embeddings []ThoughtEmbedding
+	for rows.Next() {
+		var e ThoughtEmbedding
+		var vector string
+		if err := rows.Scan(&e.ThoughtID, &e.Thought, &vector); err != nil {
+			return nil, fmt.Errorf("failed to scan embedding: %w", err)
+		}
+
+		e.Embedding, err = parseVectorLiteral(vector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse embedding of thought %s: %w", e.ThoughtID, err)
+		}
+
+		embeddings = append(embeddings, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list embeddings: %w", err)
+	}
+
+	return embeddings, nil
+}
+
+func (s *PostgresStore) ReplaceTopics(ctx context.Context, userID uuid.UUID, topics []NewTopic, clusteredAt time.Time) error {
+	topicsJSON, err := json.Marshal(topics)
+	if err != nil {
+		return fmt.Errorf("failed to marshal topics: %w", err)
+	}
+
+	_, err = s.pool.Exec(ctx, `
+		SELECT replace_topics($1, $2, $3)
+	`, userID, string(topicsJSON), clusteredAt)
+	if err != nil {
+		return fmt.Errorf("failed to replace topics: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) ListTopics(ctx context.Context, userID uuid.UUID, samples int) ([]types.Topic, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT list_topics($1, $2)
+	`, userID, samples).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list topics: %w", err)
+	}
+
+	var topics []types.Topic
+	if err := json.Unmarshal([]byte(res), &topics); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return topics, nil
+}
+
+func (s *PostgresStore) ListThoughtsBetween(ctx context.Context, userID uuid.UUID, start time.Time, end time.Time, limit int) ([]types.Thought, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT list_thoughts_between($1, $2, $3, $4)
+	`, userID, start, end, limit).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list thoughts between %s and %s: %w", start, end, err)
+	}
+
+	var thoughts []json.RawMessage
+	if err := json.Unmarshal([]byte(res), &thoughts); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return unmarshalThoughts(thoughts), nil
+}
+
+func (s *PostgresStore) ListDigestCandidates(ctx context.Context, period string, start time.Time, end time.Time, minThoughts int, limit int) ([]uuid.UUID, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT list_digest_candidates($1, $2, $3, $4, $5)
+	`, period, start, end, minThoughts, limit).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digest candidates: %w", err)
+	}
+
+	var userIDs []uuid.UUID
+	if err := json.Unmarshal([]byte(res), &userIDs); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return userIDs, nil
+}
+
+func (s *PostgresStore) SaveDigest(ctx context.Context, userID uuid.UUID, digest types.Digest) (*types.Digest, error) {
+	themes, err := json.Marshal(digest.Themes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal themes: %w", err)
+	}
+	openQuestions, err := json.Marshal(digest.OpenQuestions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal open questions: %w", err)
+	}
+	actionItems, err := json.Marshal(digest.ActionItems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal action items: %w", err)
+	}
+	sourceIDs, err := json.Marshal(digest.SourceThoughtIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal source thought ids: %w", err)
+	}
+
+	var res string
+	err = s.pool.QueryRow(ctx, `
+		SELECT save_digest($1, $2, $3, $4, $5, $6, $7, $8)
+	`, userID, digest.Period, digest.PeriodStart, digest.PeriodEnd,
+		string(themes), string(openQuestions), string(actionItems), string(sourceIDs)).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save digest: %w", err)
+	}
+
+	var saved types.Digest
+	if err := json.Unmarshal([]byte(res), &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return &saved, nil
+}
+
+func (s *PostgresStore) ListDigests(ctx context.Context, userID uuid.UUID, period string, limit int) ([]types.Digest, error) {
+	var periodArg any
+	if period != "" {
+		periodArg = period
+	}
+
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT list_digests($1, $2, $3)
+	`, userID, periodArg, limit).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digests: %w", err)
+	}
+
+	var digests []types.Digest
+	if err := json.Unmarshal([]byte(res), &digests); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return digests, nil
+}
+
+// rows are streamed instead of building one JSON document so large accounts export in constant memory
+func (s *PostgresStore) ExportThoughts(ctx context.Context, userID uuid.UUID, fn func(types.Thought) error) error {
+	rows, err := s.pool.Query(ctx, `
+		SELECT thought_json(t)::text
+		FROM user_thoughts t
+		WHERE t.user_id = $1 AND t.deleted_at IS NULL
+		ORDER BY t.created_at, t.id
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to export thoughts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res string
+		if err := rows.Scan(&res); err != nil {
+			return fmt.Errorf("failed to scan thought: %w", err)
+		}
+
+		var thought types.Thought
+		if err := json.Unmarshal([]byte(res), &thought); err != nil {
+			return fmt.Errorf("failed to parse database result: %w", err)
+		}
+
+		if err := fn(thought); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export thoughts: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStore) ListTags(ctx context.Context, userID uuid.UUID) ([]types.TagCount, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT list_tags($1)
+	`, userID).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	var tags []types.TagCount
+	if err := json.Unmarshal([]byte(res), &tags); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return tags, nil
+}
+
+func (s *PostgresStore) SetEmbedding(ctx context.Context, thoughtID uuid.UUID, thought string, embedding []float32) error {
+	var status string
+	err := s.pool.QueryRow(ctx, `
+		SELECT set_thought_embedding($1, $2, $3)
+	`, thoughtID, thought, vectorLiteral(embedding)).Scan(&status)
+	if err != nil {
+		return fmt.Errorf("failed to set embedding: %w", err)
+	}
+
+	switch status {
+	case "ok":
+		return nil
+	case "not_found":
+		return ErrThoughtNotFound
+	case "changed":
+		return ErrThoughtChanged
+	default:
+		return fmt.Errorf("unexpected set_thought_embedding status: %s", status)
+	}
+}
+
+func (s *PostgresStore) MarkEmbeddingFailed(ctx context.Context, thoughtID uuid.UUID, reason string, maxAttempts int) (string, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT mark_embedding_failed($1, $2, $3)
+	`, thoughtID, reason, maxAttempts).Scan(&res)
+	if err != nil {
+		return "", fmt.Errorf("failed to mark embedding as failed: %w", err)
+	}
+
+	var dbResult struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(res), &dbResult); err != nil {
+		return "", fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return dbResult.Status, nil
+}
+
+func (s *PostgresStore) ListPendingEmbeddings(ctx context.Context, olderThan time.Duration, limit int) ([]PendingEmbedding, error) {
+	var res string
+	err := s.pool.QueryRow(ctx, `
+		SELECT list_pending_embeddings($1, $2)
+	`, int(olderThan.Seconds()), limit).Scan(&res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending embeddings: %w", err)
+	}
+
+	var pending []PendingEmbedding
+	if err := json.Unmarshal([]byte(res), &pending); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	return pending, nil
+}
+
+// the SQL functions take NULL for "no tag filter"
+func tagArg(tag string) any {
+	if tag == "" {
+		return nil
+	}
+	return tag
+}
+
+func topicArg(topicID uuid.UUID) any {
+	if topicID == uuid.Nil {
+		return nil
+	}
+	return topicID
+}
+
+func parseSearchHits(res string) ([]SearchHit, error) {
+	var hits []SearchHit
+	if err := json.Unmarshal([]byte(res), &hits); err != nil {
+		return nil, fmt.Errorf("failed to parse database result: %w", err)
+	}
+	return hits, nil
+}
+
+// pin_thought and unpin_thought report failures through a status field
+func parsePinResult(res string) ([]types.Thought, bool, error) {
+	var dbResult struct {
+		Status         string            `json:"status"`
+		Changed        bool              `json:"changed"`
+		PinnedThoughts []json.RawMessage `json:"pinned_thoughts"`
+	}
+	if err := json.Unmarshal([]byte(res), &dbResult); err != nil {
+		return nil, false, fmt.Errorf("failed to parse database result: %w", err)
+	}
+
+	switch dbResult.Status {
+	case "ok":
+		return unmarshalThoughts(dbResult.PinnedThoughts), dbResult.Changed, nil
+	case "not_found":
+		return nil, false, ErrThoughtNotFound
+	case "limit_reached":
+		return nil, false, ErrPinLimitReached
+	default:
+		return nil, false, fmt.Errorf("unexpected pin status from database: %q", dbResult.Status)
+	}
+}
+
+// converts raw messages to Thought structs, skipping any that fail to parse
+func unmarshalThoughts(raw []json.RawMessage) []types.Thought {
+	var thoughts []types.Thought
+	for _, rawThought := range raw {
+		var thought types.Thought
+		if err := json.Unmarshal(rawThought, &thought); err != nil {
+			log.Printf("Error unmarshaling thought: %v", err)
+			continue
+		}
+		thoughts = append(thoughts, thought)
+	}
+	return thoughts
+}
+
+// converts to PostgreSQL vector format: [1.0,2.0,3.0]
+func vectorLiteral(embedding []float32) string {
+	vectorStr := make([]string, len(embedding))
+	for i, val := range embedding {
+		vectorStr[i] = fmt.Sprintf("%.6f", val) // limit precision a bit to reduce size
+	}
+	return "[" + strings.Join(vectorStr, ",") + "]"
+}
+
+// inverse of vectorLiteral, for embeddings read back as text
+func parseVectorLiteral(literal string) ([]float32, error) {
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(literal, "["), "]")
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(trimmed, ",")
+	embedding := make([]float32, len(parts))
+	for i, part := range parts {
+		val, err := strconv.ParseFloat(part, 32)
+		if err != nil {
+			return nil, err
+		}
+		embedding[i] = float32(val)
+	}
+	return embedding, nil
+}
+
+// the fields new_thought and import_thought read; the database assigns the ID and timestamp
+func marshalAttachments(attachments []types.Attachment) ([]byte, error) {
+	type attachmentRow struct {
+		Key         string            `json:"key"`
+		FileName    string            `json:"file_name"`
+		ContentType string            `json:"content_type"`
+		Size        int64             `json:"size"`
+		SHA256      string            `json:"sha256"`
+		Width       int               `json:"width"`
+		Height      int               `json:"height"`
+		Thumbnails  []types.Thumbnail `json:"thumbnails"`
+	}
+
+	rows := make([]attachmentRow, 0, len(attachments))
+	for _, a := range attachments {
+		rows = append(rows, attachmentRow{
+			Key:         a.Key,
+			FileName:    a.FileName,
+			ContentType: a.ContentType,
+			Size:        a.Size,
+			SHA256:      a.SHA256,
+			Width:       a.Width,
+			Height:      a.Height,
+			Thumbnails:  a.Thumbnails,
+		})
+	}
+
+	res, err := json.Marshal(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal attachments: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,200 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+// number of thoughts returned per page by LoadThoughtsAndPins, LoadMore and LoadAfter
+const PageSize = 25
+
+// how many thoughts a user can have pinned at once
+const MaxPinnedThoughts = 10
+
+const (
+	EmbeddingPending = "pending"
+	EmbeddingReady   = "ready"
+	EmbeddingFailed  = "failed"
+)
+
+const (
+	DigestDay  = "day"
+	DigestWeek = "week"
+)
+
+var (
+	ErrThoughtNotFound = errors.New("thought not found")
+	ErrPinLimitReached = errors.New("pin limit reached")
+	ErrThoughtChanged  = errors.New("thought changed")
+	ErrNotEmbedded     = errors.New("thought not embedded yet")
+	ErrAlreadyImported = errors.New("thought already imported")
+)
+
+// ThoughtStore is everything Handler needs from persistence
+// PostgresStore is the production backend, MemoryStore is for running locally without Supabase
+type ThoughtStore interface {
+	// latest page of thoughts (oldest first) along with every pinned thought
+	LoadThoughtsAndPins(ctx context.Context, userID uuid.UUID) (*LoadResult, error)
+
+	// page of thoughts older than the cursor thought (oldest first); uuid.Nil cursor loads the latest page
+	// the filter narrows the pages to a tag and/or topic; the cursor itself doesn't need to match it
+	LoadMore(ctx context.Context, userID uuid.UUID, cursor uuid.UUID, filter LoadFilter) (*LoadResult, error)
+
+	// page of thoughts newer than the cursor thought (oldest first), for scrolling down after LoadAround
+	LoadAfter(ctx context.Context, userID uuid.UUID, cursor uuid.UUID, filter LoadFilter) (*LoadResult, error)
+
+	// window of thoughts centered on thoughtID (oldest first); ErrThoughtNotFound if it isn't the user's
+	LoadAround(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (*LoadResult, error)
+
+	// attachments are already uploaded; a nil embedding leaves the thought pending for the embedding worker
+	// tags are always derived from the text (utils.ExtractHashtags), here and in EditThought
+	NewThought(ctx context.Context, userID uuid.UUID, thought string, embedding []float32, attachments []types.Attachment) (*types.Thought, error)
+
+	// NewThought for a thought from another app, keeping its original creation time
+	// ErrAlreadyImported if the user already has a thought with the same source and source ID, even in the trash
+	ImportThought(ctx context.Context, userID uuid.UUID, thought ImportedThought) (*types.Thought, error)
+
+	// the subset of sourceIDs the user has already imported from source, so importers can skip them up front
+	ImportedSourceIDs(ctx context.Context, userID uuid.UUID, source string, sourceIDs []string) ([]string, error)
+
+	// ErrThoughtNotFound if the thought doesn't exist, is in the trash or isn't the user's
+	GetThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (*types.Thought, error)
+
+	// replaces the text, keeping the old one as a version, and leaves the thought pending re-embedding
+	// editing to the same text is a no-op; ErrThoughtNotFound if the thought doesn't exist or isn't the user's
+	EditThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID, thought string) (*types.Thought, error)
+
+	// previous texts of a thought, newest first; ErrThoughtNotFound if the thought doesn't exist or isn't the user's
+	ListThoughtVersions(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) ([]types.ThoughtVersion, error)
+
+	// moves the thought to the trash, where it's hidden from loading, pins, search and editing until restored
+	// returns false if there was no such thought (or it was already trashed)
+	TrashThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (bool, error)
+
+	// takes the thought out of the trash; it comes back unpinned if the user's pins filled up meanwhile
+	// ErrThoughtNotFound if it isn't in the user's trash
+	RestoreThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) (*types.Thought, error)
+
+	// trashed thoughts, most recently trashed first
+	ListTrash(ctx context.Context, userID uuid.UUID, limit int) ([]types.Thought, error)
+
+	// hard-deletes thoughts (any user's) trashed longer than olderThan and returns the attachments
+	// that the caller should clean up from object storage
+	PurgeTrash(ctx context.Context, olderThan time.Duration, limit int) ([]DeleteResult, error)
+
+	// both return the user's pinned thoughts after the change (newest first)
+	// pinning fails with ErrPinLimitReached once MaxPinnedThoughts are pinned; (un)pinning twice is a no-op
+	// both also return whether the pin changed; false if the thought already was (un)pinned
+	PinThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) ([]types.Thought, bool, error)
+	UnpinThought(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID) ([]types.Thought, bool, error)
+
+	// the two halves of hybrid search, best first; fusing them is up to the caller
+	// full-text scores are ts_rank_cd style relevance, vector scores are cosine similarity
+	// a non-empty tag restricts both to thoughts with that tag
+	SearchFullText(ctx context.Context, userID uuid.UUID, query string, tag string, limit int) ([]SearchHit, error)
+	SearchVector(ctx context.Context, userID uuid.UUID, embedding []float32, tag string, limit int) ([]SearchHit, error)
+
+	// the user's thoughts nearest to thoughtID by its stored embedding (itself excluded), most similar first
+	// only hits with cosine similarity >= minSimilarity are returned; ErrThoughtNotFound if it isn't the user's
+	// (or is trashed), ErrNotEmbedded if it has no embedding yet
+	RelatedThoughts(ctx context.Context, userID uuid.UUID, thoughtID uuid.UUID, minSimilarity float64, limit int) ([]SearchHit, error)
+
+	// users due for topic clustering: at least minThoughts embedded thoughts, and either never clustered or
+	// with thoughts embedded since their last run, which was longer than minInterval ago; never clustered first
+	ListTopicCandidates(ctx context.Context, minThoughts int, minInterval time.Duration, limit int) ([]uuid.UUID, error)
+
+	// the user's embedded thoughts outside the trash, oldest first, for clustering
+	ListEmbeddings(ctx context.Context, userID uuid.UUID) ([]ThoughtEmbedding, error)
+
+	// replaces all of the user's topics with the result of a clustering run over embeddings read at clusteredAt
+	ReplaceTopics(ctx context.Context, userID uuid.UUID, topics []NewTopic, clusteredAt time.Time) error
+
+	// the user's topics, largest first, each with up to samples of its newest thoughts
+	ListTopics(ctx context.Context, userID uuid.UUID, samples int) ([]types.Topic, error)
+
+	// the user's thoughts created in [start, end) outside the trash, oldest first, for digests
+	ListThoughtsBetween(ctx context.Context, userID uuid.UUID, start time.Time, end time.Time, limit int) ([]types.Thought, error)
+
+	// users with at least minThoughts thoughts created in [start, end) and no digest for that period yet
+	ListDigestCandidates(ctx context.Context, period string, start time.Time, end time.Time, minThoughts int, limit int) ([]uuid.UUID, error)
+
+	// stores a digest (ID and CreatedAt are assigned), replacing any earlier one for the same period and start
+	SaveDigest(ctx context.Context, userID uuid.UUID, digest types.Digest) (*types.Digest, error)
+
+	// the user's digests, newest period first; an empty period lists days and weeks together
+	ListDigests(ctx context.Context, userID uuid.UUID, period string, limit int) ([]types.Digest, error)
+
+	// calls fn with every thought outside the trash, oldest first, without holding them all in memory
+	// stops at the first error fn returns and returns it
+	ExportThoughts(ctx context.Context, userID uuid.UUID, fn func(types.Thought) error) error
+
+	// every tag the user has used on thoughts outside the trash, most used first
+	ListTags(ctx context.Context, userID uuid.UUID) ([]types.TagCount, error)
+
+	// used by the embedding worker; thought is the text that was embedded
+	// returns ErrThoughtNotFound if the thought was deleted meanwhile, ErrThoughtChanged if it was edited
+	SetEmbedding(ctx context.Context, thoughtID uuid.UUID, thought string, embedding []float32) error
+
+	// records a failed attempt and returns the resulting status (EmbeddingFailed once maxAttempts is reached)
+	MarkEmbeddingFailed(ctx context.Context, thoughtID uuid.UUID, reason string, maxAttempts int) (string, error)
+
+	// thoughts outside the trash that have been pending for longer than olderThan, oldest first, so lost jobs
+	// can be re-enqueued
+	ListPendingEmbeddings(ctx context.Context, olderThan time.Duration, limit int) ([]PendingEmbedding, error)
+}
+
+// narrows LoadMore and LoadAfter; the zero value loads every thought
+type LoadFilter struct {
+	Tag     string    // only thoughts with this hashtag
+	TopicID uuid.UUID // only thoughts assigned to this topic
+}
+
+type LoadResult struct {
+	Thoughts       []types.Thought `json:"thoughts"`
+	PinnedThoughts []types.Thought `json:"pinned_thoughts"`
+	HasMoreAbove   bool            `json:"has_more_above"`
+	HasMoreBelow   bool            `json:"has_more_below"`
+}
+
+type DeleteResult struct {
+	Deleted        bool     `json:"deleted"`
+	AttachmentKeys []string `json:"attachment_keys"`
+	ThoughtID      string   `json:"thought_id"`
+}
+
+type SearchHit struct {
+	Thought types.Thought `json:"thought"`
+	Score   float64       `json:"score"`
+}
+
+type ThoughtEmbedding struct {
+	ThoughtID uuid.UUID
+	Thought   string
+	Embedding []float32
+}
+
+// one cluster from a clustering run
+type NewTopic struct {
+	Label      string      `json:"label"`
+	ThoughtIDs []uuid.UUID `json:"thought_ids"`
+}
+
+// a thought from another app; SourceID identifies it within Source (e.g. a Discord message ID)
+type ImportedThought struct {
+	Source      string
+	SourceID    string
+	Thought     string
+	CreatedAt   time.Time
+	Embedding   []float32          // nil leaves the thought pending for the embedding worker
+	Attachments []types.Attachment // already uploaded
+}
+
+type PendingEmbedding struct {
+	UserID    uuid.UUID `json:"user_id"`
+	ThoughtID uuid.UUID `json:"thought_id"`
+}
@@ -1,27 +1,95 @@
 package types
 
 // NewThoughtRequest works entirely with form data, so no struct needed
+// loadFunction, listTrash, listTags and topics have no parameters, so no struct needed either
 
-type RequestsOnlyRequiringUserID struct {
-	UserID UserID `json:"user_id"`
-}
+// the user is taken from the verified Supabase JWT; user_id is still accepted so older clients
+// keep working, but its value is never read
 
 type LoadThoughtsRequest struct {
-	UserID UserID `json:"user_id"`
-	Cursor ThoughtID `json:"cursor"`
+	UserID  string    `json:"user_id,omitempty"` // Deprecated: ignored
+	Cursor  ThoughtID `json:"cursor"`
+	Order   Order     `json:"order"`    // "before" (default) loads older thoughts, "after" loads newer ones
+	Tag     Tag       `json:"tag"`      // optional, only thoughts with this hashtag
+	TopicID TopicID   `json:"topic_id"` // optional, only thoughts in this topic (see /topics)
 }
 
 type TogglePinRequest struct {
-	UserID   UserID `json:"user_id"`
-	ThoughtID string `json:"thought_id"`
+	UserID    string    `json:"user_id,omitempty"` // Deprecated: ignored
+	ThoughtID ThoughtID `json:"thought_id"`
+}
+
+type GotoPinRequest struct {
+	UserID    string    `json:"user_id,omitempty"` // Deprecated: ignored
+	ThoughtID ThoughtID `json:"thought_id"`
+}
+
+type EditThoughtRequest struct {
+	UserID    string    `json:"user_id,omitempty"` // Deprecated: ignored
+	ThoughtID ThoughtID `json:"thought_id"`
+	Thought   string    `json:"thought"`
+}
+
+type ListThoughtVersionsRequest struct {
+	UserID    string    `json:"user_id,omitempty"` // Deprecated: ignored
+	ThoughtID ThoughtID `json:"thought_id"`
 }
 
 type DeleteThoughtRequest struct {
-	UserID   UserID `json:"user_id"`
+	UserID    string    `json:"user_id,omitempty"` // Deprecated: ignored
+	ThoughtID ThoughtID `json:"thought_id"`
+}
+
+type RestoreThoughtRequest struct {
+	UserID    string    `json:"user_id,omitempty"` // Deprecated: ignored
 	ThoughtID ThoughtID `json:"thought_id"`
 }
 
 type SearchThoughtsRequest struct {
-	UserID UserID `json:"user_id"`
-	Query  Query `json:"query"`
-}
\ No newline at end of file
+	UserID string `json:"user_id,omitempty"` // Deprecated: ignored
+	Query  Query  `json:"query"`
+	Tag    Tag    `json:"tag"` // optional, only thoughts with this hashtag
+}
+
+type RelatedThoughtsRequest struct {
+	UserID        string    `json:"user_id,omitempty"` // Deprecated: ignored
+	ThoughtID     ThoughtID `json:"thought_id"`
+	Limit         int       `json:"limit,omitempty"`          // optional, how many related thoughts to return
+	MinSimilarity *float64  `json:"min_similarity,omitempty"` // optional cosine similarity cutoff in [-1, 1]
+}
+
+type ListDigestsRequest struct {
+	UserID string       `json:"user_id,omitempty"` // Deprecated: ignored
+	Period DigestPeriod `json:"period"`            // optional, "day" or "week"; both when empty
+	Limit  int          `json:"limit,omitempty"`   // optional, how many digests to return
+}
+
+// generates (or regenerates) the digest for the day or week containing date, in timezone
+type GenerateDigestRequest struct {
+	UserID   string       `json:"user_id,omitempty"` // Deprecated: ignored
+	Period   DigestPeriod `json:"period"`
+	Date     string       `json:"date,omitempty"`     // optional YYYY-MM-DD, defaults to today
+	Timezone string       `json:"timezone,omitempty"` // optional IANA name like "America/New_York", defaults to UTC
+}
+
+type ExportThoughtsRequest struct {
+	UserID string       `json:"user_id,omitempty"` // Deprecated: ignored
+	Format ExportFormat `json:"format"`            // "jsonl" (default) or "zip" with the attachment bytes
+}
+
+type AskThoughtsRequest struct {
+	UserID   string   `json:"user_id,omitempty"` // Deprecated: ignored
+	Question Question `json:"question"`
+}
+
+// a file the client wants to upload directly to the blob store, as it will send it
+type UploadFileRequest struct {
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"` // bytes
+}
+
+type CreateUploadURLsRequest struct {
+	UserID string              `json:"user_id,omitempty"` // Deprecated: ignored
+	Files  []UploadFileRequest `json:"files"`
+}
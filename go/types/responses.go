@@ -9,7 +9,60 @@ type Thought struct {
 	Thought   string     `json:"thought"`
 	Pinned    bool       `json:"pinned"`
 	Created   string     `json:"created_at"`
-	Attachments []string `json:"attachments,omitempty"`
+	EditedAt  string     `json:"edited_at,omitempty"`	// empty until the thought is first edited
+	DeletedAt string     `json:"deleted_at,omitempty"`	// only set for thoughts in the trash
+	EmbeddingStatus string `json:"embedding_status,omitempty"`	// pending, ready or failed
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`	// hashtags from the text, lowercased without the #
+	TopicID   *uuid.UUID `json:"topic_id,omitempty"`	// set once the clustering job has put the thought in a topic
+}
+
+// a file attached to a thought; url is only set in responses, where it's presigned and expires
+// content_type, size and sha256 are missing for attachments saved before they were recorded
+type Attachment struct {
+	ID          uuid.UUID   `json:"id"`
+	Key         string      `json:"key"`       // object key in the blob store
+	FileName    string      `json:"file_name"` // as uploaded
+	ContentType string      `json:"content_type,omitempty"`
+	Size        int64       `json:"size,omitempty"`       // bytes
+	SHA256      string      `json:"sha256,omitempty"`     // hex
+	Width       int         `json:"width,omitempty"`      // pixels, for images whose size could be read
+	Height      int         `json:"height,omitempty"`     // pixels, as displayed (after any EXIF rotation)
+	Thumbnails  []Thumbnail `json:"thumbnails,omitempty"` // smallest first
+	CreatedAt   string      `json:"created_at"`
+	URL         string      `json:"url,omitempty"`
+}
+
+// a downscaled copy of an image attachment, stored next to it
+type Thumbnail struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Key    string `json:"key"`
+	URL    string `json:"url,omitempty"`
+}
+
+// Keys are the blob keys of an attachment: the original and its thumbnails
+func (a Attachment) Keys() []string {
+	keys := []string{a.Key}
+	for _, t := range a.Thumbnails {
+		keys = append(keys, t.Key)
+	}
+	return keys
+}
+
+// AttachmentKeys is every blob key of the attachments, for deleting them
+func AttachmentKeys(attachments []Attachment) []string {
+	var keys []string
+	for _, a := range attachments {
+		keys = append(keys, a.Keys()...)
+	}
+	return keys
+}
+
+// how many of the user's thoughts (outside the trash) use a tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
 }
 
 type LoadFunctionResponse struct {
@@ -21,6 +74,7 @@ type LoadFunctionResponse struct {
 type LoadThoughtsResponse struct {
 	Thoughts    []Thought `json:"thoughts,omitempty"`
 	HasMoreAbove bool      `json:"more_above"`
+	HasMoreBelow bool      `json:"more_below"`
 }
 
 // for optimistic UI, returns the new thought w/ its attachments (we do this because thoughtID and attachment url generated in backend)
@@ -28,10 +82,37 @@ type NewThoughtResponse struct {
 	Thought    Thought    `json:"thought"`
 }
 
+// the edited thought, including its new edited_at; it stays pending until re-embedded
+type EditThoughtResponse struct {
+	Thought Thought `json:"thought"`
+}
+
+// one replaced text of a thought; written_at is when that text was created or last edited
+type ThoughtVersion struct {
+	Thought    string `json:"thought"`
+	WrittenAt  string `json:"written_at"`
+	ReplacedAt string `json:"replaced_at"`
+}
+
+type ThoughtVersionsResponse struct {
+	Versions []ThoughtVersion `json:"versions"`
+}
+
 type DeleteThoughtResponse struct {
 	Success bool   `json:"success"`
 }
 
+// the restored thought so the UI can put it back in place
+type RestoreThoughtResponse struct {
+	Thought Thought `json:"thought"`
+}
+
+// thoughts in the trash are purged retention_days after deleted_at
+type ListTrashResponse struct {
+	Thoughts      []Thought `json:"thoughts"`
+	RetentionDays int       `json:"retention_days"`
+}
+
 // pin, unpin, or get pinned
 type PinThoughtResponse struct {
 	PinnedThoughts []Thought `json:"pinned_thoughts"`
@@ -42,4 +123,167 @@ type GotoPinResponse struct {
 	Thoughts []Thought `json:"thoughts"`
 	HasMoreAbove bool    `json:"more_above"`
 	HasMoreBelow bool    `json:"more_below"`
+}
+
+// one hybrid search result; retriever scores are only set for the retrievers that matched
+type SearchResult struct {
+	Thought       Thought  `json:"thought"`
+	Score         float64  `json:"score"`                    // fused reciprocal rank score, higher is better
+	FullTextScore *float64 `json:"fts_score,omitempty"`      // full-text relevance
+	VectorScore   *float64 `json:"vector_score,omitempty"`   // cosine similarity
+	MatchedBy     []string `json:"matched_by"`               // "fts" and/or "vector"
+}
+
+// a cluster of similar thoughts found by the clustering job; size only counts thoughts outside the trash
+type Topic struct {
+	ID             uuid.UUID `json:"id"`
+	Label          string    `json:"label"`
+	Size           int       `json:"size"`
+	CreatedAt      string    `json:"created_at"`
+	SampleThoughts []Thought `json:"sample_thoughts"` // newest first
+}
+
+type ListTopicsResponse struct {
+	Topics []Topic `json:"topics"`
+}
+
+// a Gemini summary of the user's thoughts over a day or a week; every item points back at the
+// thoughts it was drawn from, and source_thought_ids lists every thought the digest was built from
+type Digest struct {
+	ID               uuid.UUID     `json:"id"`
+	Period           string        `json:"period"` // "day" or "week"
+	PeriodStart      string        `json:"period_start"`
+	PeriodEnd        string        `json:"period_end"` // exclusive
+	Themes           []DigestTheme `json:"themes"`
+	OpenQuestions    []DigestItem  `json:"open_questions"`
+	ActionItems      []DigestItem  `json:"action_items"`
+	SourceThoughtIDs []uuid.UUID   `json:"source_thought_ids"`
+	CreatedAt        string        `json:"created_at"`
+}
+
+type DigestTheme struct {
+	Title      string      `json:"title"`
+	Summary    string      `json:"summary"`
+	ThoughtIDs []uuid.UUID `json:"thought_ids"`
+}
+
+type DigestItem struct {
+	Text       string      `json:"text"`
+	ThoughtIDs []uuid.UUID `json:"thought_ids"`
+}
+
+type ListDigestsResponse struct {
+	Digests []Digest `json:"digests"`
+}
+
+// always has a digest; /generateDigest responds 404 "No thoughts in this period" instead when there
+// were none
+type GenerateDigestResponse struct {
+	Digest *Digest `json:"digest"`
+}
+
+// one line of an export; attachment paths are only set in zip bundles
+type ExportedThought struct {
+	ID          uuid.UUID            `json:"id"`
+	Thought     string               `json:"thought"`
+	Pinned      bool                 `json:"pinned"`
+	Created     string               `json:"created_at"`
+	EditedAt    string               `json:"edited_at,omitempty"`
+	Tags        []string             `json:"tags"`
+	TopicID     *uuid.UUID           `json:"topic_id,omitempty"`
+	Attachments []ExportedAttachment `json:"attachments"`
+}
+
+type ExportedAttachment struct {
+	Key         string `json:"key"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	URL         string `json:"url"`
+	Path        string `json:"path,omitempty"` // location of the bytes inside the zip bundle
+}
+
+// returned instead of the export itself when it was written to the blob store (in Lambda)
+type ExportThoughtsResponse struct {
+	URL          string `json:"url"`
+	Format       string `json:"format"`
+	ThoughtCount int    `json:"thought_count"`
+}
+
+// where to PUT one file; the request has to carry headers, and the key is then passed to /newThought
+// as an upload_keys form field
+type UploadURL struct {
+	FileName  string            `json:"file_name"`
+	Key       string            `json:"key"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt string            `json:"expires_at"`
+}
+
+// uploads are in the order of the requested files
+type CreateUploadURLsResponse struct {
+	Uploads []UploadURL `json:"uploads"`
+}
+
+// a file refused by /newThought or /createUploadURLs; reason is type_not_allowed, type_mismatch,
+// too_large or empty, and detected_type is what the first bytes of the file look like
+type RejectedFile struct {
+	FileName     string `json:"file_name"`
+	Reason       string `json:"reason"`
+	DeclaredType string `json:"declared_type"`
+	DetectedType string `json:"detected_type,omitempty"`
+	Message      string `json:"message"`
+}
+
+// sent with a 400 when any file of the request was refused; nothing was saved
+type RejectedFilesResponse struct {
+	Error         string         `json:"error"`
+	RejectedFiles []RejectedFile `json:"rejected_files"`
+}
+
+// one line of an import's progress stream, written after every batch; the last line has done set,
+// or error when the import stopped early (everything counted so far was imported)
+type ImportProgress struct {
+	Total             int    `json:"total"`              // items found in the file
+	Processed         int    `json:"processed"`          // items handled so far, whatever the outcome
+	Created           int    `json:"created"`            // new thoughts
+	Skipped           int    `json:"skipped"`            // already imported before
+	Failed            int    `json:"failed"`             // items that couldn't be saved
+	FailedAttachments int    `json:"failed_attachments"` // attachments left off thoughts that were created
+	Done              bool   `json:"done"`
+	Error             string `json:"error,omitempty"`
+}
+
+// data of an /events message; thought is the thought's current state, except after a delete or an import
+type ThoughtEvent struct {
+	Type      string     `json:"type"`
+	ThoughtID *uuid.UUID `json:"thought_id,omitempty"`
+	Thought   *Thought   `json:"thought,omitempty"`
+}
+
+type ListTagsResponse struct {
+	Tags []TagCount `json:"tags"`
+}
+
+type SearchThoughtsResponse struct {
+	Results []SearchResult `json:"results"`
+}
+
+// a thought near another one in embedding space; similarity is cosine similarity, higher is closer
+type RelatedThought struct {
+	Thought    Thought `json:"thought"`
+	Similarity float64 `json:"similarity"`
+}
+
+type RelatedThoughtsResponse struct {
+	Related []RelatedThought `json:"related"`
+}
+
+// answer grounded in the user's thoughts; sources are the cited thoughts so the UI can link back to them
+type AskThoughtsResponse struct {
+	Answer          string      `json:"answer"`
+	CitedThoughtIDs []uuid.UUID `json:"cited_thought_ids"`
+	Sources         []Thought   `json:"sources"`
 }
\ No newline at end of file
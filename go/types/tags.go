@@ -0,0 +1,28 @@
+package types
+
+import (
+	"strings"
+	"unicode"
+)
+
+// longest tag kept; anything longer is almost certainly not meant as a tag
+const MaxTagLength = 64
+
+// NormalizeTag turns user input ("#Project", "project.") into the stored form ("project")
+// returns "" if nothing tag-like is left
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+
+	// trailing separators are punctuation, e.g. "#todo-" or "#a/b/"
+	tag = strings.TrimRight(tag, "-/")
+
+	if tag == "" || len(tag) > MaxTagLength || !strings.ContainsFunc(tag, unicode.IsLetter) {
+		return ""
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '/' {
+			return ""
+		}
+	}
+	return tag
+}
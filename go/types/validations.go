@@ -5,32 +5,47 @@ import (
 	"fmt"
 )
 
-// userID validations
-type UserID string
+type ThoughtID string
 
-func (u *UserID) UnmarshalJSON(data []byte) error {
+func (t *ThoughtID) UnmarshalJSON(data []byte) error {
 	var s string
 	if err := json.Unmarshal(data, &s); err != nil {
 		return err
 	}
 	if len(s) < 1 || len(s) > 36 {
-		return fmt.Errorf("invalid user_id: must be between 1 and 36 characters")
+		return fmt.Errorf("invalid thought_id: must be between 1 and 36 characters")
 	}
-	*u = UserID(s)
+	*t = ThoughtID(s)
 	return nil
 }
 
-type ThoughtID string
+// topic id validations; topics come from /topics
+type TopicID string
 
-func (t *ThoughtID) UnmarshalJSON(data []byte) error {
+func (t *TopicID) UnmarshalJSON(data []byte) error {
 	var s string
 	if err := json.Unmarshal(data, &s); err != nil {
 		return err
 	}
 	if len(s) < 1 || len(s) > 36 {
-		return fmt.Errorf("invalid thought_id: must be between 1 and 36 characters")
+		return fmt.Errorf("invalid topic_id: must be between 1 and 36 characters")
 	}
-	*t = ThoughtID(s)
+	*t = TopicID(s)
+	return nil
+}
+
+// pagination direction validations
+type Order string
+
+func (o *Order) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s != "" && s != "before" && s != "after" {
+		return fmt.Errorf("invalid order: must be either before or after")
+	}
+	*o = Order(s)
 	return nil
 }
 
@@ -47,4 +62,69 @@ func (q *Query) UnmarshalJSON(data []byte) error {
 	}
 	*q = Query(s)
 	return nil
-}
\ No newline at end of file
+}
+
+// question validations (ask endpoint allows longer input than search)
+type Question string
+
+func (q *Question) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if len(s) < 1 || len(s) > 1000 {
+		return fmt.Errorf("invalid question: must be between 1 and 1000 characters")
+	}
+	*q = Question(s)
+	return nil
+}
+
+// tag filter validations; optional, "#Project" and "project" both filter by the stored form "project"
+type Tag string
+
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*t = ""
+		return nil
+	}
+	tag := NormalizeTag(s)
+	if tag == "" {
+		return fmt.Errorf("invalid tag: must be at most %d letters, digits, _, - or /, with at least one letter", MaxTagLength)
+	}
+	*t = Tag(tag)
+	return nil
+}
+
+// digest period validations; optional where a request allows it, handlers check for presence
+type DigestPeriod string
+
+func (p *DigestPeriod) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s != "" && s != "day" && s != "week" {
+		return fmt.Errorf("invalid period: must be either day or week")
+	}
+	*p = DigestPeriod(s)
+	return nil
+}
+
+// export format validations; empty means jsonl
+type ExportFormat string
+
+func (f *ExportFormat) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s != "" && s != "jsonl" && s != "zip" {
+		return fmt.Errorf("invalid format: must be either jsonl or zip")
+	}
+	*f = ExportFormat(s)
+	return nil
+}
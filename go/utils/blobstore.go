@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore is where attachment bytes live; keys are generated by generateKeyFromFilename
+// S3BlobStore is used in production, LocalBlobStore for development without AWS. objects are private,
+// thoughts store their keys and responses hand out short-lived URLs from PresignGet
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Delete(ctx context.Context, key string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// URL the frontend can load the object from until it expires
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+
+	// URL the client can PUT exactly size bytes of contentType to, under key, until it expires
+	// the client has to send the same Content-Type header
+	PresignPut(ctx context.Context, key string, contentType string, size int64, expires time.Duration) (string, error)
+
+	// size and content type of a stored object; ErrBlobNotFound if there is none
+	Stat(ctx context.Context, key string) (*BlobInfo, error)
+}
+
+type BlobInfo struct {
+	Size        int64
+	ContentType string
+}
+
+type S3BlobStore struct {
+	client *s3.Client
+	bucket string
+}
+
+func NewS3BlobStore(client *s3.Client, bucket string) *S3BlobStore {
+	return &S3BlobStore{client: client, bucket: bucket}
+}
+
+func (b *S3BlobStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	log.Printf("[S3] Uploading file to bucket '%s' with key '%s'", b.bucket, key)
+
+	_, err := b.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(b.bucket),
+		Key:          aws.String(key),
+		Body:         body,
+		ContentType:  aws.String(contentType),
+		CacheControl: aws.String("max-age=31536000, private"), // 1 year cache, keys never change but only the user may see them
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file to S3: %w", err)
+	}
+
+	log.Printf("[S3] Successfully uploaded file with key: %s", key)
+
+	return nil
+}
+
+func (b *S3BlobStore) Delete(ctx context.Context, key string) error {
+	log.Printf("[S3] Deleting file with key '%s' from bucket '%s'", key, b.bucket)
+
+	_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete file from S3: %w", err)
+	}
+
+	log.Printf("[S3] Successfully deleted file with key: %s", key)
+	return nil
+}
+
+func (b *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from S3: %w", err)
+	}
+
+	return out.Body, nil
+}
+
+func (b *S3BlobStore) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	req, err := s3.NewPresignClient(b.client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign download: %w", err)
+	}
+
+	return req.URL, nil
+}
+
+// content type and length are part of the signature, so S3 rejects any other upload
+func (b *S3BlobStore) PresignPut(ctx context.Context, key string, contentType string, size int64, expires time.Duration) (string, error) {
+	req, err := s3.NewPresignClient(b.client).PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(b.bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign upload: %w", err)
+	}
+
+	return req.URL, nil
+}
+
+func (b *S3BlobStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	out, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &notFound) || errors.As(err, &noSuchKey) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("failed to stat file in S3: %w", err)
+	}
+
+	return &BlobInfo{
+		Size:        aws.ToInt64(out.ContentLength),
+		ContentType: aws.ToString(out.ContentType),
+	}, nil
+}
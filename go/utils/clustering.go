@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"math"
+	"math/rand"
+)
+
+// TopicCount picks k for KMeans from the number of thoughts, roughly sqrt(n/2) as a rule of thumb
+// clamped so small accounts still get a couple of topics and large ones don't get an unreadable list
+func TopicCount(n int, minTopics int, maxTopics int) int {
+	k := int(math.Round(math.Sqrt(float64(n) / 2)))
+	return min(max(k, minTopics), maxTopics, n)
+}
+
+// KMeans clusters vectors by cosine similarity (spherical k-means) with k-means++ seeding
+// returns the cluster of every vector and each cluster's unit-length centroid; rng makes runs reproducible
+func KMeans(vectors [][]float32, k int, maxIterations int, rng *rand.Rand) ([]int, [][]float32) {
+	if len(vectors) == 0 || k <= 0 {
+		return nil, nil
+	}
+	k = min(k, len(vectors))
+
+	// on unit vectors cosine similarity is a dot product
+	points := make([][]float32, len(vectors))
+	for i, v := range vectors {
+		points[i] = normalized(v)
+	}
+
+	centroids := seedCentroids(points, k, rng)
+	assignments := make([]int, len(points))
+	for i := range assignments {
+		assignments[i] = -1
+	}
+
+	for iter := 0; iter < maxIterations; iter++ {
+		changed := false
+		for i, p := range points {
+			best := nearestCentroid(p, centroids)
+			if best != assignments[i] {
+				assignments[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		// new centroid is the normalized mean of its members; an emptied cluster is reseeded
+		// with the point that fits its current cluster worst
+		dims := len(points[0])
+		sums := make([][]float64, k)
+		counts := make([]int, k)
+		for c := range sums {
+			sums[c] = make([]float64, dims)
+		}
+		for i, p := range points {
+			c := assignments[i]
+			counts[c]++
+			for d, val := range p {
+				sums[c][d] += float64(val)
+			}
+		}
+		for c := range centroids {
+			if counts[c] == 0 {
+				centroids[c] = points[worstFit(points, assignments, centroids)]
+				continue
+			}
+			centroid := make([]float32, dims)
+			for d, sum := range sums[c] {
+				centroid[d] = float32(sum)
+			}
+			centroids[c] = normalized(centroid)
+		}
+	}
+
+	return assignments, centroids
+}
+
+// CosineSimilarity assumes nothing about the vectors' lengths
+func CosineSimilarity(a, b []float32) float64 {
+	var dotAB, normA, normB float64
+	for i := range a {
+		dotAB += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dotAB / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// k-means++: each next seed is picked with probability proportional to its squared distance
+// from the nearest seed so far, which spreads the seeds out
+func seedCentroids(points [][]float32, k int, rng *rand.Rand) [][]float32 {
+	centroids := [][]float32{points[rng.Intn(len(points))]}
+
+	distances := make([]float64, len(points))
+	for len(centroids) < k {
+		var total float64
+		for i, p := range points {
+			// squared euclidean distance between unit vectors is 2 - 2cos
+			d := 2 - 2*dot(p, centroids[nearestCentroid(p, centroids)])
+			distances[i] = max(d, 0)
+			total += distances[i]
+		}
+
+		// every point sits on a seed already (duplicates), any of them will do
+		if total == 0 {
+			centroids = append(centroids, points[rng.Intn(len(points))])
+			continue
+		}
+
+		target := rng.Float64() * total
+		next := len(points) - 1
+		for i, d := range distances {
+			target -= d
+			if target <= 0 {
+				next = i
+				break
+			}
+		}
+		centroids = append(centroids, points[next])
+	}
+
+	return centroids
+}
+
+func nearestCentroid(p []float32, centroids [][]float32) int {
+	best, bestSim := 0, math.Inf(-1)
+	for c, centroid := range centroids {
+		if sim := dot(p, centroid); sim > bestSim {
+			best, bestSim = c, sim
+		}
+	}
+	return best
+}
+
+func worstFit(points [][]float32, assignments []int, centroids [][]float32) int {
+	worst, worstSim := 0, math.Inf(1)
+	for i, p := range points {
+		if sim := dot(p, centroids[assignments[i]]); sim < worstSim {
+			worst, worstSim = i, sim
+		}
+	}
+	return worst
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func normalized(v []float32) []float32 {
+	var norm float64
+	for _, val := range v {
+		norm += float64(val) * float64(val)
+	}
+	norm = math.Sqrt(norm)
+
+	res := make([]float32, len(v))
+	if norm == 0 {
+		return res
+	}
+	for i, val := range v {
+		res[i] = float32(float64(val) / norm)
+	}
+	return res
+}
@@ -3,19 +3,99 @@ package utils
 import (
     "context"
     "fmt"
+    "hash/fnv"
     "log"
+    "math"
     "strings"
     "time"
+    "unicode"
 
     "google.golang.org/genai"
 )
 
-func getEmbedding(ctx context.Context, client *genai.Client, text string, taskType string) (string, error) {
+// must match the vector(...) column on user_thoughts
+const EmbeddingDimensions = 3072
+
+const geminiEmbeddingModel = "gemini-embedding-exp-03-07"
+
+// Embedder turns text into vectors; thoughts and queries are embedded separately
+// because retrieval models treat documents and queries differently
+type Embedder interface {
+	EmbedThought(ctx context.Context, text string) ([]float32, error)
+	EmbedQuery(ctx context.Context, query string) ([]float32, error)
+
+	// one vector per text, in order, from a single API call; for bulk imports
+	EmbedThoughts(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+type GeminiEmbedder struct {
+	client *genai.Client
+}
+
+func NewGeminiEmbedder(client *genai.Client) *GeminiEmbedder {
+	return &GeminiEmbedder{client: client}
+}
+
+// in this case pretty important to track embedding API call duration
+func (e *GeminiEmbedder) EmbedThought(ctx context.Context, text string) ([]float32, error) {
+    log.Printf("[EMBEDDING] Generating embedding for thought: %s", text)
+
+	return e.getEmbedding(ctx, text, "RETRIEVAL_DOCUMENT")
+}
+
+func (e *GeminiEmbedder) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	log.Printf("[EMBEDDING] Generating embedding for query: %s", query)
+
+	return e.getEmbedding(ctx, query, "RETRIEVAL_QUERY")
+}
+
+// Gemini takes up to 100 texts per call
+func (e *GeminiEmbedder) EmbedThoughts(ctx context.Context, texts []string) ([][]float32, error) {
+	start := time.Now()
+	log.Printf("[EMBEDDING] Starting batch embedding generation for %d thought(s)", len(texts))
+
+	contents := make([]*genai.Content, len(texts))
+	for i, text := range texts {
+		contents[i] = genai.NewContentFromText(text, genai.RoleUser)
+	}
+
+	config := &genai.EmbedContentConfig{
+		TaskType: "RETRIEVAL_DOCUMENT",
+	}
+
+	result, err := e.client.Models.EmbedContent(ctx,
+		geminiEmbeddingModel,
+		contents,
+		config,
+	)
+	if err != nil {
+		log.Printf("[EMBEDDING] ERROR: Batch API call failed after %v: %v", time.Since(start), err)
+		return nil, fmt.Errorf("failed to get embeddings: %w", err)
+	}
+
+	if len(result.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(result.Embeddings), len(texts))
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for i, embedding := range result.Embeddings {
+		if embedding == nil || len(embedding.Values) == 0 {
+			return nil, fmt.Errorf("no embedding values returned for text %d", i)
+		}
+		embeddings[i] = embedding.Values
+	}
+
+	log.Printf("[EMBEDDING] Batch of %d embedding(s) completed in %v", len(texts), time.Since(start))
+
+	return embeddings, nil
+}
+
+func (e *GeminiEmbedder) getEmbedding(ctx context.Context, text string, taskType string) ([]float32, error) {
 	// generic embedding generator that can be used for both thoughts and queries
 	// takes a task type to differentiate between retrieval and other tasks
 	start := time.Now()
 	log.Printf("[EMBEDDING] Starting embedding generation for text (length: %d chars)", len(text))
-	
+
 	contents := []*genai.Content{
 		genai.NewContentFromText(text, genai.RoleUser),
 	}
@@ -24,58 +104,121 @@ func getEmbedding(ctx context.Context, client *genai.Client, text string, taskTy
 		TaskType: taskType,
 	}
 
-	log.Printf("[EMBEDDING] Calling Gemini API with model: gemini-embedding-exp-03-07")
-	
-	result, err := client.Models.EmbedContent(ctx,
-		"gemini-embedding-exp-03-07",
+	log.Printf("[EMBEDDING] Calling Gemini API with model: %s", geminiEmbeddingModel)
+
+	result, err := e.client.Models.EmbedContent(ctx,
+		geminiEmbeddingModel,
 		contents,
 		config,
 	)
-	
+
 	apiDuration := time.Since(start)
-	
+
 	if err != nil {
 		log.Printf("[EMBEDDING] ERROR: API call failed after %v: %v", apiDuration, err)
-		return "", fmt.Errorf("failed to get embedding: %w", err)
+		return nil, fmt.Errorf("failed to get embedding: %w", err)
 	}
 
 	log.Printf("[EMBEDDING] API call successful in %v", apiDuration)
 
 	if len(result.Embeddings) == 0 {
 		log.Printf("[EMBEDDING] ERROR: No embeddings returned in response")
-		return "", fmt.Errorf("no embeddings returned")
+		return nil, fmt.Errorf("no embeddings returned")
 	}
-	
+
 	if len(result.Embeddings[0].Values) == 0 {
 		log.Printf("[EMBEDDING] ERROR: Empty embedding values returned")
-		return "", fmt.Errorf("no embedding values returned")
-	}
-
-	embedding := result.Embeddings[0].Values
-	
-	// convert to PostgreSQL vector format: [1.0,2.0,3.0]
-	vectorStr := make([]string, len(embedding))
-	for i, val := range embedding {
-		vectorStr[i] = fmt.Sprintf("%.6f", val) // limit precision a bit to reduce size
+		return nil, fmt.Errorf("no embedding values returned")
 	}
 
-	vectorString := "[" + strings.Join(vectorStr, ",") + "]"
-	
 	totalDuration := time.Since(start)
 	log.Printf("[EMBEDDING] Total embedding generation completed in %v", totalDuration)
-	
-	return vectorString, nil
+
+	return result.Embeddings[0].Values, nil
 }
 
-// in this case pretty important to track embedding API call duration
-func GetThoughtEmbedding(ctx context.Context, client *genai.Client, text string) (string, error) {
-    log.Printf("[EMBEDDING] Generating embedding for thought: %s", text)
+// HashEmbedder is a deterministic offline embedder for development and tests
+// features are hashed into a fixed number of dimensions (the "hashing trick"), so texts
+// that share words or character trigrams end up close together. no network, no API key
+type HashEmbedder struct {
+	dims int
+}
 
-	return getEmbedding(ctx, client, text, "RETRIEVAL_DOCUMENT")
+func NewHashEmbedder(dims int) *HashEmbedder {
+	return &HashEmbedder{dims: dims}
 }
 
-func GetQueryEmbedding(ctx context.Context, client *genai.Client, query string) (string, error) {
-	log.Printf("[EMBEDDING] Generating embedding for query: %s", query)
+func (e *HashEmbedder) EmbedThought(ctx context.Context, text string) ([]float32, error) {
+	return e.embed(text), nil
+}
+
+// queries and thoughts share one feature space so they can be compared directly
+func (e *HashEmbedder) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	return e.embed(query), nil
+}
+
+func (e *HashEmbedder) EmbedThoughts(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = e.embed(text)
+	}
+	return embeddings, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	vec := make([]float64, e.dims)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		// whole words carry the most signal
+		e.addFeature(vec, "w:"+word, 1.0)
+
+		// word bigrams capture a little bit of order
+		if i > 0 {
+			e.addFeature(vec, "b:"+words[i-1]+" "+word, 0.5)
+		}
+
+		// character trigrams make typos and word forms ("run", "running") overlap
+		padded := []rune("^" + word + "$")
+		for j := 0; j+3 <= len(padded); j++ {
+			e.addFeature(vec, "c:"+string(padded[j:j+3]), 0.25)
+		}
+	}
+
+	// text without letters or digits ("!!!", emoji, "") has no features, and a zero vector has no
+	// cosine distance to anything (NaN in pgvector), so the whole text is hashed instead
+	if l2Norm(vec) == 0 {
+		e.addFeature(vec, "r:"+strings.TrimSpace(text), 1.0)
+	}
 
-	return getEmbedding(ctx, client, query, "RETRIEVAL_QUERY")
-}
\ No newline at end of file
+	// L2 normalize so cosine distance behaves the same as with Gemini vectors
+	norm := l2Norm(vec)
+	embedding := make([]float32, e.dims)
+	for i, v := range vec {
+		embedding[i] = float32(v / norm)
+	}
+	return embedding
+}
+
+func l2Norm(vec []float64) float64 {
+	var sum float64
+	for _, v := range vec {
+		sum += v * v
+	}
+	return math.Sqrt(sum)
+}
+
+func (e *HashEmbedder) addFeature(vec []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+
+	// top bit picks the sign so collisions tend to cancel out rather than pile up
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vec[sum%uint64(e.dims)] += weight
+}
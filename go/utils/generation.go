@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+const geminiGenerationModel = "gemini-2.5-flash"
+
+// Generator asks an LLM for a structured answer; instructions describe the JSON shape expected in out
+type Generator interface {
+	GenerateJSON(ctx context.Context, instructions string, prompt string, out any) error
+}
+
+type GeminiGenerator struct {
+	client *genai.Client
+}
+
+func NewGeminiGenerator(client *genai.Client) *GeminiGenerator {
+	return &GeminiGenerator{client: client}
+}
+
+func (g *GeminiGenerator) GenerateJSON(ctx context.Context, instructions string, prompt string, out any) error {
+	start := time.Now()
+	log.Printf("[GENERATION] Calling Gemini API with model: %s (prompt length: %d chars)", geminiGenerationModel, len(prompt))
+
+	config := &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(instructions, genai.RoleUser),
+		ResponseMIMEType:  "application/json",
+		Temperature:       genai.Ptr[float32](0.2), // answers should stick to the user's thoughts, not get creative
+	}
+
+	result, err := g.client.Models.GenerateContent(ctx,
+		geminiGenerationModel,
+		genai.Text(prompt),
+		config,
+	)
+	if err != nil {
+		log.Printf("[GENERATION] ERROR: API call failed after %v: %v", time.Since(start), err)
+		return fmt.Errorf("failed to generate content: %w", err)
+	}
+
+	log.Printf("[GENERATION] API call successful in %v", time.Since(start))
+
+	text := result.Text()
+	if text == "" {
+		return fmt.Errorf("no content returned")
+	}
+
+	if err := json.Unmarshal([]byte(text), out); err != nil {
+		return fmt.Errorf("failed to parse generated JSON: %w", err)
+	}
+
+	return nil
+}
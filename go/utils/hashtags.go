@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+// a # at the start of the text or after whitespace/punctuation (so "a#b" and URL fragments like "/#x"
+// don't count), followed by letters, digits, _, - or /
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#/&])#([\p{L}\p{N}_][\p{L}\p{N}_\-/]*)`)
+
+// ExtractHashtags returns the distinct hashtags in text, lowercased, without the #, sorted
+// "#Project" and "#project" are the same tag; "#1" isn't a tag (it has no letters)
+func ExtractHashtags(text string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tag := types.NormalizeTag(match[1])
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	sort.Strings(tags)
+	return tags
+}
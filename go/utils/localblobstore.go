@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URL path the Go HTTP server serves local blobs under
+const LocalBlobPrefix = "/blobs/"
+
+// content types live next to the blobs, under this directory of dir
+const localMetaDir = ".meta"
+
+// LocalBlobStore writes attachments to a directory on disk and serves them itself,
+// so attachments work end to end in development without AWS
+type LocalBlobStore struct {
+	dir     string
+	baseURL string // e.g. http://localhost:8080
+	signKey []byte // signs presigned URLs; random per process, so they stop working on restart
+}
+
+func NewLocalBlobStore(dir string, baseURL string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	signKey := make([]byte, 32)
+	if _, err := rand.Read(signKey); err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	return &LocalBlobStore{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		signKey: signKey,
+	}, nil
+}
+
+func (b *LocalBlobStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	log.Printf("[BLOBS] Writing file with key '%s' to '%s'", key, b.dir)
+
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", key, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, body); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", key, err)
+	}
+
+	metaPath := b.metaPath(key)
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+	if err := os.WriteFile(metaPath, []byte(contentType), 0o644); err != nil {
+		return fmt.Errorf("failed to write content type of %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (b *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	log.Printf("[BLOBS] Deleting file with key '%s' from '%s'", key, b.dir)
+
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	// deleting something that is already gone is fine, same as S3
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file %s: %w", key, err)
+	}
+	os.Remove(b.metaPath(key))
+
+	return nil
+}
+
+func (b *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", key, err)
+	}
+
+	return f, nil
+}
+
+// stands in for an S3 presigned URL: the signature covers the method, key and expiry, and for uploads
+// the content type and size, so a PUT is only accepted with the same Content-Type and Content-Length
+func (b *LocalBlobStore) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return b.presign(http.MethodGet, key, "", 0, expires)
+}
+
+func (b *LocalBlobStore) PresignPut(ctx context.Context, key string, contentType string, size int64, expires time.Duration) (string, error) {
+	return b.presign(http.MethodPut, key, contentType, size, expires)
+}
+
+func (b *LocalBlobStore) presign(method string, key string, contentType string, size int64, expires time.Duration) (string, error) {
+	if _, err := b.path(key); err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(expires).Unix()
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expiresAt, 10)},
+		"signature": {b.sign(method, key, contentType, size, expiresAt)},
+	}
+	// upload keys keep the original file name, spaces and all
+	path := (&url.URL{Path: LocalBlobPrefix + key}).EscapedPath()
+	return b.baseURL + path + "?" + query.Encode(), nil
+}
+
+func (b *LocalBlobStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file %s: %w", key, err)
+	}
+
+	// files written before content types were kept have none
+	contentType, _ := os.ReadFile(b.metaPath(key))
+
+	return &BlobInfo{
+		Size:        info.Size(),
+		ContentType: string(contentType),
+	}, nil
+}
+
+// serves the blob directory under LocalBlobPrefix to PresignGet URLs, and takes PresignPut uploads;
+// Handler mounts this when the blob store is local
+func (b *LocalBlobStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, LocalBlobPrefix)
+
+	method := r.Method
+	contentType := ""
+	size := int64(0)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		method = http.MethodGet
+	case http.MethodPut:
+		contentType = r.Header.Get("Content-Type")
+		size = r.ContentLength
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	expiresAt, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		http.Error(w, "URL expired", http.StatusForbidden)
+		return
+	}
+
+	expected := b.sign(method, key, contentType, size, expiresAt)
+	if size < 0 || !hmac.Equal([]byte(expected), []byte(r.URL.Query().Get("signature"))) {
+		http.Error(w, "Signature does not match", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		http.StripPrefix(LocalBlobPrefix, http.FileServer(http.Dir(b.dir))).ServeHTTP(w, r)
+		return
+	}
+
+	if err := b.Put(r.Context(), key, io.LimitReader(r.Body, size), contentType); err != nil {
+		log.Printf("[BLOBS] Error writing presigned upload %s: %v", key, err)
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *LocalBlobStore) sign(method string, key string, contentType string, size int64, expiresAt int64) string {
+	mac := hmac.New(sha256.New, b.signKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%d", method, key, contentType, size, expiresAt)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// where Put records the content type of key; only called with keys path accepted
+func (b *LocalBlobStore) metaPath(key string) string {
+	return filepath.Join(b.dir, localMetaDir, filepath.Clean(filepath.FromSlash(key)))
+}
+
+// resolves a key to a path inside dir, refusing anything that would escape it
+func (b *LocalBlobStore) path(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid blob key: %q", key)
+	}
+
+	return filepath.Join(b.dir, cleaned), nil
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// weights for reciprocal rank fusion; a result at rank r (1-based) in a retriever's list
+// contributes weight / (K + r) to its fused score
+type FusionConfig struct {
+	FullTextWeight float64
+	VectorWeight   float64
+	K              float64 // damping constant, 60 in the original RRF paper
+}
+
+// full-text matches are weighted higher because thoughts are short and exact words matter
+func DefaultFusionConfig() FusionConfig {
+	return FusionConfig{
+		FullTextWeight: 1.5,
+		VectorWeight:   1.0,
+		K:              60,
+	}
+}
+
+// one retriever's results, best first
+type RankedList struct {
+	Retriever string
+	Weight    float64
+	IDs       []uuid.UUID
+}
+
+type FusedResult struct {
+	ID        uuid.UUID
+	Score     float64
+	MatchedBy []string // retrievers that returned this ID, in the order the lists were given
+}
+
+// combines ranked lists with weighted reciprocal rank fusion, best first
+// ties are broken by the order IDs were first seen so results are deterministic
+func FuseRanks(k float64, lists ...RankedList) []FusedResult {
+	byID := make(map[uuid.UUID]*FusedResult)
+	var order []uuid.UUID
+
+	for _, list := range lists {
+		for rank, id := range list.IDs {
+			res, ok := byID[id]
+			if !ok {
+				res = &FusedResult{ID: id}
+				byID[id] = res
+				order = append(order, id)
+			}
+			res.Score += list.Weight / (k + float64(rank+1))
+			res.MatchedBy = append(res.MatchedBy, list.Retriever)
+		}
+	}
+
+	fused := make([]FusedResult, 0, len(order))
+	for _, id := range order {
+		fused = append(fused, *byID[id])
+	}
+
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].Score > fused[j].Score
+	})
+
+	return fused
+}
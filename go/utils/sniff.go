@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+// why a file was rejected, as sent to the client in types.RejectedFile
+const (
+	RejectTypeNotAllowed = "type_not_allowed" // the declared or detected type isn't in allowedTypes
+	RejectTypeMismatch   = "type_mismatch"    // the bytes aren't what the declared type says
+	RejectTooLarge       = "too_large"
+	RejectEmpty          = "empty"
+)
+
+// http.DetectContentType looks at no more than this many bytes
+const sniffLen = 512
+
+// RejectedFilesError lists every file of a request that was refused, so the client can show why
+// errors.Is(err, ErrInvalidUpload) holds for it
+type RejectedFilesError struct {
+	Files []types.RejectedFile
+}
+
+func (e *RejectedFilesError) Error() string {
+	reasons := make([]string, 0, len(e.Files))
+	for _, f := range e.Files {
+		reasons = append(reasons, f.Message)
+	}
+	return strings.Join(reasons, "; ")
+}
+
+func (e *RejectedFilesError) Unwrap() error {
+	return ErrInvalidUpload
+}
+
+// types whose bytes sniff as something more general: Office documents are zip archives, and Ogg and
+// WebM hold audio as well as video
+var containerTypes = map[string][]string{
+	"application/zip": {
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	},
+	"application/ogg": {"audio/ogg", "video/ogg"},
+	"video/webm":      {"audio/webm"},
+}
+
+// names http.DetectContentType uses for types allowedTypes knows by another name
+var sniffedAliases = map[string]string{
+	"audio/wave":         "audio/wav",
+	"application/x-gzip": "application/gzip",
+}
+
+// the checks that only need what the client declared; nil if the file may be uploaded
+func checkDeclaredFile(fileName string, contentType string, size int64) *types.RejectedFile {
+	switch {
+	case !validateFileType(contentType) && !isGenericType(contentType):
+		return rejectFile(fileName, RejectTypeNotAllowed, contentType, "", fmt.Sprintf("%s: type %s is not allowed", fileName, contentType))
+	case size > maxFileSize:
+		return rejectFile(fileName, RejectTooLarge, contentType, "", fmt.Sprintf("%s: exceeds maximum size of %d bytes", fileName, maxFileSize))
+	case size < 1:
+		return rejectFile(fileName, RejectEmpty, contentType, "", fmt.Sprintf("%s: file is empty", fileName))
+	}
+	return nil
+}
+
+// checks the first bytes of a file against its declared type and returns the type to store it as:
+// the detected type, or the declared one when the bytes only identify its container (zip, Ogg, WebM)
+// or show it's text, which is as specific as sniffing gets for CSV, Markdown, JSON and code
+func checkFileContent(fileName string, declared string, head []byte) (string, *types.RejectedFile) {
+	detected := sniffContentType(head)
+
+	contentType := ""
+	switch {
+	case isGenericType(declared), detected == declared:
+		contentType = detected
+	case containsType(containerTypes[detected], declared):
+		contentType = declared
+	case isTextType(detected) && isTextType(declared):
+		contentType = declared
+	// a PNG saved as .jpg is still an image; the bytes decide which kind
+	case strings.HasPrefix(detected, "image/") && strings.HasPrefix(declared, "image/"):
+		contentType = detected
+	default:
+		return "", rejectFile(fileName, RejectTypeMismatch, declared, detected,
+			fmt.Sprintf("%s: declared as %s but the content is %s", fileName, declared, detected))
+	}
+
+	if !validateFileType(contentType) {
+		return "", rejectFile(fileName, RejectTypeNotAllowed, declared, detected,
+			fmt.Sprintf("%s: type %s is not allowed", fileName, contentType))
+	}
+	return contentType, nil
+}
+
+// reads up to sniffLen bytes and returns them with a reader that still yields the whole body
+func readHead(body io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+	return head, io.MultiReader(bytes.NewReader(head), body), nil
+}
+
+// http.DetectContentType without parameters, plus the formats it doesn't know
+func sniffContentType(head []byte) string {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	if alias, ok := sniffedAliases[mediaType]; ok {
+		return alias
+	}
+
+	// tar has its magic at offset 257, MP3 files without an ID3 tag start with an MPEG frame sync
+	if mediaType == "application/octet-stream" {
+		switch {
+		case len(head) >= 262 && string(head[257:262]) == "ustar":
+			return "application/x-tar"
+		case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+			return "audio/mpeg"
+		}
+	}
+	return mediaType
+}
+
+// what clients send when they don't know the type; the detected type is used instead
+func isGenericType(contentType string) bool {
+	return contentType == "" || contentType == "application/octet-stream"
+}
+
+func isTextType(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") || contentType == "application/json"
+}
+
+func containsType(contentTypes []string, contentType string) bool {
+	for _, t := range contentTypes {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+func rejectFile(fileName string, reason string, declared string, detected string, message string) *types.RejectedFile {
+	return &types.RejectedFile{
+		FileName:     fileName,
+		Reason:       reason,
+		DeclaredType: declared,
+		DetectedType: detected,
+		Message:      message,
+	}
+}
@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+
+	"github.com/skarokin/runsynapse/go/types"
+	"golang.org/x/image/webp"
+)
+
+// widths the UI picks from, smallest first; an image gets a thumbnail at each width it's wider than
+var thumbnailWidths = []int{320, 960}
+
+// bigger images aren't decoded: the decoded image and the copy thumbnails are scaled from take
+// about 7 bytes a pixel, which has to fit in the Lambda's memory
+const maxThumbnailPixels = 25_000_000
+
+const thumbnailJPEGQuality = 80
+
+// records an image attachment's dimensions and uploads its thumbnails next to it. JPEG, PNG, GIF
+// (the first frame) and WebP are decoded; an image that can't be read is still attached, just
+// without either
+func addImageInfo(ctx context.Context, blobs BlobStore, a *types.Attachment, body io.Reader) {
+	switch a.ContentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		log.Printf("[UPLOAD] Error reading image %s: %v", a.Key, err)
+		return
+	}
+
+	config, err := decodeImageConfig(a.ContentType, data)
+	if err != nil {
+		log.Printf("[UPLOAD] Error reading image %s: %v", a.Key, err)
+		return
+	}
+
+	orientation := 1
+	if a.ContentType == "image/jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	a.Width, a.Height = config.Width, config.Height
+	if swapsAxes(orientation) {
+		a.Width, a.Height = config.Height, config.Width
+	}
+
+	if config.Width*config.Height > maxThumbnailPixels {
+		log.Printf("[UPLOAD] Not making thumbnails for %s: %dx%d is too large", a.Key, config.Width, config.Height)
+		return
+	}
+
+	a.Thumbnails, err = makeThumbnails(ctx, blobs, a, data, config, orientation)
+	if err != nil {
+		log.Printf("[UPLOAD] Error making thumbnails for %s: %v", a.Key, err)
+	}
+}
+
+// returns the thumbnails uploaded before any error
+func makeThumbnails(ctx context.Context, blobs BlobStore, a *types.Attachment, data []byte, config image.Config, orientation int) ([]types.Thumbnail, error) {
+	var thumbnails []types.Thumbnail
+	var src *image.RGBA
+	for _, width := range thumbnailWidths {
+		if width >= a.Width {
+			break
+		}
+
+		// decoded only once it's known a thumbnail is needed
+		if src == nil {
+			img, err := decodeImage(a.ContentType, data)
+			if err != nil {
+				return thumbnails, err
+			}
+			// drawn onto a canvas of the full size, since a GIF's first frame can be smaller
+			src = image.NewRGBA(image.Rect(0, 0, config.Width, config.Height))
+			draw.Draw(src, img.Bounds(), img, img.Bounds().Min, draw.Src)
+		}
+
+		height := max(1, (a.Height*width+a.Width/2)/a.Width)
+
+		// scaled before it's rotated, so a sideways photo is scaled to height x width
+		scaledWidth, scaledHeight := width, height
+		if swapsAxes(orientation) {
+			scaledWidth, scaledHeight = height, width
+		}
+		thumb := orient(resize(src, scaledWidth, scaledHeight), orientation)
+
+		var buf bytes.Buffer
+		ext, contentType, err := encodeThumbnail(&buf, thumb, a.ContentType)
+		if err != nil {
+			return thumbnails, err
+		}
+
+		key := fmt.Sprintf("%s.%dw.%s", a.Key, width, ext)
+		if err := blobs.Put(ctx, key, bytes.NewReader(buf.Bytes()), contentType); err != nil {
+			return thumbnails, fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+
+		thumbnails = append(thumbnails, types.Thumbnail{
+			Width:  width,
+			Height: height,
+			Key:    key,
+		})
+	}
+	return thumbnails, nil
+}
+
+// by content type rather than image.Decode, which only knows the formats some package registered
+func decodeImageConfig(contentType string, data []byte) (image.Config, error) {
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.DecodeConfig(bytes.NewReader(data))
+	case "image/png":
+		return png.DecodeConfig(bytes.NewReader(data))
+	case "image/gif":
+		return gif.DecodeConfig(bytes.NewReader(data))
+	case "image/webp":
+		return webp.DecodeConfig(bytes.NewReader(data))
+	}
+	return image.Config{}, fmt.Errorf("can't decode %s", contentType)
+}
+
+func decodeImage(contentType string, data []byte) (image.Image, error) {
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		return png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		return gif.Decode(bytes.NewReader(data))
+	case "image/webp":
+		return webp.Decode(bytes.NewReader(data))
+	}
+	return nil, fmt.Errorf("can't decode %s", contentType)
+}
+
+// photos stay JPEG; PNG, GIF and WebP thumbnails are PNG so transparency survives
+func encodeThumbnail(w io.Writer, img image.Image, contentType string) (string, string, error) {
+	if contentType == "image/jpeg" {
+		return "jpg", "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: thumbnailJPEGQuality})
+	}
+	return "png", "image/png", png.Encode(w, img)
+}
+
+// averages the source pixels each destination pixel covers, which keeps detail when scaling down a
+// lot; only used to scale down
+func resize(src *image.RGBA, width int, height int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max((y+1)*srcHeight/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max((x+1)*srcWidth/width, x0+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					sum[0] += int(src.Pix[i])
+					sum[1] += int(src.Pix[i+1])
+					sum[2] += int(src.Pix[i+2])
+					sum[3] += int(src.Pix[i+3])
+					i += 4
+				}
+			}
+
+			n := (x1 - x0) * (y1 - y0)
+			j := dst.PixOffset(x, y)
+			for c := range sum {
+				dst.Pix[j+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// orientations 5-8 are rotated a quarter turn, so width and height trade places
+func swapsAxes(orientation int) bool {
+	return orientation >= 5 && orientation <= 8
+}
+
+// applies an EXIF orientation, so thumbnails come out the way browsers show the original
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	dstWidth, dstHeight := width, height
+	if swapsAxes(orientation) {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontally
+				sx, sy = width-1-x, y
+			case 3: // half turn
+				sx, sy = width-1-x, height-1-y
+			case 4: // flip vertically
+				sx, sy = x, height-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // quarter turn clockwise
+				sx, sy = y, height-1-x
+			case 7: // transverse
+				sx, sy = width-1-y, height-1-x
+			case 8: // quarter turn counterclockwise
+				sx, sy = width-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
+
+// the EXIF Orientation tag (1-8) of a JPEG, or 1 if it has none. cameras save photos the way the
+// sensor was held and leave the rotation to whatever shows them
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		// EXIF comes before the image data
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+
+		// the length counts its own two bytes
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// reads the Orientation tag from the first IFD of a TIFF header
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 1
+		}
+		return orientation
+	}
+	return 1
+}
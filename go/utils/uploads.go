@@ -0,0 +1,368 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+	"mime/multipart"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"github.com/skarokin/runsynapse/go/types"
+)
+
+var allowedTypes = map[string]bool{
+	// Images
+    "image/jpeg":    true,
+    "image/png":     true,
+    "image/gif":     true,
+    "image/webp":    true,
+    "image/svg+xml": false, // SVG can contain scripts - avoid unless needed
+    
+    // Documents
+    "application/pdf":     true,
+    "text/plain":          true,
+    "text/csv":            true,
+    "text/markdown":       true,
+    
+    // Modern Office formats (safer than old ones)
+    "application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true, // .docx
+    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true, // .xlsx
+    "application/vnd.openxmlformats-officedocument.presentationml.presentation": true, // .pptx
+    
+    // Archive formats
+    "application/zip": true,
+    "application/x-tar": true,
+    "application/gzip": true,
+    
+    // Audio (for voice messages)
+    "audio/mpeg":  true, // .mp3
+    "audio/wav":   true,
+    "audio/ogg":   true,
+    "audio/webm":  true,
+    
+    // Video (for video messages)
+    "video/mp4":   true,
+    "video/webm":  true,
+    "video/ogg":   true,
+    
+    // Code files
+    "application/json": true,
+    "text/javascript":  true,
+    "text/css":         true,
+    "text/html":        true,
+    
+    // Avoid these dangerous types:
+    "application/msword":           false, // .doc - can contain macros
+    "application/vnd.ms-excel":     false, // .xls - can contain macros
+    "application/vnd.ms-powerpoint": false, // .ppt - can contain macros
+    "application/x-msdownload":     false, // .exe
+    "application/x-executable":     false, // executables
+    "application/x-shockwave-flash": false, // .swf
+}
+
+const maxFileSize = 12 * 1024 * 1024 // 12 MB
+
+// wrapped by the upload checks, so handlers can answer 400 instead of 500
+var ErrInvalidUpload = errors.New("invalid upload")
+
+func generateKeyFromFilename(filename string) string {
+	// get file extension and base name
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	// generate unique hash from extension, base name, nanoseconds, and uuid
+	hash := sha256.New()
+    hash.Write([]byte(fmt.Sprintf("%s_%d_%s", base, time.Now().UnixNano(), uuid.New().String())))
+	hashStr := fmt.Sprintf("%x", hash.Sum(nil))[:12]	// first 12 chars; reduce length for readability
+
+	// clean up filename and combine with hash
+	cleanName := strings.ReplaceAll(base, " ", "_")
+	cleanName = strings.ReplaceAll(cleanName, "/", "_")
+
+	// return final key with cleanName_hash.ext
+    return fmt.Sprintf("%s_%s%s", cleanName, hashStr, ext)
+}
+
+// returns the uploaded files as attachments, in order; every file is checked before any is uploaded,
+// and if some are refused the error is a *RejectedFilesError listing all of them. if uploading fails
+// partway, the files already uploaded are returned with the error so the caller can delete them
+func UploadFiles(ctx context.Context, blobs BlobStore, files []*multipart.FileHeader) ([]types.Attachment, error) {
+	log.Printf("[UPLOAD] Uploading %d files", len(files))
+
+    var attachments []types.Attachment
+    
+    if len(files) == 0 {
+        return attachments, nil
+    }
+    
+    log.Printf("Processing %d file(s)", len(files))
+
+	contentTypes, err := inspectFiles(files)
+	if err != nil {
+		return nil, err
+	}
+    
+    for i, fileHeader := range files {
+		contentType := contentTypes[i]
+
+        file, err := fileHeader.Open()
+        if err != nil {
+            log.Printf("Error opening file %s: %v", fileHeader.Filename, err)
+            return attachments, fmt.Errorf("failed to open file %s: %w", fileHeader.Filename, err)
+        }
+        defer file.Close()
+
+		// hashed in a first pass so the blob store still gets a seekable body
+		sum, err := hashFile(file)
+		if err != nil {
+			log.Printf("Error reading file %s: %v", fileHeader.Filename, err)
+			return attachments, fmt.Errorf("failed to read file %s: %w", fileHeader.Filename, err)
+		}
+
+        key := generateKeyFromFilename(fileHeader.Filename)
+        
+        err = blobs.Put(ctx, key, file, contentType)
+        if err != nil {
+            log.Printf("Error uploading file %s: %v", fileHeader.Filename, err)
+            return attachments, fmt.Errorf("failed to upload file %s: %w", fileHeader.Filename, err)
+        }
+        
+        attachment := types.Attachment{
+			Key:         key,
+			FileName:    fileHeader.Filename,
+			ContentType: contentType,
+			Size:        fileHeader.Size,
+			SHA256:      sum,
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return attachments, fmt.Errorf("failed to read file %s: %w", fileHeader.Filename, err)
+		}
+		addImageInfo(ctx, blobs, &attachment, file)
+
+        attachments = append(attachments, attachment)
+    }
+    
+    return attachments, nil
+}
+
+// CheckFiles makes the checks UploadFiles does without uploading anything, so a request that's refused
+// for another reason can still report every file
+func CheckFiles(files []*multipart.FileHeader) error {
+	_, err := inspectFiles(files)
+	return err
+}
+
+// the type to store each form file as, or a *RejectedFilesError listing every file that can't be
+func inspectFiles(files []*multipart.FileHeader) ([]string, error) {
+	contentTypes := make([]string, len(files))
+	var rejected []types.RejectedFile
+	for i, fileHeader := range files {
+		contentType, rejection, err := inspectFile(fileHeader)
+		if err != nil {
+			log.Printf("Error reading file %s: %v", fileHeader.Filename, err)
+			return nil, fmt.Errorf("failed to read file %s: %w", fileHeader.Filename, err)
+		}
+		if rejection != nil {
+			log.Printf("Rejected file %s: %s", fileHeader.Filename, rejection.Message)
+			rejected = append(rejected, *rejection)
+			continue
+		}
+		contentTypes[i] = contentType
+	}
+	if len(rejected) > 0 {
+		return nil, &RejectedFilesError{Files: rejected}
+	}
+	return contentTypes, nil
+}
+
+// the type to store a form file as, going by its first bytes rather than the Content-Type header
+// the client sent; a rejection if the two disagree or the file can't be uploaded at all
+func inspectFile(fileHeader *multipart.FileHeader) (string, *types.RejectedFile, error) {
+	declared, _, err := mime.ParseMediaType(fileHeader.Header.Get("Content-Type"))
+	if err != nil {
+		declared = ""
+	}
+
+	if rejection := checkDeclaredFile(fileHeader.Filename, declared, fileHeader.Size); rejection != nil {
+		return "", rejection, nil
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	head, _, err := readHead(file)
+	if err != nil {
+		return "", nil, err
+	}
+
+	contentType, rejection := checkFileContent(fileHeader.Filename, declared, head)
+	return contentType, rejection, nil
+}
+
+// hex SHA-256 of the whole file, which is then rewound
+func hashFile(file io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// UploadFile is UploadFiles for a single file that didn't come from a form (imports), so there's no
+// Content-Type header; the extension stands in for it and is checked against the bytes the same way
+func UploadFile(ctx context.Context, blobs BlobStore, filename string, body io.Reader) (types.Attachment, error) {
+	// read one byte past the limit to tell a file of exactly maxFileSize from a bigger one
+	data, err := io.ReadAll(io.LimitReader(body, maxFileSize+1))
+	if err != nil {
+		return types.Attachment{}, fmt.Errorf("failed to read file %s: %w", filename, err)
+	}
+
+	declared := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
+	if declared != "" {
+		declared, _, _ = mime.ParseMediaType(declared)
+	}
+	if rejection := checkDeclaredFile(filename, declared, int64(len(data))); rejection != nil {
+		return types.Attachment{}, &RejectedFilesError{Files: []types.RejectedFile{*rejection}}
+	}
+
+	contentType, rejection := checkFileContent(filename, declared, data[:min(len(data), sniffLen)])
+	if rejection != nil {
+		return types.Attachment{}, &RejectedFilesError{Files: []types.RejectedFile{*rejection}}
+	}
+
+	key := generateKeyFromFilename(filename)
+	if err := blobs.Put(ctx, key, bytes.NewReader(data), contentType); err != nil {
+		return types.Attachment{}, fmt.Errorf("failed to upload file %s: %w", filename, err)
+	}
+
+	sum := sha256.Sum256(data)
+	attachment := types.Attachment{
+		Key:         key,
+		FileName:    filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+	addImageInfo(ctx, blobs, &attachment, bytes.NewReader(data))
+	return attachment, nil
+}
+
+func validateFileType(fileType string) bool {
+	if fileType == "" {
+		return false
+	}
+
+	if allowed, exists := allowedTypes[fileType]; exists {
+		return allowed
+	}
+	
+	return false
+}
+
+// presigned uploads go under the user's own prefix, so newThought can't be handed someone else's key
+func UploadKeyPrefix(userID uuid.UUID) string {
+	return fmt.Sprintf("uploads/%s/", userID)
+}
+
+// the original file name is the last segment of the key, so VerifyUpload can get it back
+func NewUploadKey(userID uuid.UUID, filename string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(filename))
+	if name == "" || name == "." || name == ".." {
+		name = "file"
+	}
+	return UploadKeyPrefix(userID) + uuid.NewString() + "/" + name
+}
+
+// the checks UploadFiles makes on a form file, for a file the client declares before uploading it;
+// a refused file is returned as a *RejectedFilesError. its bytes are checked by VerifyUpload
+func ValidateUpload(filename string, contentType string, size int64) error {
+	if rejection := checkDeclaredFile(filename, contentType, size); rejection != nil {
+		return &RejectedFilesError{Files: []types.RejectedFile{*rejection}}
+	}
+	return nil
+}
+
+// VerifyUpload checks that a presigned upload belongs to the user, was actually uploaded, and is still
+// an allowed type and size, then reads it once to check its first bytes against the type it was
+// uploaded with, hash it, and copy exactly those bytes to a key of its own (with thumbnails of
+// images). the presigned URL stays valid for a while and can't reach the copy, so the attachment is
+// what was checked; the caller deletes the upload once the attachment is saved, so it can't be
+// attached again. a file whose content doesn't match is a *RejectedFilesError
+func VerifyUpload(ctx context.Context, blobs BlobStore, userID uuid.UUID, key string) (types.Attachment, error) {
+	if !strings.HasPrefix(key, UploadKeyPrefix(userID)) || path.Clean(key) != key {
+		return types.Attachment{}, fmt.Errorf("%w: key %s is not one of the user's uploads", ErrInvalidUpload, key)
+	}
+
+	info, err := blobs.Stat(ctx, key)
+	if errors.Is(err, ErrBlobNotFound) {
+		return types.Attachment{}, fmt.Errorf("%w: %s was not uploaded", ErrInvalidUpload, key)
+	}
+	if err != nil {
+		return types.Attachment{}, err
+	}
+
+	fileName := path.Base(key)
+	if err := ValidateUpload(fileName, info.ContentType, info.Size); err != nil {
+		return types.Attachment{}, err
+	}
+
+	body, err := blobs.Get(ctx, key)
+	if err != nil {
+		return types.Attachment{}, err
+	}
+	defer body.Close()
+
+	// read one byte past the limit, the object may have been replaced since Stat
+	data, err := io.ReadAll(io.LimitReader(body, maxFileSize+1))
+	if err != nil {
+		return types.Attachment{}, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	if rejection := checkDeclaredFile(fileName, info.ContentType, int64(len(data))); rejection != nil {
+		return types.Attachment{}, &RejectedFilesError{Files: []types.RejectedFile{*rejection}}
+	}
+
+	contentType, rejection := checkFileContent(fileName, info.ContentType, data[:min(len(data), sniffLen)])
+	if rejection != nil {
+		return types.Attachment{}, &RejectedFilesError{Files: []types.RejectedFile{*rejection}}
+	}
+
+	// stored under the detected type, which may not be the one it was uploaded with
+	attachmentKey := generateKeyFromFilename(fileName)
+	if err := blobs.Put(ctx, attachmentKey, bytes.NewReader(data), contentType); err != nil {
+		return types.Attachment{}, fmt.Errorf("failed to copy %s: %w", key, err)
+	}
+
+	sum := sha256.Sum256(data)
+	attachment := types.Attachment{
+		Key:         attachmentKey,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+	addImageInfo(ctx, blobs, &attachment, bytes.NewReader(data))
+	return attachment, nil
+}